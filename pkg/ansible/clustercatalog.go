@@ -10,6 +10,7 @@ type ClusterCatalog struct {
 	ClusterName               string `yaml:"kubernetes_cluster_name"`
 	AdminPassword             string `yaml:"kubernetes_admin_password"`
 	TLSDirectory              string `yaml:"tls_directory"`
+	TLSCAFile                 string `yaml:"tls_ca_file"`
 	ServicesCIDR              string `yaml:"kubernetes_services_cidr"`
 	PodCIDR                   string `yaml:"kubernetes_pods_cidr"`
 	DNSServiceIP              string `yaml:"kubernetes_dns_service_ip"`
@@ -46,6 +47,14 @@ type ClusterCatalog struct {
 
 	WorkerNode string `yaml:"worker_node"`
 
+	// etcd membership vars, omitted when not set so that playbooks can provide their own
+	EtcdNode   string `yaml:"etcd_node,omitempty"`
+	EtcdMember string `yaml:"etcd_member,omitempty"`
+
+	// etcd backup and restore vars
+	EtcdBackupDirectory  string `yaml:"etcd_backup_dir"`
+	EtcdBackupNetworking bool   `yaml:"etcd_backup_networking"`
+
 	NFSVolumes []NFSVolume `yaml:"nfs_volumes"`
 
 	EnableGluster bool `yaml:"configure_storage"`
@@ -64,8 +73,14 @@ type ClusterCatalog struct {
 
 	TargetVersion string `yaml:"kismatic_short_version"`
 
+	// recorded in the node manifest, to identify the run that configured the node
+	PlanHash string `yaml:"kismatic_plan_hash"`
+	RunID    string `yaml:"kismatic_run_id"`
+
 	OnlineUpgrade bool `yaml:"online_upgrade"`
 
+	PrePullReportDirectory string `yaml:"prepull_report_dir"`
+
 	DiagnosticsDirectory string `yaml:"diagnostics_dir"`
 	DiagnosticsDateTime  string `yaml:"diagnostics_date_time"`
 
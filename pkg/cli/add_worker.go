@@ -19,6 +19,7 @@ type addWorkerOpts struct {
 	OutputFormat             string
 	Verbose                  bool
 	SkipPreFlight            bool
+	Role                     string
 }
 
 // NewCmdAddWorker returns the command for adding workers to the cluster
@@ -28,39 +29,84 @@ func NewCmdAddWorker(out io.Writer, installOpts *installOpts) *cobra.Command {
 		Use:   "add-worker WORKER_NAME WORKER_IP [WORKER_INTERNAL_IP]",
 		Short: "add a Worker node to an existing Kubernetes cluster",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 || len(args) > 3 {
-				return cmd.Usage()
+			newWorker, err := newNodeFromArgs(cmd, args, opts)
+			if err != nil || newWorker == nil {
+				return err
 			}
-			newWorker := install.Node{
-				Host: args[0],
-				IP:   args[1],
-			}
-			if len(args) == 3 {
-				newWorker.InternalIP = args[2]
-			}
-			if len(opts.NodeLabels) > 0 {
-				newWorker.Labels = make(map[string]string)
-				for _, l := range opts.NodeLabels {
-					pair := strings.Split(l, "=")
-					if len(pair) != 2 {
-						return fmt.Errorf("invalid label %q provided, must be key=value pair", l)
-					}
-					newWorker.Labels[pair[0]] = pair[1]
-				}
+			return doAddNode(out, installOpts.planFilename, opts, *newWorker, "worker")
+		},
+	}
+	addNodeFlags(cmd, opts)
+	return cmd
+}
+
+// NewCmdAddNode returns the command for adding worker, ingress or storage nodes to the cluster
+func NewCmdAddNode(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &addWorkerOpts{}
+	cmd := &cobra.Command{
+		Use:   "add-node NODE_NAME NODE_IP [NODE_INTERNAL_IP]",
+		Short: "add a Worker, Ingress or Storage node to an existing Kubernetes cluster",
+		Long: `Add a Worker, Ingress or Storage node to an existing Kubernetes cluster.
+
+The certificates of the new node are generated, and the Kubernetes node components are
+deployed on it. Depending on the role of the node:
+
+  ingress: the node is labeled as an ingress node, and the ingress controller is
+           deployed if it is not already running in the cluster
+  storage: GlusterFS is installed and started on the node, and the node is probed
+           into the trusted storage pool`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			newNode, err := newNodeFromArgs(cmd, args, opts)
+			if err != nil || newNode == nil {
+				return err
 			}
-			return doAddWorker(out, installOpts.planFilename, opts, newWorker)
+			return doAddNode(out, installOpts.planFilename, opts, *newNode, opts.Role)
 		},
 	}
+	addNodeFlags(cmd, opts)
+	cmd.Flags().StringVar(&opts.Role, "role", "worker", "role of the new node (options \"worker\"|\"ingress\"|\"storage\")")
+	return cmd
+}
+
+func addNodeFlags(cmd *cobra.Command, opts *addWorkerOpts) {
 	cmd.Flags().StringSliceVarP(&opts.NodeLabels, "labels", "l", []string{}, "key=value pairs separated by ','")
 	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&opts.RestartServices, "restart-services", false, "force restart clusters services (Use with care)")
 	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
 	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
 	cmd.Flags().BoolVar(&opts.SkipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
-	return cmd
 }
 
-func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker install.Node) error {
+// newNodeFromArgs returns the node described by the command arguments and label flags.
+// A nil node is returned when the usage was printed.
+func newNodeFromArgs(cmd *cobra.Command, args []string, opts *addWorkerOpts) (*install.Node, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, cmd.Usage()
+	}
+	newNode := install.Node{
+		Host: args[0],
+		IP:   args[1],
+	}
+	if len(args) == 3 {
+		newNode.InternalIP = args[2]
+	}
+	if len(opts.NodeLabels) > 0 {
+		newNode.Labels = make(map[string]string)
+		for _, l := range opts.NodeLabels {
+			pair := strings.Split(l, "=")
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("invalid label %q provided, must be key=value pair", l)
+			}
+			newNode.Labels[pair[0]] = pair[1]
+		}
+	}
+	return &newNode, nil
+}
+
+func doAddNode(out io.Writer, planFile string, opts *addWorkerOpts, newNode install.Node, role string) error {
+	if role != "worker" && role != "ingress" && role != "storage" {
+		return fmt.Errorf("invalid role %q, must be one of \"worker\", \"ingress\" or \"storage\"", role)
+	}
 	planner := &install.FilePlanner{File: planFile}
 	if !planner.PlanExists() {
 		return planFileNotFoundErr{filename: planFile}
@@ -70,6 +116,7 @@ func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker
 		RestartServices:          opts.RestartServices,
 		OutputFormat:             opts.OutputFormat,
 		Verbose:                  opts.Verbose,
+		PlanFile:                 planFile,
 	}
 	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
 	if err != nil {
@@ -79,53 +126,53 @@ func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker
 	if err != nil {
 		return fmt.Errorf("failed to read plan file: %v", err)
 	}
-	if _, errs := install.ValidateNode(&newWorker); errs != nil {
+	if _, errs := install.ValidateNode(&newNode); errs != nil {
 		util.PrintValidationErrors(out, errs)
-		return errors.New("information provided about the new worker node is invalid")
+		return errors.New("information provided about the new node is invalid")
 	}
 	if _, errs := install.ValidatePlan(plan); errs != nil {
 		util.PrintValidationErrors(out, errs)
 		return errors.New("the plan file failed validation")
 	}
-	workerSSHCon := &install.SSHConnection{
+	nodeSSHCon := &install.SSHConnection{
 		SSHConfig: &plan.Cluster.SSH,
-		Node:      &newWorker,
+		Node:      &newNode,
 	}
-	if _, errs := install.ValidateSSHConnection(workerSSHCon, "New worker node"); errs != nil {
+	if _, errs := install.ValidateSSHConnection(nodeSSHCon, "New node"); errs != nil {
 		util.PrintValidationErrors(out, errs)
 		return errors.New("could not establish SSH connection to the new node")
 	}
-	if err = ensureNodeIsNew(*plan, newWorker); err != nil {
+	if err = ensureNodeIsNew(*plan, newNode, role); err != nil {
 		return err
 	}
 	if !opts.SkipPreFlight {
-		util.PrintHeader(out, "Running Pre-Flight Checks On New Worker", '=')
-		if err = executor.RunNewWorkerPreFlightCheck(*plan, newWorker); err != nil {
+		util.PrintHeader(out, "Running Pre-Flight Checks On New Node", '=')
+		if err = executor.RunNewNodePreFlightCheck(*plan, newNode, role); err != nil {
 			return err
 		}
 	}
-	updatedPlan, err := executor.AddWorker(plan, newWorker)
+	updatedPlan, err := executor.AddNode(plan, newNode, role)
 	if err != nil {
 		return err
 	}
 	if err := planner.Write(updatedPlan); err != nil {
-		return fmt.Errorf("error updating plan file to inlcude new worker node: %v", err)
+		return fmt.Errorf("error updating plan file to include new node: %v", err)
 	}
 	return nil
 }
 
-// returns an error if the plan contains a worker that is "equivalent"
-// to the new worker that is being added
-func ensureNodeIsNew(plan install.Plan, newWorker install.Node) error {
-	for _, n := range plan.Worker.Nodes {
-		if n.Host == newWorker.Host {
-			return fmt.Errorf("according to the plan file, the host name of the new node is already being used by another worker node")
+// returns an error if the plan contains a node with the same role that is
+// "equivalent" to the new node that is being added
+func ensureNodeIsNew(plan install.Plan, newNode install.Node, role string) error {
+	for _, n := range plan.GetNodesWithRole(role) {
+		if n.Host == newNode.Host {
+			return fmt.Errorf("according to the plan file, the host name of the new node is already being used by another %s node", role)
 		}
-		if n.IP == newWorker.IP {
-			return fmt.Errorf("according to the plan file, the IP of the new node is already being used by another worker node")
+		if n.IP == newNode.IP {
+			return fmt.Errorf("according to the plan file, the IP of the new node is already being used by another %s node", role)
 		}
-		if newWorker.InternalIP != "" && n.InternalIP == newWorker.InternalIP {
-			return fmt.Errorf("according to the plan file, the internal IP of the new node is already being used by another worker node")
+		if newNode.InternalIP != "" && n.InternalIP == newNode.InternalIP {
+			return fmt.Errorf("according to the plan file, the internal IP of the new node is already being used by another %s node", role)
 		}
 	}
 	return nil
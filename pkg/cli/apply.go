@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/junit"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -19,6 +20,8 @@ type applyCmd struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	reconcile          bool
+	report             *junit.Report
 }
 
 type applyOpts struct {
@@ -27,6 +30,8 @@ type applyOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	reconcile          bool
+	report             string
 }
 
 // NewCmdApply creates a cluter using the plan file
@@ -40,11 +45,22 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 				return fmt.Errorf("Unexpected args: %v", args)
 			}
 			planner := &install.FilePlanner{File: installOpts.planFilename}
+			reportFile, err := parseReportOption(applyOpts.report)
+			if err != nil {
+				return err
+			}
+			var report *junit.Report
+			if reportFile != "" {
+				report = &junit.Report{}
+				defer writeReport(out, report, reportFile)
+			}
 			executorOpts := install.ExecutorOptions{
 				GeneratedAssetsDirectory: applyOpts.generatedAssetsDir,
 				RestartServices:          applyOpts.restartServices,
 				OutputFormat:             applyOpts.outputFormat,
 				Verbose:                  applyOpts.verbose,
+				Report:                   report,
+				PlanFile:                 installOpts.planFilename,
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
 			if err != nil {
@@ -60,6 +76,8 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 				verbose:            applyOpts.verbose,
 				outputFormat:       applyOpts.outputFormat,
 				skipPreFlight:      applyOpts.skipPreFlight,
+				reconcile:          applyOpts.reconcile,
+				report:             report,
 			}
 			return applyCmd.run()
 		},
@@ -71,18 +89,22 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 	cmd.Flags().BoolVar(&applyOpts.verbose, "verbose", false, "enable verbose logging from the installation")
 	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
 	cmd.Flags().BoolVar(&applyOpts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	cmd.Flags().BoolVar(&applyOpts.reconcile, "reconcile", false, "only apply the changes made to the plan file since it was last applied to the cluster")
+	addReportFlag(cmd.Flags(), &applyOpts.report)
 
 	return cmd
 }
 
 func (c *applyCmd) run() error {
-	// Validate and run pre-flight
+	// Validate and run pre-flight. The cluster is already installed when
+	// reconciling, so the pre-flight checks do not apply.
 	opts := &validateOpts{
 		planFile:           c.planFile,
 		verbose:            c.verbose,
 		outputFormat:       c.outputFormat,
-		skipPreFlight:      c.skipPreFlight,
+		skipPreFlight:      c.skipPreFlight || c.reconcile,
 		generatedAssetsDir: c.generatedAssetsDir,
+		report:             c.report,
 	}
 	err := doValidate(c.out, c.planner, opts)
 	if err != nil {
@@ -93,6 +115,15 @@ func (c *applyCmd) run() error {
 		return fmt.Errorf("error reading plan file: %v", err)
 	}
 
+	if c.reconcile {
+		if err := c.executor.Reconcile(plan); err != nil {
+			return fmt.Errorf("error reconciling cluster: %v", err)
+		}
+		util.PrintColor(c.out, util.Green, "\nThe cluster was reconciled successfully!\n")
+		fmt.Fprintln(c.out)
+		return nil
+	}
+
 	// Generate certificates
 	if err := c.executor.GenerateCertificates(plan, false); err != nil {
 		return fmt.Errorf("error installing: %v", err)
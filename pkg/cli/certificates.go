@@ -7,7 +7,7 @@ import (
 )
 
 // NewCmdCertificates creates a new certificates command
-func NewCmdCertificates(out io.Writer) *cobra.Command {
+func NewCmdCertificates(in io.Reader, out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "certificates",
 		Short: "Manage cluster certificates",
@@ -17,6 +17,8 @@ func NewCmdCertificates(out io.Writer) *cobra.Command {
 	}
 
 	cmd.AddCommand(NewCmdGenerate(out))
+	cmd.AddCommand(NewCmdValidateCertificates(out))
+	cmd.AddCommand(NewCmdDeployCertificates(in, out))
 
 	return cmd
 }
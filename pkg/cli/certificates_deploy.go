@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type certificatesDeployOpts struct {
+	planFilename       string
+	generatedAssetsDir string
+	outputFormat       string
+	verbose            bool
+	expiringWithin     int
+	rotateCA           bool
+	force              bool
+}
+
+// NewCmdDeployCertificates creates a new certificates deploy command
+func NewCmdDeployCertificates(in io.Reader, out io.Writer) *cobra.Command {
+	opts := &certificatesDeployOpts{}
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Regenerate and deploy the cluster certificates to the nodes",
+		Long: `Regenerate and deploy the cluster certificates to the nodes.
+
+The certificates that are missing from the generated assets directory, that expire
+within the given number of days, or whose subject alternate names no longer match the
+plan file are regenerated. They are deployed to the nodes that use them, and the
+components of each node are restarted one node at a time, so that the cluster remains
+available.
+
+When --rotate-ca is set, a new CA replaces the cluster CA. A trust bundle of both
+CAs is deployed to every node first, followed by the certificates signed by the new
+CA, and finally the new CA alone. The service account signing certificate is not
+replaced, so existing service account tokens remain valid. If the rotation fails,
+running the command again resumes the rotation.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doCertificatesDeploy(in, out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().IntVar(&opts.expiringWithin, "expiring-within", 45, "regenerate certificates that expire within this number of days")
+	cmd.Flags().BoolVar(&opts.rotateCA, "rotate-ca", false, "replace the cluster CA with a new CA, and regenerate all the certificates")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "do not prompt")
+	return cmd
+}
+
+func doCertificatesDeploy(in io.Reader, out io.Writer, opts *certificatesDeployOpts) error {
+	if opts.expiringWithin < 0 {
+		return fmt.Errorf("--expiring-within must be greater or equal to 0, got: %d", opts.expiringWithin)
+	}
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(out, plan, nil); err != nil {
+		return err
+	}
+	pki := &install.LocalPKI{
+		GeneratedCertsDirectory: filepath.Join(opts.generatedAssetsDir, "keys"),
+		Log:                     out,
+	}
+	exists, err := pki.CertificateAuthorityExists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("the cluster CA was not found in %q", opts.generatedAssetsDir)
+	}
+
+	util.PrintHeader(out, "Validating Certificates", '=')
+	warns, errs := pki.ValidateClusterCertificates(plan)
+	if len(errs) > 0 {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("error validating the cluster certificates")
+	}
+	if len(warns) > 0 {
+		util.PrettyPrintWarn(out, "Found certificates that no longer match the plan file, they will be regenerated")
+		util.PrintValidationErrors(out, warns)
+	} else {
+		util.PrettyPrintOk(out, "The certificates match the plan file")
+	}
+
+	if opts.rotateCA && !opts.force {
+		ans, err := util.PromptForString(in, out, "Are you sure you want to replace the cluster CA? All the components of the cluster will be restarted", "N", []string{"N", "y"})
+		if err != nil {
+			return fmt.Errorf("error getting user response: %v", err)
+		}
+		if strings.ToLower(ans) != "y" {
+			return nil
+		}
+	}
+	if err = validateSSHConnectivity(out, plan, nil); err != nil {
+		return err
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFilename,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	deployOpts := install.DeployCertificatesOptions{
+		ExpiringWithin: time.Duration(opts.expiringWithin) * 24 * time.Hour,
+		RotateCA:       opts.rotateCA,
+	}
+	if err = executor.DeployCertificates(*plan, deployOpts); err != nil {
+		return err
+	}
+
+	util.PrintHeader(out, "Generating Kubeconfig File", '=')
+	isDiff, err := install.RegenerateKubeconfig(plan, opts.generatedAssetsDir)
+	if err != nil {
+		return fmt.Errorf("error generating kubeconfig file: %v", err)
+	}
+	if isDiff {
+		util.PrettyPrintWarn(out, "An updated kubeconfig file has been generated in %q", opts.generatedAssetsDir)
+	} else {
+		util.PrettyPrintOk(out, "Found existing kubeconfig file in %q", opts.generatedAssetsDir)
+	}
+	util.PrintColor(out, util.Green, "\nThe certificates were deployed successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type certificatesValidateOpts struct {
+	planFilename       string
+	generatedAssetsDir string
+	warningWindow      int
+	outputFormat       string
+}
+
+// NewCmdValidateCertificates creates a new certificates validate command
+func NewCmdValidateCertificates(out io.Writer) *cobra.Command {
+	opts := &certificatesValidateOpts{}
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the certificates deployed on the cluster nodes",
+		Long: `Validate the certificates deployed on the cluster nodes.
+
+The certificates of each component are read from every node via ssh, and verified
+against the certificates that are expected for the node according to the plan file.
+The expiry, issuer and subject alternate names of each certificate are reported.
+Certificates that have expired, or that expire within the warning window, are flagged.
+When the cluster CA is found in the generated assets directory, the certificates are
+also verified to be issued by it.
+
+Returns a non-zero exit code when any of the certificates needs attention.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doCertificatesValidate(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().IntVar(&opts.warningWindow, "warning-window", 45, "flag certificates that expire within this number of days")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	return cmd
+}
+
+func doCertificatesValidate(out io.Writer, opts *certificatesValidateOpts) error {
+	if opts.outputFormat != "simple" && opts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	if opts.warningWindow < 0 {
+		return fmt.Errorf("--warning-window must be greater or equal to 0, got: %d", opts.warningWindow)
+	}
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if ok, errs := install.ValidateNodes(plan.GetUniqueNodes()); !ok {
+		util.PrintValidationErrors(out, errs)
+		return fmt.Errorf("error validating nodes")
+	}
+
+	pki := &install.LocalPKI{GeneratedCertsDirectory: filepath.Join(opts.generatedAssetsDir, "keys")}
+	var caCert []byte
+	exists, err := pki.CertificateAuthorityExists()
+	if err != nil {
+		return err
+	}
+	if exists {
+		ca, err := pki.GetClusterCA()
+		if err != nil {
+			return err
+		}
+		caCert = ca.Cert
+	}
+
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	window := time.Duration(opts.warningWindow) * 24 * time.Hour
+	certs, err := install.ValidateDeployedCertificates(*plan, caCert, window, time.Now(), sshClient)
+	if err != nil {
+		return err
+	}
+
+	if opts.outputFormat == "json" {
+		b, err := json.MarshalIndent(certs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling certificates: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		if caCert == nil {
+			util.PrettyPrintWarn(out, "Cluster CA not found in %q, the issuer of the certificates is not verified", opts.generatedAssetsDir)
+		}
+		if err := printDeployedCertificates(out, certs); err != nil {
+			return err
+		}
+	}
+	for _, c := range certs {
+		if c.NeedsAttention() {
+			return errors.New("some of the certificates deployed on the cluster need attention")
+		}
+	}
+	return nil
+}
+
+func printDeployedCertificates(out io.Writer, certs []install.DeployedCertificate) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "Node\tCertificate\tPath\tIssuer\tExpires\tStatus\n")
+	for _, c := range certs {
+		expires := ""
+		if c.Expires != nil {
+			expires = c.Expires.Format("2006-01-02 15:04 MST")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", c.Node, c.Description, c.Path, c.Issuer, expires, strings.ToUpper(c.State))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, c := range certs {
+		if len(c.Problems) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s %s:\n", c.Node, c.Path)
+		for _, p := range c.Problems {
+			fmt.Fprintf(out, "- %s\n", p)
+		}
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"io"
 
+	"github.com/apprenda/kismatic/pkg/junit"
+	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/pflag"
 )
 
@@ -10,6 +13,29 @@ func addPlanFileFlag(flagSet *pflag.FlagSet, p *string) {
 	flagSet.StringVarP(p, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
 }
 
+func addReportFlag(flagSet *pflag.FlagSet, p *string) {
+	flagSet.StringVar(p, "report", "", "write a report of the results in the form junit=<file>")
+}
+
+// parseReportOption returns the report file set in the --report option,
+// or an empty string if the option was not set.
+func parseReportOption(opt string) (string, error) {
+	if opt == "" {
+		return "", nil
+	}
+	return junit.ParseReportOption(opt)
+}
+
+// writeReport writes the report to the file, and prints the outcome.
+// It is meant to be deferred, so that the report is written even when the command fails.
+func writeReport(out io.Writer, report *junit.Report, file string) {
+	if err := report.WriteFile(file); err != nil {
+		util.PrettyPrintErr(out, "Writing JUnit report: %v", err)
+		return
+	}
+	util.PrettyPrintOk(out, "Wrote JUnit report to %q", file)
+}
+
 type planFileNotFoundErr struct {
 	filename string
 }
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type controlPlaneOpts struct {
+	GeneratedAssetsDirectory string
+	OutputFormat             string
+	Verbose                  bool
+	SkipPreFlight            bool
+	IgnoreSafetyChecks       bool
+}
+
+// NewCmdAddMaster returns the command for adding masters to the cluster
+func NewCmdAddMaster(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &controlPlaneOpts{}
+	cmd := &cobra.Command{
+		Use:   "add-master MASTER_NAME MASTER_IP [MASTER_INTERNAL_IP]",
+		Short: "add a Master node to an existing Kubernetes cluster",
+		Long: `Add a Master node to an existing Kubernetes cluster.
+
+The certificates of the new node are generated, the API server certificates of the
+existing master nodes are regenerated if their subject alternate names changed, and the
+control plane components are deployed on the new node. The API servers of the existing
+master nodes are restarted one at a time, and the control plane is validated.
+
+The new node must be added to the load balancer of the master nodes separately.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 || len(args) > 3 {
+				return cmd.Usage()
+			}
+			newMaster := install.Node{
+				Host: args[0],
+				IP:   args[1],
+			}
+			if len(args) == 3 {
+				newMaster.InternalIP = args[2]
+			}
+			return doAddMaster(out, installOpts.planFilename, opts, newMaster)
+		},
+	}
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.SkipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	return cmd
+}
+
+// NewCmdRemoveMaster returns the command for removing masters from the cluster
+func NewCmdRemoveMaster(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &controlPlaneOpts{}
+	cmd := &cobra.Command{
+		Use:   "remove-master MASTER_NAME",
+		Short: "remove a Master node from an existing Kubernetes cluster",
+		Long: `Remove a Master node from an existing Kubernetes cluster.
+
+The node is drained and deleted from Kubernetes, the control plane components running
+on it are stopped and cleaned up, and it is removed from the hosts files of the other
+nodes and the plan file. The API servers of the remaining master nodes are restarted
+one at a time, and the control plane is validated.
+
+The node must be removed from the load balancer of the master nodes separately.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doRemoveMaster(out, installOpts.planFilename, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.IgnoreSafetyChecks, "ignore-safety-checks", false, "remove the node even if the safety checks fail")
+	return cmd
+}
+
+func readControlPlanePlan(out io.Writer, planFile string, opts *controlPlaneOpts) (*install.FilePlanner, *install.Plan, install.Executor, error) {
+	planner := &install.FilePlanner{File: planFile}
+	if !planner.PlanExists() {
+		return nil, nil, nil, planFileNotFoundErr{filename: planFile}
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+		PlanFile:                 planFile,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return nil, nil, nil, errors.New("the plan file failed validation")
+	}
+	return planner, plan, executor, nil
+}
+
+func doAddMaster(out io.Writer, planFile string, opts *controlPlaneOpts, newMaster install.Node) error {
+	planner, plan, executor, err := readControlPlanePlan(out, planFile, opts)
+	if err != nil {
+		return err
+	}
+	if _, errs := install.ValidateNode(&newMaster); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("information provided about the new master node is invalid")
+	}
+	masterSSHCon := &install.SSHConnection{
+		SSHConfig: &plan.Cluster.SSH,
+		Node:      &newMaster,
+	}
+	if _, errs := install.ValidateSSHConnection(masterSSHCon, "New master node"); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("could not establish SSH connection to the new node")
+	}
+	for _, n := range plan.GetUniqueNodes() {
+		if n.Host == newMaster.Host || n.IP == newMaster.IP {
+			return fmt.Errorf("according to the plan file, the host name or IP of the new node is already being used by node %q", n.Host)
+		}
+	}
+	if !opts.SkipPreFlight {
+		util.PrintHeader(out, "Running Pre-Flight Checks On New Master", '=')
+		if err = executor.RunNewMasterPreFlightCheck(*plan, newMaster); err != nil {
+			return err
+		}
+	}
+	updatedPlan, err := executor.AddMaster(plan, newMaster)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file to include new master node: %v", err)
+	}
+	util.PrintHeader(out, "Validating Control Plane", '=')
+	if err := executor.ValidateControlPlane(*updatedPlan); err != nil {
+		return fmt.Errorf("error validating control plane: %v", err)
+	}
+	util.PrintColor(out, util.Green, "\nThe master node was added successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+func doRemoveMaster(out io.Writer, planFile string, opts *controlPlaneOpts, host string) error {
+	planner, plan, executor, err := readControlPlanePlan(out, planFile, opts)
+	if err != nil {
+		return err
+	}
+	var master *install.Node
+	for i, n := range plan.Master.Nodes {
+		if n.Host == host {
+			master = &plan.Master.Nodes[i]
+		}
+	}
+	if master == nil {
+		return fmt.Errorf("according to the plan file, %q is not a master node", host)
+	}
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("error connecting to cluster nodes")
+	}
+
+	util.PrintHeader(out, "Validate Master Removal", '=')
+	if err := checkNodeRemovalSafety(out, *plan, *master, opts.IgnoreSafetyChecks); err != nil {
+		return err
+	}
+
+	updatedPlan, err := executor.RemoveMaster(plan, *master)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file to remove master node: %v", err)
+	}
+	util.PrintHeader(out, "Validating Control Plane", '=')
+	if err := executor.ValidateControlPlane(*updatedPlan); err != nil {
+		return fmt.Errorf("error validating control plane: %v", err)
+	}
+	util.PrintColor(out, util.Green, "\nThe master node was removed successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type driftOpts struct {
+	planFilename string
+	outputFormat string
+}
+
+// NewCmdDrift returns the drift command
+func NewCmdDrift(out io.Writer) *cobra.Command {
+	opts := &driftOpts{}
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Detect configuration drift between the cluster and the plan file",
+		Long: `Compare the nodes of the cluster against what the plan file would deploy on them.
+
+The versions of the cluster components, the options of the Kubernetes components,
+the node labels, the hosts file entries and the docker registry configuration
+are verified by connecting to each node via ssh.
+
+Returns a non-zero exit code when any of the nodes does not match the plan file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doDrift(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	return cmd
+}
+
+func doDrift(out io.Writer, opts *driftOpts) error {
+	if opts.outputFormat != "simple" && opts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if ok, errs := install.ValidateNodes(plan.GetUniqueNodes()); !ok {
+		util.PrintValidationErrors(out, errs)
+		return fmt.Errorf("error validating nodes")
+	}
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		util.PrintValidationErrors(out, errs)
+		return fmt.Errorf("error connecting to cluster nodes")
+	}
+	defaults, err := install.ReadDeploymentDefaults("ansible")
+	if err != nil {
+		return fmt.Errorf("error reading deployment defaults: %v", err)
+	}
+
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	// Use the first master node for running kubectl
+	client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	drift := install.DetectDrift(*plan, *defaults, sshClient, data.RemoteKubectl{SSHClient: client})
+
+	if opts.outputFormat == "json" {
+		b, err := json.MarshalIndent(drift, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling drift: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		if err := printDrift(out, drift); err != nil {
+			return err
+		}
+	}
+	for _, nd := range drift {
+		if nd.Drifted() {
+			return errors.New("the cluster does not match the plan file")
+		}
+	}
+	return nil
+}
+
+func printDrift(out io.Writer, drift []install.NodeDrift) error {
+	differences := 0
+	for _, nd := range drift {
+		differences += len(nd.Differences)
+		if !nd.Drifted() {
+			util.PrettyPrintOk(out, "%s matches the plan file", nd.Node)
+			continue
+		}
+		if nd.Error != "" {
+			util.PrettyPrintErr(out, "%s: %s", nd.Node, nd.Error)
+			continue
+		}
+		util.PrettyPrintErr(out, "%s has drifted from the plan file", nd.Node)
+	}
+	if differences == 0 {
+		return nil
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "Node\tComponent\tSetting\tExpected\tActual\n")
+	for _, nd := range drift {
+		for _, d := range nd.Differences {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", nd.Node, d.Component, d.Setting, d.Expected, d.Actual)
+		}
+	}
+	return w.Flush()
+}
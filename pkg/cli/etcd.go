@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type etcdBackupOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	outputFormat             string
+	verbose                  bool
+	backupDir                string
+	includeNetworking        bool
+}
+
+type etcdRestoreOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	outputFormat             string
+	verbose                  bool
+	force                    bool
+}
+
+// NewCmdEtcd returns the etcd command
+func NewCmdEtcd(in io.Reader, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "etcd",
+		Short: "manage the etcd clusters of your Kubernetes cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+	cmd.AddCommand(NewCmdEtcdBackup(out))
+	cmd.AddCommand(NewCmdEtcdRestore(in, out))
+	return cmd
+}
+
+// NewCmdEtcdBackup returns the command for backing up etcd
+func NewCmdEtcdBackup(out io.Writer) *cobra.Command {
+	opts := &etcdBackupOpts{}
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "take a backup of the etcd clusters",
+		Long: `Take a backup of the etcd clusters.
+
+A snapshot of the Kubernetes etcd cluster is taken on a healthy etcd member, and
+downloaded into a timestamped directory under the backup directory along with a
+manifest that describes the backup. The networking etcd cluster used by calico and
+contiv is also backed up when --include-networking is set, in which case the member
+must be healthy in both etcd clusters.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doEtcdBackup(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVar(&opts.backupDir, "backup-dir", "etcd-backups", "path to the directory where backups are stored")
+	cmd.Flags().BoolVar(&opts.includeNetworking, "include-networking", false, "also back up the networking etcd cluster")
+	return cmd
+}
+
+// NewCmdEtcdRestore returns the command for restoring etcd
+func NewCmdEtcdRestore(in io.Reader, out io.Writer) *cobra.Command {
+	opts := &etcdRestoreOpts{}
+	cmd := &cobra.Command{
+		Use:   "restore BACKUP_DIR",
+		Short: "restore the etcd clusters from a backup",
+		Long: `Restore the etcd clusters from a backup.
+
+The etcd clusters are rebuilt from the backup on the etcd nodes defined in the plan
+file, which do not have to be the nodes the backup was taken from. The existing etcd
+data on the nodes is moved aside, and the API servers are restarted once the data
+is restored. The networking etcd cluster is restored when it is included in the backup.
+
+WARNING all changes made to the cluster since the backup was taken will be lost.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doEtcdRestore(in, out, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "do not prompt")
+	return cmd
+}
+
+func doEtcdBackup(out io.Writer, opts *etcdBackupOpts) error {
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(out, plan, nil); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(out, plan, nil); err != nil {
+		return err
+	}
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	manifest, member, err := install.PrepareEtcdBackup(*plan, opts.includeNetworking, sshClient)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(opts.backupDir, manifest.Timestamp.Format("2006-01-02-15-04-05"))
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating backup directory: %v", err)
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFilename,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	if err = executor.BackupEtcd(*plan, *member, dir, opts.includeNetworking); err != nil {
+		return err
+	}
+	if err = install.WriteEtcdBackupManifest(dir, *manifest); err != nil {
+		return fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	util.PrintColor(out, util.Green, "\nThe etcd backup was saved to %s\n", dir)
+	fmt.Fprintln(out)
+	return nil
+}
+
+func doEtcdRestore(in io.Reader, out io.Writer, backupDir string, opts *etcdRestoreOpts) error {
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	manifest, err := install.ReadEtcdBackup(*plan, backupDir)
+	if err != nil {
+		return err
+	}
+	if !opts.force {
+		msg := fmt.Sprintf("Are you sure you want to restore the etcd backup taken at %s? All changes made since then will be lost", manifest.Timestamp.Format(time.RFC3339))
+		ans, err := util.PromptForString(in, out, msg, "N", []string{"N", "y"})
+		if err != nil {
+			return fmt.Errorf("error getting user response: %v", err)
+		}
+		if strings.ToLower(ans) != "y" {
+			return nil
+		}
+	}
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("error connecting to cluster nodes")
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFilename,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	if err = executor.RestoreEtcd(*plan, backupDir, manifest.Networking); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe etcd clusters were restored successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type etcdMembersOpts struct {
+	GeneratedAssetsDirectory string
+	OutputFormat             string
+	Verbose                  bool
+}
+
+// NewCmdAddEtcd returns the command for adding etcd nodes to the cluster
+func NewCmdAddEtcd(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &etcdMembersOpts{}
+	cmd := &cobra.Command{
+		Use:   "add-etcd ETCD_NAME ETCD_IP [ETCD_INTERNAL_IP]",
+		Short: "add an Etcd node to an existing Kubernetes cluster",
+		Long: `Add an Etcd node to an existing Kubernetes cluster.
+
+The node is added as a member of the Kubernetes and networking etcd clusters, and
+the etcd server certificates of the node are generated. The API servers are restarted
+one at a time, and the networking components are updated to use the new member.
+
+The node is not added if the etcd clusters do not have quorum.
+
+The etcd members cannot be changed when the CNI provider is contiv.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 || len(args) > 3 {
+				return cmd.Usage()
+			}
+			newEtcd := install.Node{
+				Host: args[0],
+				IP:   args[1],
+			}
+			if len(args) == 3 {
+				newEtcd.InternalIP = args[2]
+			}
+			return doChangeEtcdMembers(out, installOpts.planFilename, opts, &newEtcd, "")
+		},
+	}
+	addEtcdMembersFlags(cmd, opts)
+	return cmd
+}
+
+// NewCmdRemoveEtcd returns the command for removing etcd nodes from the cluster
+func NewCmdRemoveEtcd(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &etcdMembersOpts{}
+	cmd := &cobra.Command{
+		Use:   "remove-etcd ETCD_NAME",
+		Short: "remove an Etcd node from an existing Kubernetes cluster",
+		Long: `Remove an Etcd node from an existing Kubernetes cluster.
+
+The node is removed from the Kubernetes and networking etcd clusters, and etcd is
+stopped and its data is removed from the node if it is reachable. The API servers are
+restarted one at a time, and the networking components are updated to stop using
+the removed member.
+
+The node is not removed if the etcd clusters would be left without quorum.
+
+The etcd members cannot be changed when the CNI provider is contiv.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doChangeEtcdMembers(out, installOpts.planFilename, opts, nil, args[0])
+		},
+	}
+	addEtcdMembersFlags(cmd, opts)
+	return cmd
+}
+
+// NewCmdReplaceEtcd returns the command for replacing etcd nodes of the cluster
+func NewCmdReplaceEtcd(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &etcdMembersOpts{}
+	cmd := &cobra.Command{
+		Use:   "replace-etcd ETCD_NAME NEW_ETCD_NAME NEW_ETCD_IP [NEW_ETCD_INTERNAL_IP]",
+		Short: "replace an Etcd node of an existing Kubernetes cluster with a new node",
+		Long: `Replace an Etcd node of an existing Kubernetes cluster with a new node.
+
+The node being replaced, which is usually a failed node, is removed from the Kubernetes
+and networking etcd clusters before the new node is added to them. The node being
+replaced does not have to be reachable.
+
+The node is not replaced if the etcd clusters would be left without quorum.
+
+The etcd members cannot be changed when the CNI provider is contiv.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 || len(args) > 4 {
+				return cmd.Usage()
+			}
+			newEtcd := install.Node{
+				Host: args[1],
+				IP:   args[2],
+			}
+			if len(args) == 4 {
+				newEtcd.InternalIP = args[3]
+			}
+			return doChangeEtcdMembers(out, installOpts.planFilename, opts, &newEtcd, args[0])
+		},
+	}
+	addEtcdMembersFlags(cmd, opts)
+	return cmd
+}
+
+func addEtcdMembersFlags(cmd *cobra.Command, opts *etcdMembersOpts) {
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+}
+
+// doChangeEtcdMembers adds the new node and/or removes the node with the given host name from the etcd clusters
+func doChangeEtcdMembers(out io.Writer, planFile string, opts *etcdMembersOpts, newEtcd *install.Node, removeHost string) error {
+	cpOpts := &controlPlaneOpts{
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+	}
+	planner, plan, executor, err := readControlPlanePlan(out, planFile, cpOpts)
+	if err != nil {
+		return err
+	}
+	var remove *install.Node
+	if removeHost != "" {
+		for i, n := range plan.Etcd.Nodes {
+			if n.Host == removeHost {
+				remove = &plan.Etcd.Nodes[i]
+			}
+		}
+		if remove == nil {
+			return fmt.Errorf("according to the plan file, %q is not an etcd node", removeHost)
+		}
+	}
+	if newEtcd != nil {
+		if _, errs := install.ValidateNode(newEtcd); errs != nil {
+			util.PrintValidationErrors(out, errs)
+			return errors.New("information provided about the new etcd node is invalid")
+		}
+		sshCon := &install.SSHConnection{
+			SSHConfig: &plan.Cluster.SSH,
+			Node:      newEtcd,
+		}
+		if _, errs := install.ValidateSSHConnection(sshCon, "New etcd node"); errs != nil {
+			util.PrintValidationErrors(out, errs)
+			return errors.New("could not establish SSH connection to the new node")
+		}
+		for _, n := range plan.GetUniqueNodes() {
+			if (n.Host == newEtcd.Host) != (n.IP == newEtcd.IP) {
+				return fmt.Errorf("according to the plan file, the host name or IP of the new node is already being used by node %q", n.Host)
+			}
+		}
+	}
+
+	util.PrintHeader(out, "Validate Etcd Membership Change", '=')
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	change, err := install.PlanEtcdMembershipChange(*plan, newEtcd, remove, sshClient)
+	if err != nil {
+		util.PrettyPrintErr(out, "Etcd quorum check")
+		return err
+	}
+	util.PrettyPrintOk(out, "Etcd quorum check")
+
+	updatedPlan, err := executor.ChangeEtcdMembers(plan, *change)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file with etcd nodes: %v", err)
+	}
+	util.PrintColor(out, util.Green, "\nThe etcd members were updated successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
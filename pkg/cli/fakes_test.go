@@ -35,6 +35,50 @@ func (fe *fakeExecutor) AddWorker(p *install.Plan, newWorker install.Node) (*ins
 	return nil, nil
 }
 
+func (fe *fakeExecutor) AddNode(p *install.Plan, newNode install.Node, role string) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) RemoveWorker(p *install.Plan, worker install.Node) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) AddMaster(p *install.Plan, master install.Node) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) RemoveMaster(p *install.Plan, master install.Node) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) ChangeEtcdMembers(p *install.Plan, change install.EtcdMembershipChange) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) BackupEtcd(plan install.Plan, member install.Node, dir string, networking bool) error {
+	return nil
+}
+
+func (fe *fakeExecutor) BackupBeforeUpgrade(plan install.Plan, member install.Node, dir string, networking bool) error {
+	return nil
+}
+
+func (fe *fakeExecutor) RestoreEtcd(plan install.Plan, dir string, networking bool) error {
+	return nil
+}
+
+func (fe *fakeExecutor) DeployCertificates(plan install.Plan, opts install.DeployCertificatesOptions) error {
+	return nil
+}
+
+func (fe *fakeExecutor) Reconcile(p *install.Plan) error {
+	return nil
+}
+
+func (fe *fakeExecutor) Reset(p *install.Plan, nodes []install.Node, keepPackages bool) error {
+	return nil
+}
+
 func (fe *fakeExecutor) GenerateCertificates(*install.Plan, bool) error {
 	return nil
 }
@@ -48,6 +92,14 @@ func (fe *fakeExecutor) RunPreFlightCheck(p *install.Plan) error {
 	return nil
 }
 
+func (fe *fakeExecutor) RunNewNodePreFlightCheck(install.Plan, install.Node, string) error {
+	return nil
+}
+
+func (fe *fakeExecutor) RunNewMasterPreFlightCheck(install.Plan, install.Node) error {
+	return nil
+}
+
 func (fe *fakeExecutor) RunNewWorkerPreFlightCheck(install.Plan, install.Node) error {
 	return nil
 }
@@ -56,7 +108,7 @@ func (fe *fakeExecutor) RunUpgradePreFlightCheck(*install.Plan, install.Listable
 	return nil
 }
 
-func (fe *fakeExecutor) UpgradeNodes(install.Plan, []install.ListableNode, bool, int) error {
+func (fe *fakeExecutor) UpgradeNodes(install.Plan, [][]install.ListableNode, bool) error {
 	return nil
 }
 
@@ -72,6 +124,30 @@ func (fe *fakeExecutor) UpgradeClusterServices(install.Plan) error {
 	return nil
 }
 
+func (fe *fakeExecutor) RunUpgradeWaveHooks(install.Plan, install.HookWave) error {
+	return nil
+}
+
+func (fe *fakeExecutor) RollbackNode(install.Plan, install.Node) error {
+	return nil
+}
+
+func (fe *fakeExecutor) RemoveUpgradeBackup(install.Plan, install.Node) error {
+	return nil
+}
+
+func (fe *fakeExecutor) PrePullUpgrade(install.Plan, []install.ListableNode) ([]install.NodePrePullResult, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) DrainNode(install.Plan, install.Node) error {
+	return nil
+}
+
+func (fe *fakeExecutor) UncordonNode(install.Plan, install.Node) error {
+	return nil
+}
+
 func (fe *fakeExecutor) RunSmokeTest(p *install.Plan) error {
 	return nil
 }
@@ -25,6 +25,12 @@ func NewCmdInfo(out io.Writer) *cobra.Command {
 		Short: "Display info about nodes in the cluster",
 		Long: `will list the nodes that make up the cluster, along with their current versions & roles.
 
+The versions of Kubernetes, Docker, etcd and the CNI provider deployed on each node are listed,
+along with when the node was last configured, the run that configured it, and the SHA-256 hash of the
+plan file used for that run, which can be compared with "sha256sum kismatic-cluster.yaml". These are
+not available for nodes that were last configured by an older version of Kismatic, or whose node
+manifest cannot be read.
+
 This will be retrieved by connecting to each node via ssh`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return list(out, opts)
@@ -71,6 +77,7 @@ func list(out io.Writer, opts *infoOpts) error {
 		fmt.Fprintln(out, string(b))
 		return nil
 	}
+	printVersionWarnings(out, lv)
 
 	fmt.Fprintf(out, "Cluster Version: ")
 	if lv.IsTransitioning {
@@ -81,9 +88,39 @@ func list(out io.Writer, opts *infoOpts) error {
 	fmt.Fprintln(out)
 	fmt.Fprintf(out, "Nodes:\n")
 	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
-	fmt.Fprint(w, "Name\tIP\tRoles\tKismatic Version\n")
+	fmt.Fprint(w, "Name\tIP\tRoles\tKismatic Version\tKubernetes\tDocker\tEtcd\tCNI\tConfigured At\tRun\tPlan\n")
 	for _, listNode := range lv.Nodes {
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", listNode.Node.Host, listNode.Node.IP, strings.Join(listNode.Roles, ","), listNode.Version)
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%s\n", listNode.Node.Host, listNode.Node.IP, strings.Join(listNode.Roles, ","), listNode.Version, strings.Join(manifestColumns(listNode.Manifest), "\t"))
 	}
 	return w.Flush()
 }
+
+// printVersionWarnings prints the problems found while listing the cluster versions
+func printVersionWarnings(out io.Writer, cv install.ClusterVersion) {
+	for _, w := range cv.Warnings {
+		util.PrettyPrintWarn(out, "%s", w)
+	}
+}
+
+// manifestColumns returns the columns of the node manifest that are displayed,
+// or placeholders if the node does not have a manifest
+func manifestColumns(m *install.NodeManifest) []string {
+	if m == nil {
+		return []string{"-", "-", "-", "-", "-", "-", "-"}
+	}
+	cni := m.Components.CNIProvider
+	if cni != "" && m.Components.CNI != "" {
+		cni = fmt.Sprintf("%s %s", cni, m.Components.CNI)
+	}
+	planHash := m.PlanHash
+	if len(planHash) > 12 {
+		planHash = planHash[:12]
+	}
+	columns := []string{m.Components.Kubernetes, m.Components.Docker, m.Components.Etcd, cni, m.ConfiguredAt, m.RunID, planHash}
+	for i, c := range columns {
+		if c == "" {
+			columns[i] = "-"
+		}
+	}
+	return columns
+}
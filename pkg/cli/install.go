@@ -27,6 +27,13 @@ func NewCmdInstall(in io.Reader, out io.Writer) *cobra.Command {
 	cmd.AddCommand(NewCmdValidate(out, opts))
 	cmd.AddCommand(NewCmdApply(out, opts))
 	cmd.AddCommand(NewCmdAddWorker(out, opts))
+	cmd.AddCommand(NewCmdAddNode(out, opts))
+	cmd.AddCommand(NewCmdRemoveWorker(out, opts))
+	cmd.AddCommand(NewCmdAddMaster(out, opts))
+	cmd.AddCommand(NewCmdRemoveMaster(out, opts))
+	cmd.AddCommand(NewCmdAddEtcd(out, opts))
+	cmd.AddCommand(NewCmdRemoveEtcd(out, opts))
+	cmd.AddCommand(NewCmdReplaceEtcd(out, opts))
 	cmd.AddCommand(NewCmdStep(out, opts))
 
 	// PersistentFlags
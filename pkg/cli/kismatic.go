@@ -27,9 +27,14 @@ more documentation is available at https://github.com/apprenda/kismatic`,
 	cmd.AddCommand(NewCmdDashboard(out))
 	cmd.AddCommand(NewCmdSSH(out))
 	cmd.AddCommand(NewCmdInfo(out))
+	cmd.AddCommand(NewCmdStatus(out))
+	cmd.AddCommand(NewCmdDrift(out))
+	cmd.AddCommand(NewCmdReset(in, out))
+	cmd.AddCommand(NewCmdEtcd(in, out))
+	cmd.AddCommand(NewCmdNode(out))
 	cmd.AddCommand(NewCmdUpgrade(in, out))
 	cmd.AddCommand(NewCmdDiagnostic(out))
-	cmd.AddCommand(NewCmdCertificates(out))
+	cmd.AddCommand(NewCmdCertificates(in, out))
 	cmd.AddCommand(NewCmdSeedRegistry(out, stderr))
 
 	return cmd, nil
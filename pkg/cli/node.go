@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type nodeOpts struct {
+	planFile           string
+	generatedAssetsDir string
+	verbose            bool
+	outputFormat       string
+}
+
+type nodeMaintenanceOpts struct {
+	command            string
+	reboot             bool
+	ignoreSafetyChecks bool
+	readyTimeout       time.Duration
+}
+
+// NewCmdNode returns the node command
+func NewCmdNode(out io.Writer) *cobra.Command {
+	opts := &nodeOpts{}
+	cmd := &cobra.Command{
+		Use:   "node",
+		Short: "manage the nodes of your Kubernetes cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.PersistentFlags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.PersistentFlags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFile)
+
+	cmd.AddCommand(NewCmdNodeMaintenance(out, opts))
+	cmd.AddCommand(NewCmdNodeReboot(out, opts))
+	return cmd
+}
+
+// NewCmdNodeMaintenance returns the command for performing maintenance on a node
+func NewCmdNodeMaintenance(out io.Writer, opts *nodeOpts) *cobra.Command {
+	maintenanceOpts := &nodeMaintenanceOpts{}
+	cmd := &cobra.Command{
+		Use:   "maintenance NODE_NAME",
+		Short: "Drain a node, perform maintenance on it, and return it to service",
+		Long: `Drain a node, perform maintenance on it, and return it to service.
+
+The same safety checks that are performed before an online upgrade are used to
+determine whether the node can be drained without data or availability loss.
+
+The node is cordoned and drained of workloads. The command given with --command is
+then run on the node, and the node is rebooted when --reboot is set. Once the node is
+Ready, it is uncordoned. If any of the steps fails, the node is left cordoned.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doNodeMaintenance(out, opts, maintenanceOpts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&maintenanceOpts.command, "command", "", "the command to run on the node while it is drained")
+	cmd.Flags().BoolVar(&maintenanceOpts.reboot, "reboot", false, "reboot the node while it is drained")
+	cmd.Flags().BoolVar(&maintenanceOpts.ignoreSafetyChecks, "ignore-safety-checks", false, "drain the node even if the safety checks fail")
+	cmd.Flags().DurationVar(&maintenanceOpts.readyTimeout, "ready-timeout", 10*time.Minute, "the length of time to wait for the node to reboot and be Ready")
+	return cmd
+}
+
+func doNodeMaintenance(out io.Writer, opts *nodeOpts, maintenanceOpts *nodeMaintenanceOpts, host string) error {
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFile}
+	}
+	executorOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFile,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(out, plan, nil); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(out, plan, nil); err != nil {
+		return err
+	}
+	node, err := findNode(*plan, host)
+	if err != nil {
+		return err
+	}
+	roles := plan.GetRolesForIP(node.IP)
+	// etcd-only nodes are not registered with Kubernetes
+	kubernetesNode := !(len(roles) == 1 && roles[0] == "etcd")
+
+	util.PrintHeader(out, "Validate Node Maintenance", '=')
+	if err = checkNodeSafety(out, *plan, node, maintenanceOpts.ignoreSafetyChecks, "perform maintenance on the node", "maintenance"); err != nil {
+		return err
+	}
+
+	if kubernetesNode {
+		if err = executor.DrainNode(*plan, node); err != nil {
+			return fmt.Errorf("error draining node %q: %v", host, err)
+		}
+	}
+	if err = maintainNode(out, *plan, node, *maintenanceOpts); err != nil {
+		if kubernetesNode {
+			util.PrettyPrintWarn(out, "The node %q was left cordoned", host)
+		}
+		return err
+	}
+	if kubernetesNode {
+		maintained := []install.ListableNode{{Node: node, Roles: roles}}
+		if err = waitForNodesReady(out, *plan, maintained, maintenanceOpts.readyTimeout); err != nil {
+			util.PrettyPrintWarn(out, "The node %q was left cordoned", host)
+			return err
+		}
+		if err = executor.UncordonNode(*plan, node); err != nil {
+			return fmt.Errorf("error uncordoning node %q: %v", host, err)
+		}
+	}
+	util.PrintColor(out, util.Green, "\nThe maintenance of the node was completed successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+// maintainNode runs the maintenance command on the node, and reboots it if requested
+func maintainNode(out io.Writer, plan install.Plan, node install.Node, opts nodeMaintenanceOpts) error {
+	if opts.command == "" && !opts.reboot {
+		return nil
+	}
+	util.PrintHeader(out, fmt.Sprintf("Maintain Node: %s", node.Host), '=')
+	client, err := plan.GetSSHClient(node.Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	if opts.command != "" {
+		output, err := client.Output(false, opts.command)
+		if err != nil {
+			util.PrettyPrintErr(out, "Running %q", opts.command)
+			fmt.Fprintln(out, strings.TrimSpace(output))
+			return fmt.Errorf("error running %q on node %q: %v", opts.command, node.Host, err)
+		}
+		util.PrettyPrintOk(out, "Running %q", opts.command)
+		if output = strings.TrimSpace(output); output != "" {
+			fmt.Fprintln(out, output)
+		}
+	}
+	if opts.reboot {
+		if err := install.RebootNode(client, opts.readyTimeout, 5*time.Second); err != nil {
+			util.PrettyPrintErr(out, "Rebooting node")
+			return fmt.Errorf("error rebooting node %q: %v", node.Host, err)
+		}
+		util.PrettyPrintOk(out, "Rebooting node")
+	}
+	return nil
+}
+
+// waitForNodesReady waits for the nodes to be Ready, using a master node other than
+// the nodes themselves to run kubectl when possible
+func waitForNodesReady(out io.Writer, plan install.Plan, nodes []install.ListableNode, timeout time.Duration) error {
+	master := plan.Master.Nodes[0]
+	for _, m := range plan.Master.Nodes {
+		if !containsNode(nodes, m) {
+			master = m
+			break
+		}
+	}
+	client, err := plan.GetSSHClient(master.Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	kubeClient := data.RemoteKubectl{SSHClient: client}
+	if err := install.WaitForNodesReady(nodes, kubeClient, timeout, 10*time.Second); err != nil {
+		util.PrettyPrintErr(out, "Waiting for the nodes to be ready")
+		return err
+	}
+	util.PrettyPrintOk(out, "Waiting for the nodes to be ready")
+	return nil
+}
+
+func containsNode(nodes []install.ListableNode, node install.Node) bool {
+	for _, n := range nodes {
+		if n.Node.Equal(node) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type nodeRebootOpts struct {
+	maxParallelWorkers int
+	ignoreSafetyChecks bool
+	readyTimeout       time.Duration
+}
+
+// NewCmdNodeReboot returns the command for rebooting the nodes of the cluster
+func NewCmdNodeReboot(out io.Writer, opts *nodeOpts) *cobra.Command {
+	rebootOpts := &nodeRebootOpts{}
+	cmd := &cobra.Command{
+		Use:   "reboot [NODE_NAME...]",
+		Short: "Reboot the nodes of the cluster, one node at a time",
+		Long: `Reboot the nodes of the cluster, one node at a time, without taking the cluster down.
+
+All the nodes in the plan file are rebooted, unless a list of nodes is given.
+The nodes are rebooted in the same order as they are upgraded:
+
+1. Etcd nodes
+2. Master nodes
+3. Worker nodes (regardless of specialization), in batches of up to --max-parallel-workers nodes
+
+Worker nodes are only rebooted in parallel if draining them at the same time does not take down
+all the replicas of a workload, nor violates a PodDisruptionBudget.
+
+Before a node is rebooted, all the etcd members must be healthy, so that the etcd cluster keeps
+its quorum, and the same safety checks that are performed before an online upgrade must pass.
+Kubernetes nodes are drained before they are rebooted. Once a node is reachable over SSH
+and Ready, it is uncordoned, and the etcd cluster and the control plane are validated before moving
+on to the next node. The reboot stops on the first failure.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doNodeReboot(out, opts, rebootOpts, args)
+		},
+	}
+	cmd.Flags().IntVar(&rebootOpts.maxParallelWorkers, "max-parallel-workers", 1, "the maximum number of worker nodes to be rebooted in parallel")
+	cmd.Flags().BoolVar(&rebootOpts.ignoreSafetyChecks, "ignore-safety-checks", false, "reboot the nodes even if the safety checks fail")
+	cmd.Flags().DurationVar(&rebootOpts.readyTimeout, "ready-timeout", 10*time.Minute, "the length of time to wait for each node to reboot and be Ready")
+	return cmd
+}
+
+func doNodeReboot(out io.Writer, opts *nodeOpts, rebootOpts *nodeRebootOpts, hosts []string) error {
+	if rebootOpts.maxParallelWorkers < 1 {
+		return fmt.Errorf("max-parallel-workers must be greater or equal to 1, got: %d", rebootOpts.maxParallelWorkers)
+	}
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFile}
+	}
+	executorOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFile,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(out, plan, nil); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(out, plan, nil); err != nil {
+		return err
+	}
+
+	var nodes []install.ListableNode
+	if len(hosts) == 0 {
+		for _, n := range plan.GetUniqueNodes() {
+			nodes = append(nodes, install.ListableNode{Node: n, Roles: plan.GetRolesForIP(n.IP)})
+		}
+	}
+	for _, h := range hosts {
+		n, err := findNode(*plan, h)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, install.ListableNode{Node: n, Roles: plan.GetRolesForIP(n.IP)})
+	}
+	sshClient := func(n install.Node) (ssh.Client, error) {
+		return plan.GetSSHClient(n.Host)
+	}
+
+	// Start from a healthy cluster
+	util.PrintHeader(out, "Validate Cluster Health", '=')
+	if err = validateRebootedCluster(out, *plan, sshClient, executor, rebootOpts.readyTimeout); err != nil {
+		return err
+	}
+
+	// Workers are only rebooted in parallel if their workloads can be disrupted at the same time
+	batches := install.UpgradeBatches(nodes, rebootOpts.maxParallelWorkers)
+	if rebootOpts.maxParallelWorkers > 1 {
+		// Use the first master node for running kubectl
+		client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+		if err != nil {
+			return fmt.Errorf("error getting SSH client: %v", err)
+		}
+		disruptions, err := install.DetectWorkloadDisruptions(nodes, data.RemoteKubectl{SSHClient: client})
+		if err != nil {
+			return fmt.Errorf("error determining the worker nodes that can be rebooted in parallel: %v", err)
+		}
+		batches = install.ReplicaAwareUpgradeBatches(nodes, rebootOpts.maxParallelWorkers, *disruptions)
+	}
+	for i, batch := range batches {
+		if err = rebootNodes(out, *plan, batch, sshClient, executor, *rebootOpts); err != nil {
+			return haltedRebootErr(batches[i+1:], err)
+		}
+	}
+	util.PrintColor(out, util.Green, "\nThe nodes were rebooted successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+// rebootNodes checks that the nodes of the batch can be safely taken down, drains the
+// Kubernetes nodes of the batch, reboots all the nodes of the batch in parallel, and
+// returns them to service once they are Ready
+func rebootNodes(out io.Writer, plan install.Plan, batch []install.ListableNode, sshClient func(install.Node) (ssh.Client, error), executor install.Executor, opts nodeRebootOpts) error {
+	timeout := opts.readyTimeout
+	util.PrintHeader(out, "Validate Node Safety", '=')
+	for _, n := range batch {
+		if err := checkNodeSafety(out, plan, n.Node, opts.ignoreSafetyChecks, "reboot the node", "reboot"); err != nil {
+			return err
+		}
+	}
+
+	var kubernetesNodes []install.ListableNode
+	for _, n := range batch {
+		if !(len(n.Roles) == 1 && n.Roles[0] == "etcd") {
+			kubernetesNodes = append(kubernetesNodes, n)
+		}
+	}
+	for _, n := range kubernetesNodes {
+		if err := executor.DrainNode(plan, n.Node); err != nil {
+			return fmt.Errorf("error draining node %q: %v", n.Node.Host, err)
+		}
+	}
+
+	if len(batch) == 1 {
+		util.PrintHeader(out, fmt.Sprintf("Reboot Node: %s %s", batch[0].Node.Host, batch[0].Roles), '=')
+	} else {
+		util.PrintHeader(out, "Reboot Nodes:", '=')
+		nodeRoles := map[string][]string{}
+		for _, n := range batch {
+			nodeRoles[n.Node.Host] = n.Roles
+		}
+		util.PrintTable(out, nodeRoles)
+	}
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i, n := range batch {
+		wg.Add(1)
+		go func(i int, n install.Node) {
+			defer wg.Done()
+			client, err := sshClient(n)
+			if err != nil {
+				errs[i] = fmt.Errorf("error getting SSH client: %v", err)
+				return
+			}
+			errs[i] = install.RebootNode(client, timeout, 5*time.Second)
+		}(i, n.Node)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			util.PrettyPrintErr(out, "Rebooting node %q", batch[i].Node.Host)
+			return fmt.Errorf("error rebooting node %q: %v", batch[i].Node.Host, err)
+		}
+		util.PrettyPrintOk(out, "Rebooting node %q", batch[i].Node.Host)
+	}
+
+	if len(kubernetesNodes) > 0 {
+		if err := waitForNodesReady(out, plan, kubernetesNodes, timeout); err != nil {
+			return err
+		}
+	}
+	for _, n := range kubernetesNodes {
+		if err := executor.UncordonNode(plan, n.Node); err != nil {
+			return fmt.Errorf("error uncordoning node %q: %v", n.Node.Host, err)
+		}
+	}
+	return validateRebootedCluster(out, plan, sshClient, executor, timeout)
+}
+
+// validateRebootedCluster ensures that the etcd cluster has its quorum, and that the
+// control plane is running, before the next node is rebooted
+func validateRebootedCluster(out io.Writer, plan install.Plan, sshClient func(install.Node) (ssh.Client, error), executor install.Executor, timeout time.Duration) error {
+	if err := install.WaitForEtcdHealthy(plan, sshClient, timeout, 10*time.Second); err != nil {
+		util.PrettyPrintErr(out, "Waiting for the etcd members to be healthy")
+		return err
+	}
+	util.PrettyPrintOk(out, "Waiting for the etcd members to be healthy")
+	if err := executor.ValidateControlPlane(plan); err != nil {
+		return fmt.Errorf("error validating the control plane: %v", err)
+	}
+	return nil
+}
+
+// haltedRebootErr reports the nodes of the remaining batches, that were not rebooted
+func haltedRebootErr(remaining [][]install.ListableNode, err error) error {
+	var pending []string
+	for _, b := range remaining {
+		for _, n := range b {
+			pending = append(pending, n.Node.Host)
+		}
+	}
+	if len(pending) == 0 {
+		return fmt.Errorf("Halted the reboot: %v", err)
+	}
+	return fmt.Errorf("Halted the reboot: %v. The following nodes were not rebooted: %s", err, strings.Join(pending, ", "))
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type removeWorkerOpts struct {
+	GeneratedAssetsDirectory string
+	OutputFormat             string
+	Verbose                  bool
+	IgnoreSafetyChecks       bool
+}
+
+// NewCmdRemoveWorker returns the command for removing workers from the cluster
+func NewCmdRemoveWorker(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &removeWorkerOpts{}
+	cmd := &cobra.Command{
+		Use:   "remove-worker WORKER_NAME",
+		Short: "remove a Worker node from an existing Kubernetes cluster",
+		Long: `Remove a Worker node from an existing Kubernetes cluster.
+
+The node is drained and deleted from Kubernetes, the cluster services running on it
+are stopped and cleaned up, and it is removed from the storage volume allow lists,
+the hosts files of the other nodes and the plan file.
+
+The same safety checks that are performed before an online upgrade are used to
+determine whether the node can be removed without data or availability loss.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doRemoveWorker(out, installOpts.planFilename, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.IgnoreSafetyChecks, "ignore-safety-checks", false, "remove the node even if the safety checks fail")
+	return cmd
+}
+
+func doRemoveWorker(out io.Writer, planFile string, opts *removeWorkerOpts, host string) error {
+	planner := &install.FilePlanner{File: planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: planFile}
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+		PlanFile:                 planFile,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	worker, err := findWorker(*plan, host)
+	if err != nil {
+		return err
+	}
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("error connecting to cluster nodes")
+	}
+
+	util.PrintHeader(out, "Validate Worker Removal", '=')
+	if err := checkNodeRemovalSafety(out, *plan, worker, opts.IgnoreSafetyChecks); err != nil {
+		return err
+	}
+
+	updatedPlan, err := executor.RemoveWorker(plan, worker)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file to remove worker node: %v", err)
+	}
+	util.PrintColor(out, util.Green, "\nThe worker node was removed successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+// returns the worker node in the plan that has the given host name
+func findWorker(plan install.Plan, host string) (install.Node, error) {
+	for _, n := range plan.Worker.Nodes {
+		if n.Host == host {
+			return n, nil
+		}
+	}
+	return install.Node{}, fmt.Errorf("according to the plan file, %q is not a worker node", host)
+}
+
+// checkNodeRemovalSafety runs the upgrade safety checks against the node, as
+// the same conditions could result in data or availability loss when it is removed
+func checkNodeRemovalSafety(out io.Writer, plan install.Plan, node install.Node, ignoreSafetyChecks bool) error {
+	return checkNodeSafety(out, plan, node, ignoreSafetyChecks, "remove the node", "removal")
+}
+
+// checkNodeSafety runs the upgrade safety checks against the node before it is drained
+// for the given operation
+func checkNodeSafety(out io.Writer, plan install.Plan, node install.Node, ignoreSafetyChecks bool, operation, operationNoun string) error {
+	// Use the first master node for running kubectl
+	client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	kubeClient := data.RemoteKubectl{SSHClient: client}
+	glusterClient, err := getGlusterClient(plan)
+	if err != nil {
+		return err
+	}
+	util.PrettyPrint(out, "%s %v", node.Host, plan.GetRolesForIP(node.IP))
+	errs := install.DetectNodeUpgradeSafety(plan, node, kubeClient, glusterClient)
+	if len(errs) == 0 {
+		util.PrintOkln(out)
+		return nil
+	}
+	if ignoreSafetyChecks {
+		util.PrintWarn(out)
+	} else {
+		util.PrintError(out)
+	}
+	fmt.Fprintln(out)
+	for _, err := range errs {
+		fmt.Fprintln(out, "-", err.Error())
+	}
+	if !ignoreSafetyChecks {
+		return fmt.Errorf("Unable to %s due to the unsafe conditions detected.", operation)
+	}
+	util.PrettyPrintWarn(out, "\nIgnoring safety checks and continuing with the %s", operationNoun)
+	return nil
+}
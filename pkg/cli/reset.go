@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type resetOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	outputFormat             string
+	verbose                  bool
+	nodes                    []string
+	roles                    []string
+	keepPackages             bool
+	force                    bool
+}
+
+// NewCmdReset returns the reset command
+func NewCmdReset(in io.Reader, out io.Writer) *cobra.Command {
+	opts := &resetOpts{}
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Reset the nodes of the cluster so that they can be reinstalled",
+		Long: `Reset the nodes of the cluster so that they can be reinstalled.
+
+The cluster services, containers, CNI state, iptables rules, etcd data, certificates
+and version file installed by Kismatic are removed from the nodes, along with the
+packages installed by Kismatic unless --keep-packages is set.
+
+All the nodes of the cluster are reset, unless nodes or roles are provided. Nodes with
+the given roles are reset entirely, including the services of their other roles.
+
+WARNING all cluster data on the nodes will be lost.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doReset(in, out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringSliceVar(&opts.nodes, "nodes", []string{}, "comma-separated list of node names to reset")
+	cmd.Flags().StringSliceVar(&opts.roles, "roles", []string{}, "comma-separated list of roles whose nodes are reset (options \"etcd\"|\"master\"|\"worker\"|\"ingress\"|\"storage\")")
+	cmd.Flags().BoolVar(&opts.keepPackages, "keep-packages", false, "do not remove the packages installed by Kismatic")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "do not prompt")
+	return cmd
+}
+
+func doReset(in io.Reader, out io.Writer, opts *resetOpts) error {
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	nodes, err := selectResetNodes(*plan, opts.nodes, opts.roles)
+	if err != nil {
+		return err
+	}
+	target := "all the nodes of the cluster"
+	if len(nodes) > 0 {
+		var hosts []string
+		for _, n := range nodes {
+			hosts = append(hosts, n.Host)
+		}
+		target = strings.Join(hosts, ", ")
+	}
+	if !opts.force {
+		ans, err := util.PromptForString(in, out, fmt.Sprintf("Are you sure you want to reset %s? All cluster data will be lost", target), "N", []string{"N", "y"})
+		if err != nil {
+			return fmt.Errorf("error getting user response: %v", err)
+		}
+		if strings.ToLower(ans) != "y" {
+			return nil
+		}
+	}
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("error connecting to cluster nodes")
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFilename,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	if err := executor.Reset(plan, nodes, opts.keepPackages); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe nodes were reset successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+// selectResetNodes returns the nodes in the plan that have the given names or roles.
+// No nodes are returned when neither are given, as the whole cluster is reset.
+func selectResetNodes(plan install.Plan, hosts []string, roles []string) ([]install.Node, error) {
+	selected := make(map[string]bool)
+	for _, h := range hosts {
+		found := false
+		for _, n := range plan.GetUniqueNodes() {
+			if n.Host == h {
+				selected[n.Host] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("according to the plan file, %q is not a node of the cluster", h)
+		}
+	}
+	for _, r := range roles {
+		if !util.Contains(r, []string{"etcd", "master", "worker", "ingress", "storage"}) {
+			return nil, fmt.Errorf("invalid role %q", r)
+		}
+		for _, n := range plan.GetNodesWithRole(r) {
+			selected[n.Host] = true
+		}
+	}
+	var nodes []install.Node
+	for _, n := range plan.GetUniqueNodes() {
+		if selected[n.Host] {
+			nodes = append(nodes, n)
+		}
+	}
+	// Never fall back to resetting the whole cluster when the selection is empty
+	if len(roles) > 0 && len(nodes) == 0 {
+		return nil, fmt.Errorf("according to the plan file, there are no nodes with the roles %v", roles)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestSelectResetNodes(t *testing.T) {
+	plan := install.Plan{
+		Etcd: install.NodeGroup{
+			Nodes: []install.Node{{Host: "etcd01", IP: "10.0.0.1"}},
+		},
+		Master: install.MasterNodeGroup{
+			Nodes: []install.Node{{Host: "master01", IP: "10.0.0.2"}},
+		},
+		Worker: install.NodeGroup{
+			Nodes: []install.Node{{Host: "worker01", IP: "10.0.0.3"}, {Host: "worker02", IP: "10.0.0.4"}},
+		},
+	}
+	tests := []struct {
+		hosts     []string
+		roles     []string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			expected: nil,
+		},
+		{
+			hosts:    []string{"worker02"},
+			expected: []string{"worker02"},
+		},
+		{
+			hosts:    []string{"master01"},
+			roles:    []string{"worker"},
+			expected: []string{"master01", "worker01", "worker02"},
+		},
+		{
+			roles:    []string{"etcd", "etcd"},
+			expected: []string{"etcd01"},
+		},
+		{
+			hosts:     []string{"foo"},
+			expectErr: true,
+		},
+		{
+			roles:     []string{"foo"},
+			expectErr: true,
+		},
+		{
+			roles:     []string{"ingress"},
+			expectErr: true,
+		},
+	}
+	for i, test := range tests {
+		nodes, err := selectResetNodes(plan, test.hosts, test.roles)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test %d: expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		var hosts []string
+		for _, n := range nodes {
+			hosts = append(hosts, n.Host)
+		}
+		if !reflect.DeepEqual(hosts, test.expected) {
+			t.Errorf("test %d: expected %v, got %v", i, test.expected, hosts)
+		}
+	}
+}
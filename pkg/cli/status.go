@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type statusOpts struct {
+	planFilename string
+	outputFormat string
+}
+
+// NewCmdStatus returns the status command
+func NewCmdStatus(out io.Writer) *cobra.Command {
+	opts := &statusOpts{}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check the health of the cluster",
+		Long: `Check the health of the cluster components on each node, according to the node's roles.
+
+The services and containers that make up the cluster, the health of etcd and the API server,
+the Ready condition of the Kubernetes nodes and the readiness of the add-ons are verified
+by connecting to each node via ssh.
+
+Returns a non-zero exit code when any of the components is not healthy.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return cmd.Usage()
+			}
+			return doStatus(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	return cmd
+}
+
+func doStatus(out io.Writer, opts *statusOpts) error {
+	if opts.outputFormat != "simple" && opts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if ok, errs := install.ValidateNodes(plan.GetUniqueNodes()); !ok {
+		util.PrintValidationErrors(out, errs)
+		return fmt.Errorf("error validating nodes")
+	}
+
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	// Use the first master node for running kubectl
+	var kubeClient data.RemoteKubectl
+	if len(plan.Master.Nodes) > 0 {
+		if kubeClient.SSHClient, err = plan.GetSSHClient(plan.Master.Nodes[0].Host); err != nil {
+			return fmt.Errorf("error getting SSH client: %v", err)
+		}
+	}
+	cs := install.GetClusterStatus(*plan, sshClient, kubeClient)
+
+	if opts.outputFormat == "json" {
+		b, err := json.MarshalIndent(cs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling status: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		if err := printClusterStatus(out, cs); err != nil {
+			return err
+		}
+	}
+	if cs.Degraded() {
+		return errors.New("the cluster is degraded")
+	}
+	return nil
+}
+
+func printClusterStatus(out io.Writer, cs install.ClusterStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "Node\tComponent\tStatus\tMessage\n")
+	for _, c := range cs.Components {
+		node := c.Node
+		if node == "" {
+			node = "cluster"
+		}
+		status := "Healthy"
+		if !c.Healthy {
+			status = "Degraded"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", node, c.Component, status, c.Message)
+	}
+	return w.Flush()
+}
@@ -42,6 +42,7 @@ func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 				RestartServices:          stepCmd.restartServices,
 				OutputFormat:             stepCmd.outputFormat,
 				Verbose:                  stepCmd.verbose,
+				PlanFile:                 stepCmd.planFile,
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, execOpts)
 			if err != nil {
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/data"
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/junit"
+	"github.com/apprenda/kismatic/pkg/ssh"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -25,8 +30,21 @@ type upgradeOpts struct {
 	partialAllowed     bool
 	maxParallelWorkers int
 	dryRun             bool
+	report             string
+	skipEtcdBackup     bool
+	etcdBackupDir      string
+	canary             int
+	waves              string
+	waveNodes          string
+	waveSelectors      string
+	wavePause          time.Duration
+	approveWaves       bool
+	skipPrePull        bool
 }
 
+// the time to wait for the nodes of a wave to be ready after they are upgraded
+const waveReadyTimeout = 5 * time.Minute
+
 // NewCmdUpgrade returns the upgrade command
 func NewCmdUpgrade(in io.Reader, out io.Writer) *cobra.Command {
 	var opts upgradeOpts
@@ -39,11 +57,24 @@ The upgrade process is applied to each node, one node at a time. If a private do
 is being used, the new container images will be pushed by Kismatic before starting to upgrade
 nodes.
 
+Before any node is upgraded, a backup of the etcd clusters and a copy of the generated
+assets directory are saved under the etcd backup directory, unless --skip-etcd-backup is set.
+The new container images and packages are then downloaded on all the nodes that are to be
+upgraded, in parallel, unless --skip-prepull is set.
+
 Nodes in the cluster are upgraded in the following order:
 
 1. Etcd nodes
 2. Master nodes
 3. Worker nodes (regardless of specialization)
+
+Worker nodes can be upgraded in waves, starting with a canary wave. The etcd and master nodes
+are upgraded in the first wave. After each wave, the upgrade is halted unless the upgraded nodes
+are Ready and the smoke test passes. Before the next wave, the upgrade pauses for --wave-pause,
+asks for approval when --approve-waves is set, and fires the pre-upgrade-wave hooks.
+
+Use "kismatic upgrade plan" to preview the upgrade without making any changes to the cluster.
+Use "kismatic upgrade rollback" to restore a master or worker node whose upgrade failed.
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmd.Help()
@@ -57,11 +88,23 @@ Nodes in the cluster are upgraded in the following order:
 	cmd.PersistentFlags().BoolVar(&opts.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.PersistentFlags().BoolVar(&opts.partialAllowed, "partial-ok", false, "allow the upgrade of ready nodes, and skip nodes that have been deemed unready for upgrade")
 	cmd.PersistentFlags().BoolVar(&opts.dryRun, "dry-run", false, "simulate the upgrade, but don't actually upgrade the cluster")
+	cmd.PersistentFlags().BoolVar(&opts.skipEtcdBackup, "skip-etcd-backup", false, "do not back up etcd before upgrading the nodes (Use with care)")
+	cmd.PersistentFlags().BoolVar(&opts.skipPrePull, "skip-prepull", false, "do not pull the new container images and download the new packages on the nodes before upgrading them")
+	cmd.PersistentFlags().StringVar(&opts.etcdBackupDir, "etcd-backup-dir", "etcd-backups", "path to the directory where the etcd backup taken before upgrading the nodes is stored")
+	cmd.PersistentFlags().IntVar(&opts.canary, "canary", 0, "the number of worker nodes to upgrade in a canary wave, before the rest of the worker nodes")
+	cmd.PersistentFlags().StringVar(&opts.waves, "waves", "", "comma-separated list of the cumulative percentages of the remaining worker nodes that are upgraded by the end of each wave (e.g. \"25,50,100\")")
+	cmd.PersistentFlags().StringVar(&opts.waveNodes, "wave-nodes", "", "semicolon-separated list of waves, each a comma-separated list of the worker nodes upgraded in the wave (e.g. \"worker1,worker2;worker3\")")
+	cmd.PersistentFlags().StringVar(&opts.waveSelectors, "wave-selectors", "", "semicolon-separated list of waves, each a label selector of the worker nodes upgraded in the wave (e.g. \"zone=a;zone=b\")")
+	cmd.PersistentFlags().DurationVar(&opts.wavePause, "wave-pause", 0, "the length of time to pause for before upgrading the next wave")
+	cmd.PersistentFlags().BoolVar(&opts.approveWaves, "approve-waves", false, "ask for approval before upgrading the next wave")
 	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFile)
+	addReportFlag(cmd.PersistentFlags(), &opts.report)
 
 	// Subcommands
 	cmd.AddCommand(NewCmdUpgradeOffline(in, out, &opts))
 	cmd.AddCommand(NewCmdUpgradeOnline(in, out, &opts))
+	cmd.AddCommand(NewCmdUpgradePlan(out, &opts))
+	cmd.AddCommand(NewCmdUpgradeRollback(out, &opts))
 	return cmd
 }
 
@@ -101,6 +144,10 @@ be printed, and the upgrade will not proceed.
 
 If the node under upgrade is a Kubernetes node, it is cordoned and drained of workloads
 before any changes are applied.
+
+When --max-parallel-workers is greater than 1, worker nodes are upgraded in parallel as long as
+draining them at the same time does not take down all the replicas of a workload, nor violates
+a PodDisruptionBudget. Worker nodes that have other roles are upgraded one node at a time.
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.online = true
@@ -108,6 +155,7 @@ before any changes are applied.
 		},
 	}
 	cmd.PersistentFlags().BoolVar(&opts.ignoreSafetyChecks, "ignore-safety-checks", false, "ignore upgrade safety checks and continue with the upgrade")
+	cmd.Flags().IntVar(&opts.maxParallelWorkers, "max-parallel-workers", 1, "the maximum number of worker nodes to be upgraded in parallel")
 	return &cmd
 }
 
@@ -116,6 +164,16 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 		return fmt.Errorf("max-parallel-workers must be greater or equal to 1, got: %d", opts.maxParallelWorkers)
 	}
 
+	reportFile, err := parseReportOption(opts.report)
+	if err != nil {
+		return err
+	}
+	var report *junit.Report
+	if reportFile != "" {
+		report = &junit.Report{}
+		defer writeReport(out, report, reportFile)
+	}
+
 	planFile := opts.planFile
 	planner := install.FilePlanner{File: planFile}
 	executorOpts := install.ExecutorOptions{
@@ -124,6 +182,8 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 		OutputFormat:             opts.outputFormat,
 		Verbose:                  opts.verbose,
 		DryRun:                   opts.dryRun,
+		Report:                   report,
+		PlanFile:                 planFile,
 	}
 	executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
 	if err != nil {
@@ -150,11 +210,16 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 	}
 
 	// Validate the plan file before we do anything
-	if err = validatePlan(out, plan); err != nil {
+	if err = validatePlan(out, plan, report); err != nil {
 		return err
 	}
 
-	if err = validateSSHConnectivity(out, plan); err != nil {
+	if err = validateSSHConnectivity(out, plan, report); err != nil {
+		return err
+	}
+
+	strategy, err := upgradeStrategy(*opts, *plan)
+	if err != nil {
 		return err
 	}
 
@@ -180,6 +245,7 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 	if err != nil {
 		return fmt.Errorf("error listing cluster versions: %v", err)
 	}
+	printVersionWarnings(out, cv)
 
 	// Figure out which nodes to upgrade
 	var toUpgrade []install.ListableNode
@@ -205,7 +271,7 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 	if len(toUpgrade) == 0 {
 		fmt.Fprintln(out, "All nodes are at the target version. Skipping node upgrades.")
 	} else {
-		if err = upgradeNodes(in, out, *plan, *opts, toUpgrade, executor, preflightExec); err != nil {
+		if err = upgradeNodes(in, out, *plan, *opts, strategy, toUpgrade, executor, preflightExec); err != nil {
 			return err
 		}
 	}
@@ -243,20 +309,28 @@ without the "--partial-ok" flag to perform a full upgrade.
 	return nil
 }
 
-func upgradeNodes(in io.Reader, out io.Writer, plan install.Plan, opts upgradeOpts, nodesNeedUpgrade []install.ListableNode, executor install.Executor, preflightExec install.PreFlightExecutor) error {
+func upgradeNodes(in io.Reader, out io.Writer, plan install.Plan, opts upgradeOpts, strategy install.UpgradeStrategy, nodesNeedUpgrade []install.ListableNode, executor install.Executor, preflightExec install.PreFlightExecutor) (err error) {
+	var kubeClient data.RemoteKubectl
+	if opts.online || strategy.Staged() {
+		// Use the first master node for running kubectl
+		client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+		if err != nil {
+			return fmt.Errorf("error getting SSH client: %v", err)
+		}
+		kubeClient = data.RemoteKubectl{SSHClient: client}
+	}
+
 	// Run safety checks if doing an online upgrade
 	unsafeNodes := []install.ListableNode{}
 	if opts.online {
 		util.PrintHeader(out, "Validate Online Upgrade", '=')
-		// Use the first master node for running kubectl
-		client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+		glusterClient, err := getGlusterClient(plan)
 		if err != nil {
-			return fmt.Errorf("error getting SSH client: %v", err)
+			return err
 		}
-		kubeClient := data.RemoteKubectl{SSHClient: client}
 		for _, node := range nodesNeedUpgrade {
 			util.PrettyPrint(out, "%s %v", node.Node.Host, node.Roles)
-			errs := install.DetectNodeUpgradeSafety(plan, node.Node, kubeClient)
+			errs := install.DetectNodeUpgradeSafety(plan, node.Node, kubeClient, glusterClient)
 			if len(errs) != 0 {
 				if opts.ignoreSafetyChecks {
 					util.PrintWarn(out)
@@ -364,9 +438,263 @@ func upgradeNodes(in io.Reader, out io.Writer, plan install.Plan, opts upgradeOp
 		}
 	}
 
-	// Run the upgrade on the nodes that need it
-	if err := executor.UpgradeNodes(plan, toUpgrade, opts.online, opts.maxParallelWorkers); err != nil {
-		return fmt.Errorf("Failed to upgrade nodes: %v", err)
+	// Back up etcd before touching any of the nodes
+	if len(toUpgrade) > 0 {
+		var backupDir string
+		if backupDir, err = backupBeforeUpgrade(out, plan, opts, executor); err != nil {
+			return err
+		}
+		if backupDir != "" {
+			// The backup is needed to recover from a failed upgrade
+			defer func() {
+				if err != nil {
+					util.PrettyPrintWarn(out, "The etcd backup taken before the upgrade was saved to %q", backupDir)
+				}
+			}()
+		}
+	}
+
+	// Download the new images and packages before any of the nodes is drained
+	if len(toUpgrade) > 0 && !opts.skipPrePull {
+		if err := prePullUpgrade(out, plan, toUpgrade, executor); err != nil {
+			return err
+		}
+	}
+
+	// Split the nodes into waves. The nodes of a wave are verified before the next wave is upgraded.
+	var labels map[string]map[string]string
+	if len(strategy.Selectors) > 0 {
+		var err error
+		if labels, err = nodeLabels(kubeClient); err != nil {
+			return fmt.Errorf("error getting the labels of the nodes: %v", err)
+		}
+	}
+	waves := install.UpgradeWaves(toUpgrade, strategy, labels)
+	for i, wave := range waves {
+		if strategy.Staged() {
+			util.PrintHeader(out, fmt.Sprintf("Upgrade Wave %d of %d", i+1, len(waves)), '=')
+			for _, n := range wave {
+				util.PrettyPrintOk(out, "- %q %v", n.Node.Host, n.Roles)
+			}
+			if i > 0 {
+				if err := approveUpgradeWave(in, out, plan, opts, executor, i+1, len(waves), wave); err != nil {
+					return haltedUpgradeErr(waves, i, err)
+				}
+			}
+		}
+
+		// During an online upgrade, workers are only upgraded in parallel if their workloads
+		// can be disrupted at the same time
+		batches := install.UpgradeBatches(wave, opts.maxParallelWorkers)
+		if opts.online && opts.maxParallelWorkers > 1 {
+			disruptions, err := install.DetectWorkloadDisruptions(wave, kubeClient)
+			if err != nil {
+				return fmt.Errorf("error determining the worker nodes that can be upgraded in parallel: %v", err)
+			}
+			batches = install.ReplicaAwareUpgradeBatches(wave, opts.maxParallelWorkers, *disruptions)
+		}
+
+		// Run the upgrade on the nodes that need it
+		if err := executor.UpgradeNodes(plan, batches, opts.online); err != nil {
+			return fmt.Errorf("Failed to upgrade nodes: %v", err)
+		}
+
+		if strategy.Staged() && !opts.dryRun {
+			if err := verifyUpgradeWave(out, plan, wave, kubeClient, executor); err != nil {
+				return haltedUpgradeErr(waves, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// upgradeStrategy returns the strategy for splitting the nodes into waves
+func upgradeStrategy(opts upgradeOpts, plan install.Plan) (install.UpgradeStrategy, error) {
+	strategy := install.UpgradeStrategy{Canary: opts.canary}
+	if opts.waves != "" {
+		for _, p := range strings.Split(opts.waves, ",") {
+			percentage, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return strategy, fmt.Errorf("invalid wave percentage %q", p)
+			}
+			strategy.Percentages = append(strategy.Percentages, percentage)
+		}
+	}
+	if opts.waveNodes != "" {
+		var hosts []string
+		for _, n := range plan.GetUniqueNodes() {
+			hosts = append(hosts, n.Host)
+		}
+		for _, w := range strings.Split(opts.waveNodes, ";") {
+			var wave []string
+			for _, h := range strings.Split(w, ",") {
+				h = strings.TrimSpace(h)
+				if !util.Contains(h, hosts) {
+					return strategy, fmt.Errorf("node %q of the wave nodes is not in the plan file", h)
+				}
+				wave = append(wave, h)
+			}
+			strategy.Nodes = append(strategy.Nodes, wave)
+		}
+	}
+	if opts.waveSelectors != "" {
+		for _, w := range strings.Split(opts.waveSelectors, ";") {
+			selector, err := data.ParseLabelSelector(w)
+			if err != nil {
+				return strategy, err
+			}
+			strategy.Selectors = append(strategy.Selectors, selector)
+		}
+	}
+	return strategy, strategy.Validate()
+}
+
+// nodeLabels returns the Kubernetes labels of the nodes, keyed by node name
+func nodeLabels(kubeClient data.NodeLister) (map[string]map[string]string, error) {
+	nodeList, err := kubeClient.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]map[string]string{}
+	if nodeList != nil {
+		for _, n := range nodeList.Items {
+			labels[n.Name] = n.Labels
+		}
+	}
+	return labels, nil
+}
+
+// approveUpgradeWave pauses the upgrade, and then asks the operator and the
+// pre-upgrade-wave hooks for approval to upgrade the wave
+func approveUpgradeWave(in io.Reader, out io.Writer, plan install.Plan, opts upgradeOpts, executor install.Executor, number, total int, wave []install.ListableNode) error {
+	if opts.wavePause > 0 && !opts.dryRun {
+		util.PrettyPrintOk(out, "Pausing for %v before upgrading the wave", opts.wavePause)
+		time.Sleep(opts.wavePause)
+	}
+	if opts.approveWaves && !opts.dryRun {
+		ans, err := util.PromptForString(in, out, fmt.Sprintf("Continue with the upgrade of wave %d of %d?", number, total), "N", []string{"N", "y"})
+		if err != nil {
+			return fmt.Errorf("error getting user response: %v", err)
+		}
+		if strings.ToLower(ans) != "y" {
+			return errors.New("the upgrade of the wave was not approved")
+		}
+	}
+	hookWave := install.HookWave{Number: number, Total: total}
+	for _, n := range wave {
+		hookWave.Nodes = append(hookWave.Nodes, n.Node.Host)
+	}
+	return executor.RunUpgradeWaveHooks(plan, hookWave)
+}
+
+// verifyUpgradeWave ensures that the nodes of the wave are Ready, and that the smoke test passes
+func verifyUpgradeWave(out io.Writer, plan install.Plan, wave []install.ListableNode, kubeClient data.NodeLister, executor install.Executor) error {
+	util.PrintHeader(out, "Verify Upgrade Wave", '=')
+	if err := install.WaitForNodesReady(wave, kubeClient, waveReadyTimeout, 10*time.Second); err != nil {
+		util.PrettyPrintErr(out, "Waiting for the nodes to be ready")
+		return err
+	}
+	util.PrettyPrintOk(out, "Waiting for the nodes to be ready")
+	if plan.NetworkConfigured() {
+		if err := executor.RunSmokeTest(&plan); err != nil {
+			return fmt.Errorf("Smoke test failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// haltedUpgradeErr reports the nodes of the waves that were not upgraded
+func haltedUpgradeErr(waves [][]install.ListableNode, next int, err error) error {
+	var pending []string
+	for _, w := range waves[next:] {
+		for _, n := range w {
+			pending = append(pending, n.Node.Host)
+		}
+	}
+	if len(pending) == 0 {
+		return fmt.Errorf("Halted the upgrade: %v", err)
+	}
+	return fmt.Errorf("Halted the upgrade: %v. The following nodes were not upgraded: %s", err, strings.Join(pending, ", "))
+}
+
+// prePullUpgrade pulls the new container images and stages the new packages on the
+// nodes, and reports the outcome for each node. Nodes on which the downloads failed
+// are still upgraded, as the downloads are retried during the upgrade of the node.
+func prePullUpgrade(out io.Writer, plan install.Plan, nodes []install.ListableNode, executor install.Executor) error {
+	results, err := executor.PrePullUpgrade(plan, nodes)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			util.PrettyPrintWarn(out, "%s: %s", r.Host, r.Error)
+			continue
+		}
+		pulled := 0
+		for _, i := range r.Images {
+			if i.Pulled {
+				pulled++
+			}
+		}
+		msg := fmt.Sprintf("%s: pulled %d of %d images, packages %s", r.Host, pulled, len(r.Images), r.Packages)
+		if !r.Failed() {
+			util.PrettyPrintOk(out, "%s", msg)
+			continue
+		}
+		util.PrettyPrintWarn(out, "%s", msg)
+		for _, i := range r.Images {
+			if !i.Pulled {
+				fmt.Fprintf(out, "- failed to pull %s\n", i.Image)
+			}
+		}
 	}
 	return nil
 }
+
+// backupBeforeUpgrade backs up the etcd clusters and the generated assets into
+// a timestamped directory under the etcd backup directory, and returns the directory.
+// No directory is returned when the backup is skipped.
+func backupBeforeUpgrade(out io.Writer, plan install.Plan, opts upgradeOpts, executor install.Executor) (string, error) {
+	if opts.skipEtcdBackup {
+		util.PrettyPrintWarn(out, "Skipping the etcd backup before upgrading the nodes")
+		return "", nil
+	}
+	if opts.dryRun {
+		util.PrettyPrintOk(out, "The etcd clusters would be backed up to %q", opts.etcdBackupDir)
+		return "", nil
+	}
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	networking := plan.NetworkingEtcdEnabled()
+	manifest, member, err := install.PrepareEtcdBackup(plan, networking, sshClient)
+	if err != nil {
+		return "", fmt.Errorf("error preparing etcd backup: %v", err)
+	}
+	dir := filepath.Join(opts.etcdBackupDir, manifest.Timestamp.Format("2006-01-02-15-04-05"))
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating etcd backup directory: %v", err)
+	}
+	if err = executor.BackupBeforeUpgrade(plan, *member, dir, networking); err != nil {
+		return "", fmt.Errorf("Failed to back up etcd: %v", err)
+	}
+	if err = install.WriteEtcdBackupManifest(dir, *manifest); err != nil {
+		return "", fmt.Errorf("error writing etcd backup manifest: %v", err)
+	}
+	util.PrettyPrintOk(out, "The etcd backup was saved to %q", dir)
+	return dir, nil
+}
+
+// getGlusterClient returns a client that uses the first storage node to inspect
+// the storage cluster. The client is not usable if the cluster has no storage nodes.
+func getGlusterClient(plan install.Plan) (data.RemoteGlusterCLI, error) {
+	if len(plan.Storage.Nodes) == 0 {
+		return data.RemoteGlusterCLI{}, nil
+	}
+	client, err := plan.GetSSHClient(plan.Storage.Nodes[0].Host)
+	if err != nil {
+		return data.RemoteGlusterCLI{}, fmt.Errorf("error getting SSH client: %v", err)
+	}
+	return data.RemoteGlusterCLI{SSHClient: client}, nil
+}
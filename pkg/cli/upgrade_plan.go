@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type upgradePlanOpts struct {
+	outputFormat string
+}
+
+// NewCmdUpgradePlan returns the command for previewing an upgrade
+func NewCmdUpgradePlan(out io.Writer, opts *upgradeOpts) *cobra.Command {
+	planOpts := upgradePlanOpts{}
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Preview the upgrade of your Kubernetes cluster",
+		Long: `Preview the upgrade of your Kubernetes cluster, without making any changes to it.
+
+The nodes that would be upgraded or skipped are listed, along with the order, the batches
+and the waves in which they would be upgraded, and the version changes of the components running on them.
+The safety checks of the online upgrade and the upgrade pre-flight checks are run against
+each node that needs to be upgraded. Safety checks are only enforced when --online is set.
+
+The command fails if the upgrade would be blocked by any of the checks.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doUpgradePlan(out, opts, planOpts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.online, "online", false, "preview an online upgrade")
+	cmd.Flags().BoolVar(&opts.ignoreSafetyChecks, "ignore-safety-checks", false, "ignore upgrade safety checks")
+	cmd.Flags().IntVar(&opts.maxParallelWorkers, "max-parallel-workers", 1, "the maximum number of worker nodes to be upgraded in parallel")
+	cmd.Flags().StringVarP(&planOpts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	return cmd
+}
+
+func doUpgradePlan(out io.Writer, opts *upgradeOpts, planOpts upgradePlanOpts) error {
+	if planOpts.outputFormat != "simple" && planOpts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", planOpts.outputFormat)
+	}
+	if opts.maxParallelWorkers < 1 {
+		return fmt.Errorf("max-parallel-workers must be greater or equal to 1, got: %d", opts.maxParallelWorkers)
+	}
+	// Progress is written to stderr when the plan is emitted as JSON
+	log := out
+	if planOpts.outputFormat == "json" {
+		log = os.Stderr
+	}
+
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFile}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(log, plan, nil); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(log, plan, nil); err != nil {
+		return err
+	}
+	strategy, err := upgradeStrategy(*opts, *plan)
+	if err != nil {
+		return err
+	}
+	images, err := install.ReadContainerImages(install.ContainerImagesFile)
+	if err != nil {
+		return err
+	}
+	preflightExec, err := install.NewPreFlightExecutor(log, os.Stderr, install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+	})
+	if err != nil {
+		return err
+	}
+
+	util.PrintHeader(log, "Computing upgrade plan", '=')
+	cv, err := install.ListVersions(plan)
+	if err != nil {
+		return fmt.Errorf("error listing cluster versions: %v", err)
+	}
+	printVersionWarnings(log, cv)
+	sshDeets := plan.Cluster.SSH
+	sshClient := func(node install.Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	}
+	// Use the first master node for running kubectl
+	masterClient, err := sshClient(plan.Master.Nodes[0])
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	kubeClient := data.RemoteKubectl{SSHClient: masterClient}
+	glusterClient, err := getGlusterClient(*plan)
+	if err != nil {
+		return err
+	}
+	checks := install.UpgradePlanChecks{
+		Safety: func(n install.ListableNode) []error {
+			return install.DetectNodeUpgradeSafety(*plan, n.Node, kubeClient, glusterClient)
+		},
+		Preflight: func(n install.ListableNode) error {
+			util.PrintHeader(log, fmt.Sprintf("Preflight Checks: %s %s", n.Node.Host, n.Roles), '=')
+			return preflightExec.RunUpgradePreFlightCheck(plan, n)
+		},
+		Components: func(n install.ListableNode) ([]install.ComponentVersionChange, error) {
+			client, err := sshClient(n.Node)
+			if err != nil {
+				return nil, err
+			}
+			return install.NodeComponentVersions(*plan, images, n, client)
+		},
+		Disruptions: func(nodes []install.ListableNode) (*install.WorkloadDisruptions, error) {
+			return install.DetectWorkloadDisruptions(nodes, kubeClient)
+		},
+		NodeLabels: func() (map[string]map[string]string, error) {
+			return nodeLabels(kubeClient)
+		},
+	}
+	upgradePlan := install.PlanUpgrade(cv, install.UpgradePlanOptions{
+		Online:             opts.online,
+		PartialAllowed:     opts.partialAllowed,
+		IgnoreSafetyChecks: opts.ignoreSafetyChecks,
+		SkipPreflight:      opts.skipPreflight,
+		MaxParallelWorkers: opts.maxParallelWorkers,
+		Strategy:           strategy,
+	}, checks)
+
+	if planOpts.outputFormat == "json" {
+		b, err := json.MarshalIndent(upgradePlan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling upgrade plan: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		if err := printUpgradePlan(out, upgradePlan); err != nil {
+			return err
+		}
+	}
+	if len(upgradePlan.Blockers) > 0 {
+		return errors.New("the upgrade would not proceed due to the problems detected")
+	}
+	return nil
+}
+
+func printUpgradePlan(out io.Writer, up install.UpgradePlan) error {
+	mode := "offline"
+	if up.Online {
+		mode = "online"
+	}
+	util.PrintHeader(out, fmt.Sprintf("Upgrade Plan: %s upgrade to %s", mode, up.TargetVersion), '=')
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "Node\tRoles\tVersion\tAction\n")
+	for _, n := range up.Nodes {
+		action := "UPGRADE"
+		if !n.Upgrade {
+			action = fmt.Sprintf("SKIP (%s)", n.SkipReason)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", n.Node, strings.Join(n.Roles, ","), n.CurrentVersion, action)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, n := range up.Nodes {
+		if len(n.Components) == 0 && n.ComponentsError == "" && len(n.SafetyProblems) == 0 && n.PreflightError == "" {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", n.Node)
+		if n.ComponentsError != "" {
+			fmt.Fprintf(out, "- Unable to determine component versions: %s\n", n.ComponentsError)
+		}
+		for _, c := range n.Components {
+			if c.Changed() {
+				fmt.Fprintf(out, "- %s: %s -> %s\n", c.Component, c.Current, c.Target)
+			} else {
+				fmt.Fprintf(out, "- %s: %s (unchanged)\n", c.Component, c.Current)
+			}
+		}
+		for _, p := range n.SafetyProblems {
+			fmt.Fprintf(out, "- Unsafe: %s\n", p)
+		}
+		if n.PreflightError != "" {
+			fmt.Fprintf(out, "- Pre-flight checks failed: %s\n", n.PreflightError)
+		}
+	}
+
+	fmt.Fprintln(out)
+	if len(up.Batches) == 0 {
+		fmt.Fprintln(out, "No nodes would be upgraded.")
+	} else {
+		fmt.Fprintln(out, "Nodes would be upgraded in the following order:")
+		for i, b := range up.Batches {
+			fmt.Fprintf(out, "%d. %s\n", i+1, strings.Join(b, ", "))
+		}
+	}
+	if len(up.Waves) > 0 {
+		fmt.Fprintln(out, "Nodes would be upgraded in the following waves:")
+		for i, w := range up.Waves {
+			fmt.Fprintf(out, "Wave %d: %s\n", i+1, strings.Join(w, ", "))
+		}
+	}
+	if up.ClusterServices {
+		fmt.Fprintln(out, "Cluster services would be upgraded after the nodes.")
+	} else {
+		fmt.Fprintln(out, "Cluster services would not be upgraded, as this is a partial upgrade.")
+	}
+	if len(up.Blockers) > 0 {
+		fmt.Fprintln(out)
+		for _, b := range up.Blockers {
+			util.PrettyPrintErr(out, "%s", b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdUpgradeRollback returns the command for rolling back the upgrade of a node
+func NewCmdUpgradeRollback(out io.Writer, opts *upgradeOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback NODE_NAME",
+		Short: "Roll back the failed upgrade of a node",
+		Long: `Roll back the failed upgrade of a node.
+
+Before a node is upgraded, the versions of its packages and its configuration (static pod
+manifests, kubeconfig files, service files and the Kismatic version file) are recorded on the node.
+If the upgrade of the node fails, this state is kept, and the node can be restored to the
+version it was running before the upgrade. The backup is removed once the node is upgraded
+successfully, or once the rolled back node is Ready. If the rollback fails, it can be retried.
+
+After the node is restored, the control plane is validated if the node is a master, and
+the node must become Ready before the rollback is considered successful.
+
+Only master and worker nodes can be rolled back. Nodes that are etcd members cannot be rolled
+back, as the etcd data cannot be downgraded. Use "kismatic etcd restore" to restore the etcd
+clusters from the backup taken before the upgrade instead.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doUpgradeRollback(out, opts, args[0])
+		},
+	}
+	return cmd
+}
+
+func doUpgradeRollback(out io.Writer, opts *upgradeOpts, host string) error {
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFile}
+	}
+	executorOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		PlanFile:                 opts.planFile,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err = validatePlan(out, plan, nil); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(out, plan, nil); err != nil {
+		return err
+	}
+	node, err := findNode(*plan, host)
+	if err != nil {
+		return err
+	}
+
+	if err = executor.RollbackNode(*plan, node); err != nil {
+		return fmt.Errorf("error rolling back node %q: %v", host, err)
+	}
+
+	// Use the first master node for running kubectl
+	client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	kubeClient := data.RemoteKubectl{SSHClient: client}
+	rolledBack := []install.ListableNode{{Node: node, Roles: plan.GetRolesForIP(node.IP)}}
+	if err = install.WaitForNodesReady(rolledBack, kubeClient, waveReadyTimeout, 10*time.Second); err != nil {
+		util.PrettyPrintErr(out, "Waiting for the node to be ready")
+		return err
+	}
+	util.PrettyPrintOk(out, "Waiting for the node to be ready")
+	// The backup is only removed once the node is Ready, so that a failed rollback can be retried
+	if err = executor.RemoveUpgradeBackup(*plan, node); err != nil {
+		return fmt.Errorf("error removing the upgrade backup of node %q: %v", host, err)
+	}
+	util.PrintColor(out, util.Green, "\nThe node was rolled back successfully!\n")
+	fmt.Fprintln(out)
+	return nil
+}
+
+// returns the node in the plan that has the given host name
+func findNode(plan install.Plan, host string) (install.Node, error) {
+	for _, n := range plan.GetUniqueNodes() {
+		if n.Host == host {
+			return n, nil
+		}
+	}
+	return install.Node{}, fmt.Errorf("node %q is not in the plan file", host)
+}
@@ -1,13 +1,16 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
+	"strings"
 
 	"os"
 
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/junit"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -18,11 +21,13 @@ type validateOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	report             *junit.Report
 }
 
 // NewCmdValidate creates a new install validate command
 func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 	opts := &validateOpts{}
+	var reportOpt string
 	cmd := &cobra.Command{
 		Use:   "validate",
 		Short: "validate your plan file",
@@ -32,6 +37,14 @@ func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 			}
 			planner := &install.FilePlanner{File: installOpts.planFilename}
 			opts.planFile = installOpts.planFilename
+			reportFile, err := parseReportOption(reportOpt)
+			if err != nil {
+				return err
+			}
+			if reportFile != "" {
+				opts.report = &junit.Report{}
+				defer writeReport(out, opts.report, reportFile)
+			}
 			return doValidate(out, planner, opts)
 		},
 	}
@@ -39,6 +52,7 @@ func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
 	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options simple|raw)")
 	cmd.Flags().BoolVar(&opts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks")
+	addReportFlag(cmd.Flags(), &reportOpt)
 	return cmd
 }
 
@@ -53,17 +67,19 @@ func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) erro
 	plan, err := planner.Read()
 	if err != nil {
 		util.PrettyPrintErr(out, "Reading installation plan file %q", opts.planFile)
+		recordValidation(opts.report, "Reading plan file", []error{err})
 		return fmt.Errorf("error reading plan file: %v", err)
 	}
 	util.PrettyPrintOk(out, "Reading installation plan file %q", opts.planFile)
+	recordValidation(opts.report, "Reading plan file", nil)
 
 	// Validate plan file
-	if err := validatePlan(out, plan); err != nil {
+	if err := validatePlan(out, plan, opts.report); err != nil {
 		return err
 	}
 
 	// Validate SSH connections
-	if err := validateSSHConnectivity(out, plan); err != nil {
+	if err := validateSSHConnectivity(out, plan, opts.report); err != nil {
 		return err
 	}
 
@@ -74,6 +90,7 @@ func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) erro
 	}
 	// Validate Certificates
 	ok, errs := install.ValidateCertificates(plan, pki)
+	recordValidation(opts.report, "Cluster certificates", errs)
 	if !ok {
 		util.PrettyPrintErr(out, "Validating cluster certificates")
 		util.PrintValidationErrors(out, errs)
@@ -87,6 +104,7 @@ func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) erro
 	options := install.ExecutorOptions{
 		OutputFormat: opts.outputFormat,
 		Verbose:      opts.verbose,
+		Report:       opts.report,
 	}
 	e, err := install.NewPreFlightExecutor(out, os.Stderr, options)
 	if err != nil {
@@ -110,8 +128,9 @@ func newPKI(stdout io.Writer, options *validateOpts) (*install.LocalPKI, error)
 	return pki, nil
 }
 
-func validatePlan(out io.Writer, plan *install.Plan) error {
+func validatePlan(out io.Writer, plan *install.Plan, report *junit.Report) error {
 	ok, errs := install.ValidatePlan(plan)
+	recordValidation(report, "Plan file", errs)
 	if !ok {
 		util.PrettyPrintErr(out, "Validating installation plan file")
 		util.PrintValidationErrors(out, errs)
@@ -121,8 +140,9 @@ func validatePlan(out io.Writer, plan *install.Plan) error {
 	return nil
 }
 
-func validateSSHConnectivity(out io.Writer, plan *install.Plan) error {
+func validateSSHConnectivity(out io.Writer, plan *install.Plan, report *junit.Report) error {
 	ok, errs := install.ValidatePlanSSHConnections(plan)
+	recordValidation(report, "SSH connectivity", errs)
 	if !ok {
 		util.PrettyPrintErr(out, "Validating SSH connectivity to nodes")
 		util.PrintValidationErrors(out, errs)
@@ -131,3 +151,20 @@ func validateSSHConnectivity(out io.Writer, plan *install.Plan) error {
 	util.PrettyPrintOk(out, "Validating SSH connectivity to nodes")
 	return nil
 }
+
+// recordValidation adds the outcome of a validation step to the report.
+// It is a no-op when there is no report.
+func recordValidation(report *junit.Report, name string, errs []error) {
+	if report == nil {
+		return
+	}
+	var err error
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		err = errors.New(strings.Join(msgs, "; "))
+	}
+	report.AddResult("validation", name, err)
+}
@@ -85,6 +85,7 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 		Verbose:      opts.verbose,
 		// Need to refactor executor code... this will do for now as we don't need the generated assets dir in this command
 		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		PlanFile:                 planFile,
 	}
 	exec, err := install.NewExecutor(out, out, execOpts)
 	if err != nil {
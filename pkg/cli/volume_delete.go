@@ -67,6 +67,7 @@ func doVolumeDelete(out io.Writer, opts volumeDeleteOptions, planFile string, ar
 		Verbose:      opts.verbose,
 		// Need to refactor executor code... this will do for now as we don't need the generated assets dir in this command
 		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		PlanFile:                 planFile,
 	}
 	exec, err := install.NewExecutor(out, out, execOpts)
 	if err != nil {
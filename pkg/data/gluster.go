@@ -13,6 +13,16 @@ type GlusterClient interface {
 	GetQuota(volume string) (*GlusterVolumeQuotaCliOutput, error)
 }
 
+// GlusterVolumeStatusGetter gets the status of the bricks of a gluster volume
+type GlusterVolumeStatusGetter interface {
+	GetVolumeStatus(volume string) (*GlusterVolumeStatusCliOutput, error)
+}
+
+// GlusterHealInfoGetter gets the entries that are pending self-heal on the bricks of a gluster volume
+type GlusterHealInfoGetter interface {
+	GetHealInfo(volume string) (*GlusterHealInfoCliOutput, error)
+}
+
 type RemoteGlusterCLI struct {
 	SSHClient ssh.Client
 }
@@ -65,3 +75,49 @@ func UnmarshalVolumeQuota(raw string) (*GlusterVolumeQuotaCliOutput, error) {
 
 	return &glusterVolumeQuota, nil
 }
+
+// GetVolumeStatus returns the status of the bricks of the volume using gluster command on the first storage node
+func (g RemoteGlusterCLI) GetVolumeStatus(volume string) (*GlusterVolumeStatusCliOutput, error) {
+	raw, err := g.SSHClient.Output(true, fmt.Sprintf("sudo gluster volume status %s --xml", volume))
+	if err != nil {
+		return nil, fmt.Errorf("error getting volume status data for %s: %v", volume, err)
+	}
+
+	return UnmarshalVolumeStatus(raw)
+}
+
+func UnmarshalVolumeStatus(raw string) (*GlusterVolumeStatusCliOutput, error) {
+	var status GlusterVolumeStatusCliOutput
+	err := xml.Unmarshal([]byte(strings.TrimSpace(raw)), &status)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling volume status data: %v", err)
+	}
+	if status.VolumeStatus == nil || status.VolumeStatus.Volumes == nil || len(status.VolumeStatus.Volumes.Volume) == 0 {
+		return nil, fmt.Errorf("error getting volume status data")
+	}
+
+	return &status, nil
+}
+
+// GetHealInfo returns the entries pending self-heal on the bricks of the volume using gluster command on the first storage node
+func (g RemoteGlusterCLI) GetHealInfo(volume string) (*GlusterHealInfoCliOutput, error) {
+	raw, err := g.SSHClient.Output(true, fmt.Sprintf("sudo gluster volume heal %s info --xml", volume))
+	if err != nil {
+		return nil, fmt.Errorf("error getting volume heal info data for %s: %v", volume, err)
+	}
+
+	return UnmarshalHealInfo(raw)
+}
+
+func UnmarshalHealInfo(raw string) (*GlusterHealInfoCliOutput, error) {
+	var healInfo GlusterHealInfoCliOutput
+	err := xml.Unmarshal([]byte(strings.TrimSpace(raw)), &healInfo)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling volume heal info data: %v", err)
+	}
+	if healInfo.HealInfo == nil || healInfo.HealInfo.Bricks == nil {
+		return nil, fmt.Errorf("error getting volume heal info data")
+	}
+
+	return &healInfo, nil
+}
@@ -41,3 +41,98 @@ func TestUnmarshalVolumeQuota(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalVolumeStatus(t *testing.T) {
+	raw := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volStatus>
+    <volumes>
+      <volume>
+        <volName>storage01</volName>
+        <nodeCount>3</nodeCount>
+        <node>
+          <hostname>storage1</hostname>
+          <path>/data/storage01</path>
+          <peerid>b1b1a2c5-3b6e-4a6b-9a3e-6d6e2c8f1a11</peerid>
+          <status>1</status>
+          <port>49152</port>
+          <pid>1234</pid>
+        </node>
+        <node>
+          <hostname>storage2</hostname>
+          <path>/data/storage01</path>
+          <peerid>c2c2a2c5-3b6e-4a6b-9a3e-6d6e2c8f1a22</peerid>
+          <status>0</status>
+          <port>N/A</port>
+          <pid>-1</pid>
+        </node>
+        <node>
+          <hostname>Self-heal Daemon</hostname>
+          <path>localhost</path>
+          <peerid>b1b1a2c5-3b6e-4a6b-9a3e-6d6e2c8f1a11</peerid>
+          <status>1</status>
+          <port>N/A</port>
+          <pid>1250</pid>
+        </node>
+      </volume>
+    </volumes>
+  </volStatus>
+</cliOutput>`
+	status, err := UnmarshalVolumeStatus(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vol := status.VolumeStatus.Volumes.Volume[0]
+	if vol.Name != "storage01" {
+		t.Errorf("expected volume storage01, but got %q", vol.Name)
+	}
+	if len(vol.Node) != 3 {
+		t.Fatalf("expected 3 nodes, but got %d", len(vol.Node))
+	}
+	if vol.Node[0].Hostname != "storage1" || vol.Node[0].Path != "/data/storage01" || vol.Node[0].Status != 1 {
+		t.Errorf("unexpected brick status: %+v", vol.Node[0])
+	}
+	if vol.Node[1].Status != 0 {
+		t.Errorf("expected brick to be offline, but got %+v", vol.Node[1])
+	}
+}
+
+func TestUnmarshalHealInfo(t *testing.T) {
+	raw := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <healInfo>
+    <bricks>
+      <brick hostUuid="b1b1a2c5-3b6e-4a6b-9a3e-6d6e2c8f1a11">
+        <name>storage1:/data/storage01</name>
+        <status>Connected</status>
+        <numberOfEntries>2</numberOfEntries>
+      </brick>
+      <brick hostUuid="-">
+        <name>storage2:/data/storage01</name>
+        <status>Transport endpoint is not connected</status>
+        <numberOfEntries>-</numberOfEntries>
+      </brick>
+    </bricks>
+  </healInfo>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+</cliOutput>`
+	healInfo, err := UnmarshalHealInfo(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bricks := healInfo.HealInfo.Bricks.Brick
+	if len(bricks) != 2 {
+		t.Fatalf("expected 2 bricks, but got %d", len(bricks))
+	}
+	if bricks[0].Name != "storage1:/data/storage01" || bricks[0].NumberOfEntries != "2" {
+		t.Errorf("unexpected brick: %+v", bricks[0])
+	}
+	if bricks[1].NumberOfEntries != "-" {
+		t.Errorf("unexpected brick: %+v", bricks[1])
+	}
+}
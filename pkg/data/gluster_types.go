@@ -49,3 +49,51 @@ type GlusterVolumes struct {
 	Count  uint             `xml:" count,omitempty" json:"count,omitempty"`
 	Volume []*GlusterVolume `xml:" volume,omitempty" json:"volume,omitempty"`
 }
+
+// gluster volume status $VOLUME --xml
+//==============================================================================
+type GlusterVolumeStatusCliOutput struct {
+	VolumeStatus *GlusterVolumeStatus `xml:"volStatus,omitempty" json:"volStatus,omitempty"`
+}
+
+type GlusterVolumeStatus struct {
+	Volumes *GlusterVolumeStatusVolumes `xml:"volumes,omitempty" json:"volumes,omitempty"`
+}
+
+type GlusterVolumeStatusVolumes struct {
+	Volume []*GlusterVolumeStatusVolume `xml:"volume,omitempty" json:"volume,omitempty"`
+}
+
+type GlusterVolumeStatusVolume struct {
+	Name string `xml:"volName,omitempty" json:"volName,omitempty"`
+	// Node contains the bricks of the volume, as well as the daemons that serve it
+	Node []*GlusterVolumeStatusNode `xml:"node,omitempty" json:"node,omitempty"`
+}
+
+type GlusterVolumeStatusNode struct {
+	Hostname string `xml:"hostname,omitempty" json:"hostname,omitempty"`
+	Path     string `xml:"path,omitempty" json:"path,omitempty"`
+	// Status is 1 when the brick is online
+	Status int `xml:"status,omitempty" json:"status,omitempty"`
+}
+
+// gluster volume heal $VOLUME info --xml
+//==============================================================================
+type GlusterHealInfoCliOutput struct {
+	HealInfo *GlusterHealInfo `xml:"healInfo,omitempty" json:"healInfo,omitempty"`
+}
+
+type GlusterHealInfo struct {
+	Bricks *GlusterHealInfoBricks `xml:"bricks,omitempty" json:"bricks,omitempty"`
+}
+
+type GlusterHealInfoBricks struct {
+	Brick []*GlusterHealInfoBrick `xml:"brick,omitempty" json:"brick,omitempty"`
+}
+
+type GlusterHealInfoBrick struct {
+	Name   string `xml:"name,omitempty" json:"name,omitempty"`
+	Status string `xml:"status,omitempty" json:"status,omitempty"`
+	// NumberOfEntries is "-" when the brick is not connected
+	NumberOfEntries string `xml:"numberOfEntries,omitempty" json:"numberOfEntries,omitempty"`
+}
@@ -48,6 +48,31 @@ type StatefulSetGetter interface {
 	GetStatefulSet(namespace, name string) (*StatefulSet, error)
 }
 
+// NodeLister lists the nodes that are registered with a Kubernetes cluster
+type NodeLister interface {
+	ListNodes() (*NodeList, error)
+}
+
+// DeploymentLister lists the deployments in a given namespace
+type DeploymentLister interface {
+	ListDeployments(namespace string) (*DeploymentList, error)
+}
+
+// DeploymentGetter gets a deployment
+type DeploymentGetter interface {
+	GetDeployment(namespace, name string) (*Deployment, error)
+}
+
+// PodDisruptionBudgetLister lists the pod disruption budgets in all namespaces
+type PodDisruptionBudgetLister interface {
+	ListPodDisruptionBudgets() (*PodDisruptionBudgetList, error)
+}
+
+// DaemonSetLister lists the daemon sets in a given namespace
+type DaemonSetLister interface {
+	ListDaemonSets(namespace string) (*DaemonSetList, error)
+}
+
 type KubernetesClient interface {
 	PodLister
 	PVLister
@@ -210,6 +235,98 @@ func (k RemoteKubectl) GetStatefulSet(namespace, name string) (*StatefulSet, err
 	return &s, nil
 }
 
+// ListNodes returns the nodes that are registered with the cluster
+func (k RemoteKubectl) ListNodes() (*NodeList, error) {
+	raw, err := k.SSHClient.Output(true, "sudo kubectl get nodes -o json")
+	if err != nil {
+		return nil, fmt.Errorf("error getting node data: %v", err)
+	}
+	return UnmarshalNodes(raw)
+}
+
+func UnmarshalNodes(raw string) (*NodeList, error) {
+	if isNoResourcesResponse(raw) {
+		return nil, nil
+	}
+	var nodes NodeList
+	if err := json.Unmarshal([]byte(raw), &nodes); err != nil {
+		return nil, fmt.Errorf("error unmarshalling node data: %v", err)
+	}
+	return &nodes, nil
+}
+
+// ListDeployments returns the deployments in the given namespace
+func (k RemoteKubectl) ListDeployments(namespace string) (*DeploymentList, error) {
+	cmd := fmt.Sprintf("sudo kubectl get deployments --namespace=%s -o json", namespace)
+	raw, err := k.SSHClient.Output(true, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting deployments: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return nil, nil
+	}
+	var d DeploymentList
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return nil, fmt.Errorf("error unmarshalling deployments: %v", err)
+	}
+	return &d, nil
+}
+
+// GetDeployment returns the deployment with the given name in the given namespace.
+// If not found, returns an error.
+func (k RemoteKubectl) GetDeployment(namespace, name string) (*Deployment, error) {
+	cmd := fmt.Sprintf("sudo kubectl get deployment --namespace %s -o json %s", namespace, name)
+	raw, err := k.SSHClient.Output(true, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Deployment: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return nil, fmt.Errorf("Deployment %s/%s was not found", namespace, name)
+	}
+	var d Deployment
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return nil, fmt.Errorf("error unmarshalling Deployment: %v", err)
+	}
+	return &d, nil
+}
+
+// ListPodDisruptionBudgets returns the pod disruption budgets in all namespaces
+func (k RemoteKubectl) ListPodDisruptionBudgets() (*PodDisruptionBudgetList, error) {
+	raw, err := k.SSHClient.Output(true, "sudo kubectl get pdb --all-namespaces=true -o json")
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod disruption budgets: %v", err)
+	}
+	return UnmarshalPodDisruptionBudgets(raw)
+}
+
+func UnmarshalPodDisruptionBudgets(raw string) (*PodDisruptionBudgetList, error) {
+	if isNoResourcesResponse(raw) {
+		return nil, nil
+	}
+	var pdbs PodDisruptionBudgetList
+	if err := json.Unmarshal([]byte(raw), &pdbs); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pod disruption budgets: %v", err)
+	}
+	return &pdbs, nil
+}
+
+// ListDaemonSets returns the daemon sets in the given namespace
+func (k RemoteKubectl) ListDaemonSets(namespace string) (*DaemonSetList, error) {
+	cmd := fmt.Sprintf("sudo kubectl get ds --namespace=%s -o json", namespace)
+	raw, err := k.SSHClient.Output(true, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting daemon sets: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return nil, nil
+	}
+	var d DaemonSetList
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return nil, fmt.Errorf("error unmarshalling daemon sets: %v", err)
+	}
+	return &d, nil
+}
+
 // kubectl will print this message when no resources are returned
 func isNoResourcesResponse(s string) bool {
 	if strings.Contains(strings.TrimSpace(s), "No resources found") {
@@ -217,3 +334,40 @@ func isNoResourcesResponse(s string) bool {
 	}
 	return false
 }
+
+// ParseLabelSelector parses a label selector in the format accepted by kubectl's --selector flag.
+// The requirements are comma-separated, and are one of "key=value", "key==value", "key!=value",
+// "key" or "!key".
+func ParseLabelSelector(s string) (*LabelSelector, error) {
+	selector := &LabelSelector{}
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		var key, op, value string
+		switch {
+		case strings.Contains(r, "!="):
+			parts := strings.SplitN(r, "!=", 2)
+			key, op, value = parts[0], "NotIn", parts[1]
+		case strings.Contains(r, "=="):
+			parts := strings.SplitN(r, "==", 2)
+			key, op, value = parts[0], "In", parts[1]
+		case strings.Contains(r, "="):
+			parts := strings.SplitN(r, "=", 2)
+			key, op, value = parts[0], "In", parts[1]
+		case strings.HasPrefix(r, "!"):
+			key, op = r[1:], "DoesNotExist"
+		default:
+			key, op = r, "Exists"
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key == "" || strings.ContainsAny(key, "=!") || strings.ContainsAny(value, "=!") {
+			return nil, fmt.Errorf("invalid label selector requirement %q", r)
+		}
+		req := LabelSelectorRequirement{Key: key, Operator: op}
+		if op == "In" || op == "NotIn" {
+			req.Values = []string{value}
+		}
+		selector.MatchExpressions = append(selector.MatchExpressions, req)
+	}
+	return selector, nil
+}
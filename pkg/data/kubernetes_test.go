@@ -0,0 +1,145 @@
+package data
+
+import "testing"
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"app": "foo", "tier": "web"}
+	tests := []struct {
+		selector *LabelSelector
+		matches  bool
+	}{
+		{
+			selector: nil,
+			matches:  false,
+		},
+		{
+			selector: &LabelSelector{},
+			matches:  false,
+		},
+		{
+			selector: &LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+			matches:  true,
+		},
+		{
+			selector: &LabelSelector{MatchLabels: map[string]string{"app": "foo", "tier": "db"}},
+			matches:  false,
+		},
+		{
+			selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "In", Values: []string{"web", "db"}}}},
+			matches:  true,
+		},
+		{
+			selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "NotIn", Values: []string{"web"}}}},
+			matches:  false,
+		},
+		{
+			selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Exists"}}},
+			matches:  true,
+		},
+		{
+			selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "DoesNotExist"}}},
+			matches:  false,
+		},
+		{
+			selector: &LabelSelector{
+				MatchLabels:      map[string]string{"app": "foo"},
+				MatchExpressions: []LabelSelectorRequirement{{Key: "version", Operator: "DoesNotExist"}},
+			},
+			matches: true,
+		},
+	}
+	for i, test := range tests {
+		if got := test.selector.Matches(labels); got != test.matches {
+			t.Errorf("test %d: expected %v, but got %v", i, test.matches, got)
+		}
+	}
+}
+
+func TestUnmarshalPodDisruptionBudgets(t *testing.T) {
+	raw := `{
+    "apiVersion": "v1",
+    "items": [
+        {
+            "apiVersion": "policy/v1beta1",
+            "kind": "PodDisruptionBudget",
+            "metadata": {
+                "name": "zk-pdb",
+                "namespace": "default"
+            },
+            "spec": {
+                "minAvailable": 2,
+                "selector": {
+                    "matchLabels": {
+                        "app": "zk"
+                    }
+                }
+            },
+            "status": {
+                "currentHealthy": 3,
+                "desiredHealthy": 2,
+                "disruptionsAllowed": 1,
+                "expectedPods": 3,
+                "observedGeneration": 1
+            }
+        }
+    ],
+    "kind": "List",
+    "metadata": {}
+}`
+	pdbs, err := UnmarshalPodDisruptionBudgets(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pdbs.Items) != 1 {
+		t.Fatalf("expected 1 budget, but got %d", len(pdbs.Items))
+	}
+	pdb := pdbs.Items[0]
+	if pdb.Name != "zk-pdb" || pdb.Status.PodDisruptionsAllowed != 1 || pdb.Status.ExpectedPods != 3 {
+		t.Errorf("unexpected budget: %+v", pdb)
+	}
+	if !pdb.Spec.Selector.Matches(map[string]string{"app": "zk"}) {
+		t.Errorf("expected the budget to select the pod")
+	}
+
+	pdbs, err = UnmarshalPodDisruptionBudgets("No resources found.")
+	if err != nil || pdbs != nil {
+		t.Errorf("expected no budgets, but got %v, %v", pdbs, err)
+	}
+}
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{"zone": "a", "canary": "true"}
+	tests := []struct {
+		selector string
+		valid    bool
+		matches  bool
+	}{
+		{selector: "zone=a", valid: true, matches: true},
+		{selector: "zone==a", valid: true, matches: true},
+		{selector: "zone=b", valid: true, matches: false},
+		{selector: "zone!=b", valid: true, matches: true},
+		{selector: "zone=a,canary", valid: true, matches: true},
+		{selector: "zone=a, !canary", valid: true, matches: false},
+		{selector: "rack", valid: true, matches: false},
+		{selector: "", valid: false},
+		{selector: "zone=a,", valid: false},
+		{selector: "=a", valid: false},
+		{selector: "zone=a=b", valid: false},
+	}
+	for _, test := range tests {
+		s, err := ParseLabelSelector(test.selector)
+		if err != nil {
+			if test.valid {
+				t.Errorf("unexpected error parsing %q: %v", test.selector, err)
+			}
+			continue
+		}
+		if !test.valid {
+			t.Errorf("expected an error parsing %q, but didn't get one", test.selector)
+			continue
+		}
+		if s.Matches(labels) != test.matches {
+			t.Errorf("expected %q to match %v: %v", test.selector, labels, test.matches)
+		}
+	}
+}
@@ -15,6 +15,7 @@ type clientOpts struct {
 	rulesFile          string
 	targetNode         string
 	useUpgradeDefaults bool
+	report             string
 }
 
 var clientExample = `# Run the inspector against an etcd node
@@ -46,6 +47,7 @@ func NewCmdClient(out io.Writer) *cobra.Command {
 	cmd.Flags().StringVar(&opts.nodeRoles, "node-roles", "", "comma-separated list of the node's roles. Valid roles are 'etcd', 'master', 'worker'")
 	cmd.Flags().StringVarP(&opts.rulesFile, "file", "f", "", "the path to an inspector rules file. If blank, the inspector uses the default rules")
 	cmd.Flags().BoolVarP(&opts.useUpgradeDefaults, "upgrade", "u", false, "use defaults for upgrade, rather than install")
+	cmd.Flags().StringVar(&opts.report, "report", "", "write a report of the results in the form junit=<file>")
 	return cmd
 }
 
@@ -53,6 +55,9 @@ func runClient(out io.Writer, opts clientOpts) error {
 	if err := validateOutputType(opts.outputType); err != nil {
 		return err
 	}
+	if err := validateReportOption(opts.report); err != nil {
+		return err
+	}
 	if opts.nodeRoles == "" {
 		return fmt.Errorf("--node-roles is required")
 	}
@@ -76,6 +81,9 @@ func runClient(out io.Writer, opts clientOpts) error {
 	if err := printResults(out, results, opts.outputType); err != nil {
 		return err
 	}
+	if err := writeReport(opts.report, opts.targetNode, results); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
 	for _, r := range results {
 		if !r.Success {
 			return errors.New("inspector rules failed")
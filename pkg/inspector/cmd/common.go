@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/apprenda/kismatic/pkg/inspector/rule"
+	"github.com/apprenda/kismatic/pkg/junit"
 )
 
 func getNodeRoles(commaSepRoles string) ([]string, error) {
@@ -41,3 +42,32 @@ func validateOutputType(outputType string) error {
 	}
 	return nil
 }
+
+func validateReportOption(reportOpt string) error {
+	if reportOpt == "" {
+		return nil
+	}
+	_, err := junit.ParseReportOption(reportOpt)
+	return err
+}
+
+// writeReport writes the rule results to the JUnit report file set in the
+// --report option, as a single test suite with one test case per rule.
+func writeReport(reportOpt string, suite string, results []rule.Result) error {
+	if reportOpt == "" {
+		return nil
+	}
+	file, err := junit.ParseReportOption(reportOpt)
+	if err != nil {
+		return err
+	}
+	report := &junit.Report{}
+	for _, r := range results {
+		tc := junit.TestCase{Name: r.Name, ClassName: suite}
+		if !r.Success {
+			tc.Failure = &junit.Failure{Message: r.Error, Contents: r.Remediation}
+		}
+		report.AddTestCase(suite, tc)
+	}
+	return report.WriteFile(file)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/apprenda/kismatic/pkg/inspector/check"
 	"github.com/apprenda/kismatic/pkg/inspector/rule"
@@ -16,6 +17,7 @@ type localOpts struct {
 	rulesFile                   string
 	packageInstallationDisabled bool
 	useUpgradeDefaults          bool
+	report                      string
 }
 
 var localExample = `# Run with a custom rules file
@@ -38,6 +40,7 @@ func NewCmdLocal(out io.Writer) *cobra.Command {
 	cmd.Flags().StringVarP(&opts.rulesFile, "file", "f", "", "the path to an inspector rules file. If blank, the inspector uses the default rules")
 	cmd.Flags().BoolVar(&opts.packageInstallationDisabled, "pkg-installation-disabled", false, "when true, the inspector will ensure that the necessary packages are installed on the node")
 	cmd.Flags().BoolVarP(&opts.useUpgradeDefaults, "upgrade", "u", false, "use defaults for upgrade, rather than install")
+	cmd.Flags().StringVar(&opts.report, "report", "", "write a report of the results in the form junit=<file>")
 	return cmd
 }
 
@@ -52,6 +55,9 @@ func runLocal(out io.Writer, opts localOpts) error {
 	if err = validateOutputType(opts.outputType); err != nil {
 		return err
 	}
+	if err = validateReportOption(opts.report); err != nil {
+		return err
+	}
 	// Gather rules
 	rules, err := getRulesFromFileOrDefault(out, opts.rulesFile, opts.useUpgradeDefaults)
 	if err != nil {
@@ -82,6 +88,13 @@ func runLocal(out io.Writer, opts localOpts) error {
 	if err := printResults(out, results, opts.outputType); err != nil {
 		return fmt.Errorf("error printing results: %v", err)
 	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	if err := writeReport(opts.report, hostname, results); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
 	for _, r := range results {
 		if !r.Success {
 			return errors.New("inspector rules failed")
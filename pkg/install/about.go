@@ -1,7 +1,9 @@
 package install
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/apprenda/kismatic/pkg/ssh"
 	"github.com/apprenda/kismatic/pkg/util"
@@ -14,6 +16,9 @@ type ClusterVersion struct {
 	LatestVersion   semver.Version
 	IsTransitioning bool
 	Nodes           []ListableNode
+	// Warnings are the problems found while gathering the versions that did not
+	// prevent them from being listed
+	Warnings []string `json:",omitempty"`
 }
 
 // ListableNode contains version and role information about a given node
@@ -21,8 +26,36 @@ type ListableNode struct {
 	Node    Node
 	Roles   []string
 	Version semver.Version
+	// Manifest is nil if the node was configured by a version of Kismatic
+	// that did not write the node manifest
+	Manifest *NodeManifest `json:",omitempty"`
 }
 
+// NodeManifest is written to each node when it is installed, upgraded or added
+// to the cluster, and records how the node was configured
+type NodeManifest struct {
+	KismaticVersion string            `json:"kismaticVersion"`
+	ConfiguredAt    string            `json:"configuredAt"`
+	PlanHash        string            `json:"planHash"`
+	RunID           string            `json:"runID"`
+	Components      ComponentVersions `json:"components"`
+}
+
+// ComponentVersions are the versions of the components deployed on a node.
+// Components that are not deployed on the node are left empty.
+type ComponentVersions struct {
+	Kubernetes  string `json:"kubernetes,omitempty"`
+	Docker      string `json:"docker,omitempty"`
+	Etcd        string `json:"etcd,omitempty"`
+	CNIProvider string `json:"cniProvider,omitempty"`
+	CNI         string `json:"cni,omitempty"`
+}
+
+const (
+	versionFile      = "/etc/kismatic-version"
+	nodeManifestFile = "/etc/kismatic-manifest.json"
+)
+
 // KismaticVersion contains the version information of the currently running binary
 var KismaticVersion semver.Version
 
@@ -67,20 +100,25 @@ func parseVersion(versionString string) (semver.Version, error) {
 // ListVersions connects to the cluster described in the plan file and
 // gathers version information about it.
 func ListVersions(plan *Plan) (ClusterVersion, error) {
+	sshDeets := plan.Cluster.SSH
+	return listVersions(plan, func(node Node) (ssh.Client, error) {
+		return ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+	})
+}
+
+func listVersions(plan *Plan, sshClient func(Node) (ssh.Client, error)) (ClusterVersion, error) {
 	nodes := plan.GetUniqueNodes()
 	cv := ClusterVersion{
 		Nodes: []ListableNode{},
 	}
 
-	sshDeets := plan.Cluster.SSH
-	verFile := "/etc/kismatic-version"
 	for i, node := range nodes {
-		client, err := ssh.NewClient(node.IP, sshDeets.Port, sshDeets.User, sshDeets.Key)
+		client, err := sshClient(node)
 		if err != nil {
 			return cv, fmt.Errorf("error creating SSH client: %v", err)
 		}
 
-		output, err := client.Output(false, fmt.Sprintf("cat %s", verFile))
+		output, err := client.Output(false, fmt.Sprintf("cat %s", versionFile))
 		if err != nil {
 			// the output var contains the actual error message from the cat command, which has
 			// more meaningful info
@@ -89,10 +127,19 @@ func ListVersions(plan *Plan) (ClusterVersion, error) {
 
 		thisVersion, err := parseVersion(output)
 		if err != nil {
-			return cv, fmt.Errorf("invalid version %q found in version file %q of node %s", output, verFile, node.Host)
+			return cv, fmt.Errorf("invalid version %q found in version file %q of node %s", output, versionFile, node.Host)
+		}
+
+		// Nodes configured by older versions of Kismatic do not have a manifest.
+		// The version file is enough to list the node, so an invalid manifest is ignored.
+		var manifest *NodeManifest
+		if output, err = client.Output(false, fmt.Sprintf("cat %s", nodeManifestFile)); err == nil {
+			if manifest, err = parseNodeManifest(output); err != nil {
+				cv.Warnings = append(cv.Warnings, fmt.Sprintf("Ignoring invalid manifest %q of node %s: %v", nodeManifestFile, node.Host, err))
+			}
 		}
 
-		cv.Nodes = append(cv.Nodes, ListableNode{node, plan.GetRolesForIP(node.IP), thisVersion})
+		cv.Nodes = append(cv.Nodes, ListableNode{Node: node, Roles: plan.GetRolesForIP(node.IP), Version: thisVersion, Manifest: manifest})
 
 		// If looking at the first node, set the versions and move on
 		if i == 0 {
@@ -113,6 +160,14 @@ func ListVersions(plan *Plan) (ClusterVersion, error) {
 	return cv, nil
 }
 
+func parseNodeManifest(s string) (*NodeManifest, error) {
+	m := &NodeManifest{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(s)), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // NodesWithRoles returns a filtered list of ListableNode slice based on the node's roles
 func NodesWithRoles(nodes []ListableNode, roles ...string) []ListableNode {
 	var subset []ListableNode
@@ -1,9 +1,16 @@
 package install
 
 import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"testing"
 
+	"github.com/apprenda/kismatic/pkg/ssh"
 	"github.com/blang/semver"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestCompleteNoiseString(t *testing.T) {
@@ -117,6 +124,153 @@ func TestVersionPrecedence(t *testing.T) {
 	}
 }
 
+func TestParseNodeManifest(t *testing.T) {
+	out := `{
+  "kismaticVersion": "v1.7.0",
+  "configuredAt": "2017-12-01T10:00:00Z",
+  "planHash": "9f86d081884c7d65",
+  "runID": "upgrade-nodes/2017-12-01-10-00-00",
+  "components": {
+    "kubernetes": "v1.8.4",
+    "cniProvider": "calico",
+    "cni": "v2.6.3",
+    "docker": "1.12.6"
+  }
+}
+`
+	m, err := parseNodeManifest(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := NodeManifest{
+		KismaticVersion: "v1.7.0",
+		ConfiguredAt:    "2017-12-01T10:00:00Z",
+		PlanHash:        "9f86d081884c7d65",
+		RunID:           "upgrade-nodes/2017-12-01-10-00-00",
+		Components: ComponentVersions{
+			Kubernetes:  "v1.8.4",
+			Docker:      "1.12.6",
+			CNIProvider: "calico",
+			CNI:         "v2.6.3",
+		},
+	}
+	if *m != expected {
+		t.Errorf("expected manifest %+v, but got %+v", expected, *m)
+	}
+}
+
+func TestParseNodeManifestInvalid(t *testing.T) {
+	if _, err := parseNodeManifest("v1.7.0"); err == nil {
+		t.Errorf("expected an error parsing an invalid manifest, but did not get one")
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	plan := statusTestPlan()
+	manifest := `{"kismaticVersion": "v1.7.0", "runID": "install/2017-12-01-10-00-00"}`
+	nodes := func(m *NodeManifest) []ListableNode {
+		var listed []ListableNode
+		for _, n := range plan.GetUniqueNodes() {
+			listed = append(listed, ListableNode{Node: n, Roles: plan.GetRolesForIP(n.IP), Version: mustParseVersion("1.7.0"), Manifest: m})
+		}
+		return listed
+	}
+	tests := []struct {
+		name     string
+		client   fakeSSHClient
+		expected ClusterVersion
+		warnings int
+	}{
+		{
+			name: "manifest is present",
+			client: fakeSSHClient{outputs: map[string]string{
+				versionFile:      "v1.7.0",
+				nodeManifestFile: manifest,
+			}},
+			expected: ClusterVersion{
+				EarliestVersion: mustParseVersion("1.7.0"),
+				LatestVersion:   mustParseVersion("1.7.0"),
+				Nodes:           nodes(&NodeManifest{KismaticVersion: "v1.7.0", RunID: "install/2017-12-01-10-00-00"}),
+			},
+		},
+		{
+			name: "manifest is missing",
+			client: fakeSSHClient{
+				outputs: map[string]string{versionFile: "v1.7.0"},
+				errors:  map[string]error{nodeManifestFile: errors.New("No such file or directory")},
+			},
+			expected: ClusterVersion{
+				EarliestVersion: mustParseVersion("1.7.0"),
+				LatestVersion:   mustParseVersion("1.7.0"),
+				Nodes:           nodes(nil),
+			},
+		},
+		{
+			name: "manifest is invalid",
+			client: fakeSSHClient{outputs: map[string]string{
+				versionFile:      "v1.7.0",
+				nodeManifestFile: "not a manifest",
+			}},
+			expected: ClusterVersion{
+				EarliestVersion: mustParseVersion("1.7.0"),
+				LatestVersion:   mustParseVersion("1.7.0"),
+				Nodes:           nodes(nil),
+			},
+			warnings: 3,
+		},
+	}
+	for _, test := range tests {
+		cv, err := listVersions(&plan, func(Node) (ssh.Client, error) { return test.client, nil })
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		warnings := cv.Warnings
+		cv.Warnings = nil
+		if !reflect.DeepEqual(cv, test.expected) {
+			t.Errorf("%s: expected %+v, but got %+v", test.name, test.expected, cv)
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("%s: expected %d warnings, but got %v", test.name, test.warnings, warnings)
+		}
+	}
+}
+
+// the node manifest template is rendered with the image versions, which are only
+// available to the plays that load the image vars
+func TestUpdateVersionLoadsImageVars(t *testing.T) {
+	play := mustReadPlaybook(t, "../../ansible/_update-version.yaml")[0]
+	images := map[string]struct{ Version string }{}
+	for _, f := range play.VarsFiles {
+		b, err := ioutil.ReadFile(filepath.Join("../../ansible", f))
+		if err != nil {
+			t.Fatalf("error reading vars file: %v", err)
+		}
+		vars := struct {
+			OfficialImages map[string]struct{ Version string } `yaml:"official_images"`
+		}{}
+		if err = yaml.Unmarshal(b, &vars); err != nil {
+			t.Fatalf("error unmarshaling vars file %q: %v", f, err)
+		}
+		for name, image := range vars.OfficialImages {
+			images[name] = image
+		}
+	}
+	template, err := ioutil.ReadFile("../../ansible/roles/update_version/templates/kismatic-manifest.json.j2")
+	if err != nil {
+		t.Fatalf("error reading manifest template: %v", err)
+	}
+	used := regexp.MustCompile(`official_images\.(\w+)\.version`).FindAllStringSubmatch(string(template), -1)
+	if len(used) == 0 {
+		t.Fatalf("expected the manifest template to use the image versions, but it does not")
+	}
+	for _, m := range used {
+		if images[m[1]].Version == "" {
+			t.Errorf("the manifest template uses the version of image %q, but it is not loaded by the play", m[1])
+		}
+	}
+}
+
 func mustParseVersion(v string) semver.Version {
 	ver, err := parseVersion(v)
 	if err != nil {
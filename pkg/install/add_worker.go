@@ -3,105 +3,186 @@ package install
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/apprenda/kismatic/pkg/util"
 )
 
 var errMissingClusterCA = errors.New("The Certificate Authority's private key and certificate used to install " +
-	"the cluster are required for adding worker nodes.")
+	"the cluster are required for adding nodes.")
 
 // AddWorker adds a worker node to the original cluster described in the plan.
 // If successful, the updated plan is returned.
 func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan, error) {
-	if err := checkAddWorkerPrereqs(ae.pki, newWorker); err != nil {
+	return ae.AddNode(originalPlan, newWorker, "worker")
+}
+
+// AddNode adds a node with the given role (i.e. "worker", "ingress" or "storage")
+// to the original cluster described in the plan. If successful, the updated plan is returned.
+func (ae *ansibleExecutor) AddNode(originalPlan *Plan, newNode Node, role string) (*Plan, error) {
+	if err := checkAddNodePrereqs(*originalPlan, ae.pki, newNode, role); err != nil {
+		return nil, err
+	}
+	updatedPlan, err := addNodeToPlan(*originalPlan, newNode, role)
+	if err != nil {
 		return nil, err
 	}
-	updatedPlan := addWorkerToPlan(*originalPlan, newWorker)
 
 	// Generate node certificates
-	util.PrintHeader(ae.stdout, "Generating Certificate For Worker Node", '=')
+	util.PrintHeader(ae.stdout, "Generating Certificate For New Node", '=')
 	ca, err := ae.pki.GetClusterCA()
 	if err != nil {
 		return nil, err
 	}
-	if err = ae.pki.GenerateNodeCertificate(&updatedPlan, newWorker, ca); err != nil {
-		return nil, fmt.Errorf("error generating certificate for new worker: %v", err)
+	if err = ae.pki.GenerateNodeCertificate(&updatedPlan, newNode, ca); err != nil {
+		return nil, fmt.Errorf("error generating certificate for new node: %v", err)
 	}
 
-	// Run the playbook to add the worker
+	// Run the playbook to add the node
 	inventory := buildInventoryFromPlan(&updatedPlan)
 	cc, err := ae.buildClusterCatalog(&updatedPlan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
 	}
-	util.PrintHeader(ae.stdout, "Adding Worker Node to Cluster", '=')
-	t := task{
-		name:           "add-worker",
+	type step struct {
+		header string
+		task   task
+		errMsg string
+	}
+	add := task{
+		name:           "add-" + role,
 		playbook:       "kubernetes-worker.yaml",
 		plan:           updatedPlan,
 		inventory:      inventory,
 		clusterCatalog: *cc,
 		explainer:      ae.defaultExplainer(),
-		limit:          []string{newWorker.Host},
+		limit:          []string{newNode.Host},
 	}
-	if err = ae.execute(t); err != nil {
-		return nil, fmt.Errorf("error running playbook: %v", err)
+	// The add-worker hooks are only run when adding workers
+	if role == "worker" {
+		add.preHookEvent = HookEventPreAddWorker
+		add.postHookEvent = HookEventPostAddWorker
+		add.hookNodes = []Node{newNode}
 	}
+	steps := []step{{header: fmt.Sprintf("Adding %s Node to Cluster", strings.Title(role)), task: add, errMsg: "error running playbook"}}
 
 	// We need to run ansible against all hosts to update the hosts files
 	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
-		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
-		t = task{
-			name:           "add-worker-update-hosts",
-			playbook:       "_hosts.yaml",
+		steps = append(steps, step{
+			header: "Updating Hosts Files On All Nodes",
+			task: task{
+				name:           "add-" + role + "-update-hosts",
+				playbook:       "_hosts.yaml",
+				plan:           updatedPlan,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+			},
+			errMsg: "error updating hosts files on all nodes",
+		})
+	}
+
+	// Verify that the node registered with API server
+	cc.WorkerNode = newNode.Host
+	steps = append(steps, step{
+		header: "Running New Node Smoke Test",
+		task: task{
+			name:           "add-" + role + "-smoke-test",
+			playbook:       "_worker-smoke-test.yaml",
 			plan:           updatedPlan,
 			inventory:      inventory,
 			clusterCatalog: *cc,
 			explainer:      ae.defaultExplainer(),
-		}
-		if err = ae.execute(t); err != nil {
-			return nil, fmt.Errorf("error updating hosts files on all nodes: %v", err)
-		}
-	}
+			limit:          []string{newNode.Host},
+		},
+		errMsg: "error running node smoke test",
+	})
 
-	// Verify that the node registered with API server
-	util.PrintHeader(ae.stdout, "Running New Worker Smoke Test", '=')
-	cc.WorkerNode = newWorker.Host
-	t = task{
-		name:           "add-worker-smoke-test",
-		playbook:       "_worker-smoke-test.yaml",
-		plan:           updatedPlan,
-		inventory:      inventory,
-		clusterCatalog: *cc,
-		explainer:      ae.defaultExplainer(),
-		limit:          []string{newWorker.Host},
-	}
-	if err = ae.execute(t); err != nil {
-		return nil, fmt.Errorf("error running worker smoke test: %v", err)
+	switch role {
+	case "ingress":
+		// Label the node and make sure the ingress controller is running on it
+		steps = append(steps, step{
+			header: "Configuring Ingress On New Node",
+			task: task{
+				name:           "add-ingress-configure",
+				playbook:       "ingress-node.yaml",
+				plan:           updatedPlan,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+				limit:          []string{newNode.Host, updatedPlan.Master.Nodes[0].Host},
+			},
+			errMsg: "error configuring ingress on new node",
+		})
+	case "storage":
+		// Start gluster on the new node and probe it into the trusted storage pool
+		steps = append(steps, step{
+			header: "Adding Node To Storage Cluster",
+			task: task{
+				name:           "add-storage-configure",
+				playbook:       "_storage.yaml",
+				plan:           updatedPlan,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+			},
+			errMsg: "error adding new node to the storage cluster",
+		})
 	}
 
-	// Allow access to new worker to any storage volumes defined
+	// Allow access to new node to any storage volumes defined
 	if len(originalPlan.Storage.Nodes) > 0 {
-		util.PrintHeader(ae.stdout, "Updating Allowed IPs On Storage Volumes", '=')
-		t = task{
-			name:           "add-worker-update-volumes",
-			playbook:       "_volume-update-allowed.yaml",
-			plan:           updatedPlan,
-			inventory:      inventory,
-			clusterCatalog: *cc,
-			explainer:      ae.defaultExplainer(),
-		}
-		if err = ae.execute(t); err != nil {
-			return nil, fmt.Errorf("error adding new worker to volume allow list: %v", err)
+		steps = append(steps, step{
+			header: "Updating Allowed IPs On Storage Volumes",
+			task: task{
+				name:           "add-" + role + "-update-volumes",
+				playbook:       "_volume-update-allowed.yaml",
+				plan:           updatedPlan,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+			},
+			errMsg: "error adding new node to volume allow list",
+		})
+	}
+
+	// The plan has only been applied once all the steps succeed
+	steps[len(steps)-1].task.appliesPlan = true
+	for _, s := range steps {
+		util.PrintHeader(ae.stdout, s.header, '=')
+		if err = ae.execute(s.task); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.errMsg, err)
 		}
 	}
 	return &updatedPlan, nil
 }
 
-func addWorkerToPlan(plan Plan, worker Node) Plan {
-	plan.Worker.ExpectedCount++
-	plan.Worker.Nodes = append(plan.Worker.Nodes, worker)
-	return plan
+func addNodeToPlan(plan Plan, node Node, role string) (Plan, error) {
+	switch role {
+	case "worker":
+		plan.Worker.ExpectedCount++
+		plan.Worker.Nodes = append(plan.Worker.Nodes, node)
+	case "ingress":
+		plan.Ingress.ExpectedCount++
+		plan.Ingress.Nodes = append(plan.Ingress.Nodes, node)
+	case "storage":
+		plan.Storage.ExpectedCount++
+		plan.Storage.Nodes = append(plan.Storage.Nodes, node)
+	default:
+		return plan, fmt.Errorf("nodes with the %q role cannot be added", role)
+	}
+	return plan, nil
+}
+
+// the new node cannot already have the role, and its certificate must be available or
+// the cluster CA must be available to generate it
+func checkAddNodePrereqs(plan Plan, pki PKI, newNode Node, role string) error {
+	for _, n := range plan.GetNodesWithRole(role) {
+		if n.Host == newNode.Host {
+			return fmt.Errorf("node %q is already a %s node in the plan file", newNode.Host, role)
+		}
+	}
+	return checkAddWorkerPrereqs(pki, newNode)
 }
 
 // ensure the assumptions we are making are solid
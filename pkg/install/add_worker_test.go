@@ -4,6 +4,9 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/apprenda/kismatic/pkg/ansible"
@@ -311,6 +314,8 @@ type fakeRunner struct {
 	err               error
 	incomingCatalog   ansible.ClusterCatalog
 	allNodesPlaybooks []string
+	onNodePlaybooks   []string
+	limit             []string
 }
 
 func (f *fakeRunner) StartPlaybook(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog) (<-chan ansible.Event, error) {
@@ -320,6 +325,8 @@ func (f *fakeRunner) StartPlaybook(playbookFile string, inventory ansible.Invent
 func (f *fakeRunner) WaitPlaybook() error { return f.err }
 func (f *fakeRunner) StartPlaybookOnNode(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog, node ...string) (<-chan ansible.Event, error) {
 	f.incomingCatalog = cc
+	f.onNodePlaybooks = append(f.onNodePlaybooks, playbookFile)
+	f.limit = node
 	return f.eventChan, f.err
 }
 
@@ -328,3 +335,147 @@ func fakeRunnerExplainer(execError error) func(explain.AnsibleEventExplainer, io
 		return &fakeRunner{err: execError}, &explain.AnsibleEventStreamExplainer{}, nil
 	}
 }
+
+func TestAddNodeWithRole(t *testing.T) {
+	tests := []struct {
+		role  string
+		nodes func(Plan) []Node
+	}{
+		{role: "ingress", nodes: func(p Plan) []Node { return p.Ingress.Nodes }},
+		{role: "storage", nodes: func(p Plan) []Node { return p.Storage.Nodes }},
+	}
+	for _, test := range tests {
+		runsDir := mustGetTempDir(t)
+		e := ansibleExecutor{
+			options:                ExecutorOptions{RunsDirectory: runsDir},
+			stdout:                 ioutil.Discard,
+			consoleOutputFormat:    ansible.RawFormat,
+			pki:                    &fakePKI{caExists: true},
+			runnerExplainerFactory: fakeRunnerExplainer(nil),
+			certsDir:               mustGetTempDir(t),
+		}
+		originalPlan := &Plan{
+			Master: MasterNodeGroup{
+				Nodes: []Node{{Host: "master01", IP: "10.0.0.1"}},
+			},
+			Worker: NodeGroup{
+				ExpectedCount: 1,
+				Nodes:         []Node{{Host: "worker01", IP: "10.0.0.2"}},
+			},
+			Cluster: Cluster{
+				Networking: NetworkConfig{
+					ServiceCIDRBlock: "10.0.0.0/16",
+				},
+			},
+		}
+		newNode := Node{Host: "new01", IP: "10.0.0.3"}
+		updatedPlan, err := e.AddNode(originalPlan, newNode, test.role)
+		if err != nil {
+			t.Errorf("%s: unexpected error while adding node: %v", test.role, err)
+			continue
+		}
+		if nodes := test.nodes(*updatedPlan); len(nodes) != 1 || !nodes[0].Equal(newNode) {
+			t.Errorf("%s: the updated plan does not include the new node", test.role)
+		}
+		if len(updatedPlan.Worker.Nodes) != 1 {
+			t.Errorf("%s: the new node was added as a worker", test.role)
+		}
+		if _, err := os.Stat(filepath.Join(runsDir, "add-"+test.role+"-configure")); err != nil {
+			t.Errorf("%s: the %s node was not configured", test.role, test.role)
+		}
+		os.RemoveAll(runsDir)
+	}
+}
+
+// the plan is only applied once every step of adding the node succeeds
+func TestAddNodeAppliesPlanOnceComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		failRun int
+		applied []string
+	}{
+		{
+			name:    "adding the node succeeds",
+			applied: []string{"add-ingress-configure"},
+		},
+		{
+			name:    "the last step fails",
+			failRun: 3,
+		},
+	}
+	for _, test := range tests {
+		runsDir := mustGetTempDir(t)
+		defer os.RemoveAll(runsDir)
+		var runs int
+		e := ansibleExecutor{
+			options:             ExecutorOptions{RunsDirectory: runsDir},
+			stdout:              ioutil.Discard,
+			consoleOutputFormat: ansible.RawFormat,
+			pki:                 &fakePKI{caExists: true},
+			runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+				runs++
+				var err error
+				if runs == test.failRun {
+					err = errors.New("exec error")
+				}
+				return &fakeRunner{err: err}, &explain.AnsibleEventStreamExplainer{}, nil
+			},
+			certsDir: mustGetTempDir(t),
+		}
+		originalPlan := &Plan{
+			Master: MasterNodeGroup{
+				Nodes: []Node{{Host: "master01", IP: "10.0.0.1"}},
+			},
+			Worker: NodeGroup{
+				ExpectedCount: 1,
+				Nodes:         []Node{{Host: "worker01", IP: "10.0.0.2"}},
+			},
+			Cluster: Cluster{
+				Networking: NetworkConfig{
+					ServiceCIDRBlock: "10.0.0.0/16",
+				},
+			},
+		}
+		_, err := e.AddNode(originalPlan, Node{Host: "new01", IP: "10.0.0.3"}, "ingress")
+		if test.failRun == 0 && err != nil {
+			t.Errorf("%s: unexpected error while adding node: %v", test.name, err)
+		}
+		if test.failRun != 0 && err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+		markers, _ := filepath.Glob(filepath.Join(runsDir, "*", "*", appliedPlanMarker))
+		var applied []string
+		for _, m := range markers {
+			applied = append(applied, filepath.Base(filepath.Dir(filepath.Dir(m))))
+		}
+		if !reflect.DeepEqual(applied, test.applied) {
+			t.Errorf("%s: expected the plan to be applied by %v, but was applied by %v", test.name, test.applied, applied)
+		}
+	}
+}
+
+func TestAddNodeInvalid(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{caExists: true},
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	originalPlan := &Plan{
+		Master: MasterNodeGroup{
+			Nodes: []Node{{Host: "master01", IP: "10.0.0.1"}},
+		},
+		Ingress: OptionalNodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "ingress01", IP: "10.0.0.2"}},
+		},
+	}
+	if _, err := e.AddNode(originalPlan, Node{Host: "ingress01", IP: "10.0.0.2"}, "ingress"); err == nil {
+		t.Errorf("expected an error when adding an existing ingress node, but didn't get one")
+	}
+	if _, err := e.AddNode(originalPlan, Node{Host: "etcd01", IP: "10.0.0.3"}, "etcd"); err == nil {
+		t.Errorf("expected an error when adding a node with an unsupported role, but didn't get one")
+	}
+}
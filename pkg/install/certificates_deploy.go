@@ -0,0 +1,377 @@
+package install
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	// the CA that is being replaced is kept under this name until the rotation completes
+	previousCAFilename = "ca-previous"
+	// the directory where the certificates that trust both CAs are staged during a rotation
+	transitionalCertsDir = "keys-transition"
+)
+
+// DeployCertificatesOptions are used to configure the deployment of certificates
+type DeployCertificatesOptions struct {
+	// ExpiringWithin is the window within which expiring certificates are regenerated
+	ExpiringWithin time.Duration
+	// RotateCA replaces the cluster CA with a new CA, and regenerates all the certificates
+	RotateCA bool
+}
+
+// DeployCertificates regenerates the certificates of the cluster that are missing, expiring,
+// or whose subject alternate names no longer match the plan, and deploys them to the nodes that
+// use them. The components of each node are restarted one node at a time, starting with the etcd
+// nodes, followed by the master nodes and the rest of the nodes.
+//
+// When rotating the CA, the certificates are deployed to every node three times: first with
+// a trust bundle of both CAs, then with the certificates signed by the new CA, and finally with
+// the new CA alone. If the rotation fails, running it again resumes with the same CAs, or
+// restarts from the previous CA if the new CA was not generated.
+func (ae *ansibleExecutor) DeployCertificates(plan Plan, opts DeployCertificatesOptions) error {
+	if opts.RotateCA {
+		return ae.rotateCA(plan, opts.ExpiringWithin)
+	}
+	util.PrintHeader(ae.stdout, "Regenerating Certificates", '=')
+	ca, err := ae.pki.GetClusterCA()
+	if err != nil {
+		return err
+	}
+	regenerated, err := ae.regenerateCertificates(plan, ca, opts.ExpiringWithin, false)
+	if err != nil {
+		return err
+	}
+	nodes, err := nodesUsingCertificates(plan, regenerated)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		util.PrettyPrintOk(ae.stdout, "All the certificates deployed to the nodes are valid")
+		return nil
+	}
+	return ae.deployCertificates(plan, nodes, ae.certsDir, "deploy-certificates")
+}
+
+func (ae *ansibleExecutor) rotateCA(plan Plan, expiringWithin time.Duration) error {
+	util.PrintHeader(ae.stdout, "Generating New Certificate Authority", '=')
+	resuming, err := ae.rotationInProgress()
+	if err != nil {
+		return err
+	}
+	if resuming {
+		util.PrettyPrintWarn(ae.stdout, "Resuming the rotation to the CA generated by a previous run")
+	} else {
+		// The CA provided in the plan replaces the current CA, so it must be a different CA
+		if plan.CAProvided() {
+			same, err := sameCACert(plan.Cluster.Certificates.CACert, filepath.Join(ae.certsDir, "ca.pem"))
+			if err != nil {
+				return err
+			}
+			if same {
+				return errors.New("the CA provided in the plan file is the current cluster CA. Update the CA provided in the plan file, and run the rotation again")
+			}
+		}
+		oldCA, err := ae.pki.GetClusterCA()
+		if err != nil {
+			return err
+		}
+		if err = tls.WriteCert(oldCA.Key, oldCA.Cert, previousCAFilename, ae.certsDir); err != nil {
+			return fmt.Errorf("error backing up CA: %v", err)
+		}
+		bundle := filepath.Join(ae.certsDir, caBundleFilename("ca"))
+		if _, err = os.Stat(bundle); err == nil {
+			if err = os.Rename(bundle, filepath.Join(ae.certsDir, caBundleFilename(previousCAFilename))); err != nil {
+				return fmt.Errorf("error backing up CA bundle: %v", err)
+			}
+		}
+		for _, f := range []string{"ca.pem", "ca-key.pem"} {
+			if err = os.Remove(filepath.Join(ae.certsDir, f)); err != nil {
+				return fmt.Errorf("error removing CA: %v", err)
+			}
+		}
+	}
+	newCA, err := ae.pki.GenerateClusterCA(&plan)
+	if err != nil {
+		return err
+	}
+	oldTrust, err := readCATrust(previousCAFilename, ae.certsDir)
+	if err != nil {
+		return fmt.Errorf("error reading previous CA: %v", err)
+	}
+	newTrust, err := readCATrust("ca", ae.certsDir)
+	if err != nil {
+		return fmt.Errorf("error reading CA: %v", err)
+	}
+	nodes := nodesInDeployOrder(plan)
+
+	// Trust both CAs before any certificate signed by the new CA is deployed
+	util.PrintHeader(ae.stdout, "Deploying Transitional Trust Bundle", '=')
+	bundleDir, err := ae.stageTransitionalCerts(oldTrust, newTrust)
+	if err != nil {
+		return err
+	}
+	if err = ae.deployCertificates(plan, nodes, bundleDir, "rotate-ca-trust-bundle"); err != nil {
+		return err
+	}
+
+	util.PrintHeader(ae.stdout, "Regenerating Certificates With New Certificate Authority", '=')
+	if _, err = ae.regenerateCertificates(plan, newCA, expiringWithin, true); err != nil {
+		return err
+	}
+	if bundleDir, err = ae.stageTransitionalCerts(oldTrust, newTrust); err != nil {
+		return err
+	}
+	if err = ae.deployCertificates(plan, nodes, bundleDir, "rotate-ca-certificates"); err != nil {
+		return err
+	}
+
+	util.PrintHeader(ae.stdout, "Removing Previous Certificate Authority", '=')
+	if err = ae.deployCertificates(plan, nodes, ae.certsDir, "rotate-ca-complete"); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(bundleDir); err != nil {
+		return fmt.Errorf("error removing transitional certificates: %v", err)
+	}
+	// The previous CA is kept, but no longer marks a rotation in progress
+	backup := fmt.Sprintf("ca-replaced-%s", time.Now().Format("2006-01-02-15-04-05"))
+	for _, f := range []string{".pem", "-key.pem", "-bundle.pem"} {
+		if _, err = os.Stat(filepath.Join(ae.certsDir, previousCAFilename+f)); os.IsNotExist(err) {
+			continue
+		}
+		if err = os.Rename(filepath.Join(ae.certsDir, previousCAFilename+f), filepath.Join(ae.certsDir, backup+f)); err != nil {
+			return fmt.Errorf("error backing up previous CA: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotationInProgress returns true if a previous rotation generated a new CA, and stopped
+// before it completed. A rotation that stopped before the new CA was generated is undone,
+// so that it restarts from the previous CA.
+func (ae *ansibleExecutor) rotationInProgress() (bool, error) {
+	exists, err := tls.CertKeyPairExists(previousCAFilename, ae.certsDir)
+	if err != nil || !exists {
+		return false, err
+	}
+	current, err := tls.CertKeyPairExists("ca", ae.certsDir)
+	if err != nil {
+		return false, err
+	}
+	if current {
+		same, err := sameCACert(filepath.Join(ae.certsDir, "ca.pem"), filepath.Join(ae.certsDir, previousCAFilename+".pem"))
+		if err != nil {
+			return false, err
+		}
+		if !same {
+			return true, nil
+		}
+	}
+	util.PrettyPrintWarn(ae.stdout, "The previous run did not generate a new CA, restarting the rotation")
+	return false, ae.restorePreviousCA()
+}
+
+// restorePreviousCA replaces the CA with the CA that was backed up when the rotation started
+func (ae *ansibleExecutor) restorePreviousCA() error {
+	for _, f := range []string{".pem", "-key.pem"} {
+		if err := os.Rename(filepath.Join(ae.certsDir, previousCAFilename+f), filepath.Join(ae.certsDir, "ca"+f)); err != nil {
+			return fmt.Errorf("error restoring previous CA: %v", err)
+		}
+	}
+	bundle := filepath.Join(ae.certsDir, caBundleFilename("ca"))
+	previousBundle := filepath.Join(ae.certsDir, caBundleFilename(previousCAFilename))
+	if _, err := os.Stat(previousBundle); err == nil {
+		if err = os.Rename(previousBundle, bundle); err != nil {
+			return fmt.Errorf("error restoring previous CA bundle: %v", err)
+		}
+		return nil
+	}
+	if err := os.Remove(bundle); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing CA bundle: %v", err)
+	}
+	return nil
+}
+
+// returns true if the files contain the same CA certificate
+func sameCACert(file, other string) (bool, error) {
+	var certs []*x509.Certificate
+	for _, f := range []string{file, other} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return false, fmt.Errorf("error reading CA certificate: %v", err)
+		}
+		cert, err := helpers.ParseCertificatePEM(b)
+		if err != nil {
+			return false, fmt.Errorf("error parsing CA certificate %q: %v", f, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs[0].Equal(certs[1]), nil
+}
+
+// stageTransitionalCerts copies the certificates into the transitional directory,
+// replacing the trusted CA certificates with a bundle of the old and new CAs
+func (ae *ansibleExecutor) stageTransitionalCerts(oldTrust, newTrust []byte) (string, error) {
+	dir := filepath.Join(filepath.Dir(ae.certsDir), transitionalCertsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("error removing transitional certificates: %v", err)
+	}
+	if _, err := util.CopyDirectory(ae.certsDir, dir); err != nil {
+		return "", err
+	}
+	caFile, err := caTrustFilename("ca", ae.certsDir)
+	if err != nil {
+		return "", err
+	}
+	bundle := bytes.Join([][]byte{bytes.TrimSpace(oldTrust), bytes.TrimSpace(newTrust)}, []byte("\n"))
+	if err := ioutil.WriteFile(filepath.Join(dir, caFile), append(bundle, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("error writing CA trust bundle: %v", err)
+	}
+	return dir, nil
+}
+
+// returns the certificates that are trusted for the CA with the given name
+func readCATrust(name, dir string) ([]byte, error) {
+	f, err := caTrustFilename(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(dir, f))
+}
+
+// deployCertificates deploys the certificates in the directory to the nodes, one node at a time
+func (ae *ansibleExecutor) deployCertificates(plan Plan, nodes []Node, certsDir string, name string) error {
+	tlsDir, err := filepath.Abs(certsDir)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", certsDir, err)
+	}
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.TLSDirectory = tlsDir
+	cc.ForceEtcdRestart = true
+	for _, n := range nodes {
+		util.PrintHeader(ae.stdout, fmt.Sprintf("Deploy Certificates: %s %s", n.Host, plan.GetRolesForIP(n.IP)), '=')
+		t := task{
+			name:           name,
+			playbook:       "certificates-deploy.yaml",
+			plan:           plan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          []string{n.Host},
+		}
+		if err = ae.execute(t); err != nil {
+			return fmt.Errorf("error deploying certificates to %q: %v", n.Host, err)
+		}
+	}
+	return nil
+}
+
+// regenerateCertificates regenerates the certificates of the cluster that are missing, that
+// no longer match the plan, or that expire within the given window. When all is set, every
+// certificate is regenerated other than the service account signing certificate, as replacing
+// its key would invalidate the existing service account tokens.
+func (ae *ansibleExecutor) regenerateCertificates(plan Plan, ca *tls.CA, expiringWithin time.Duration, all bool) ([]certificateSpec, error) {
+	manifest, err := certManifestForCluster(plan)
+	if err != nil {
+		return nil, err
+	}
+	var regenerated []certificateSpec
+	for _, s := range manifest {
+		reason, err := certificateRegenerationReason(s, ae.certsDir, expiringWithin, all)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			util.PrettyPrintOk(ae.stdout, "Found valid certificate for %s", s.description)
+			continue
+		}
+		if err = generateCert(ca, ae.certsDir, s, plan.Cluster.Certificates.Expiry); err != nil {
+			return nil, err
+		}
+		util.PrettyPrintOk(ae.stdout, "Regenerated certificate for %s: %s", s.description, reason)
+		regenerated = append(regenerated, s)
+	}
+	return regenerated, nil
+}
+
+// returns why the certificate should be regenerated, or an empty string if it is valid
+func certificateRegenerationReason(s certificateSpec, dir string, expiringWithin time.Duration, all bool) (string, error) {
+	exists, err := tls.CertKeyPairExists(s.filename, dir)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "missing", nil
+	}
+	warn, err := tls.CertValid(s.commonName, s.subjectAlternateNames, s.organizations, s.filename, dir)
+	if err != nil {
+		return "", err
+	}
+	if len(warn) > 0 {
+		return "does not match the plan", nil
+	}
+	cert, err := tls.ReadCert(s.filename, dir)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().Add(expiringWithin).After(cert.NotAfter) {
+		return fmt.Sprintf("expires on %s", cert.NotAfter.Format("2006-01-02")), nil
+	}
+	if all && s.filename != serviceAccountCertFilename {
+		return "new CA", nil
+	}
+	return "", nil
+}
+
+// returns the nodes that use any of the certificates, in the order in which they are deployed
+func nodesUsingCertificates(plan Plan, specs []certificateSpec) ([]Node, error) {
+	filenames := make(map[string]bool)
+	for _, s := range specs {
+		filenames[s.filename] = true
+	}
+	var nodes []Node
+	for _, n := range nodesInDeployOrder(plan) {
+		m, err := certManifestForNode(plan, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range m {
+			if filenames[s.filename] {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// returns the nodes of the cluster, starting with the etcd nodes, followed by
+// the master nodes and the rest of the nodes
+func nodesInDeployOrder(plan Plan) []Node {
+	var nodes []Node
+	seen := make(map[string]bool)
+	groups := [][]Node{plan.Etcd.Nodes, plan.Master.Nodes, plan.GetUniqueNodes()}
+	for _, g := range groups {
+		for _, n := range g {
+			if !seen[n.Host] {
+				seen[n.Host] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,323 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// returns an executor with a PKI that has generated the certificates of the plan
+func certificatesDeployTestExecutor(t *testing.T, plan *Plan) (ansibleExecutor, string) {
+	assetsDir := mustGetTempDir(t)
+	certsDir := filepath.Join(assetsDir, "keys")
+	pki := &LocalPKI{
+		CACsr:                   "test/ca-csr.json",
+		GeneratedCertsDirectory: certsDir,
+		Log:                     ioutil.Discard,
+	}
+	ca, err := pki.GenerateClusterCA(plan)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(plan, ca); err != nil {
+		t.Fatalf("error generating cluster certificates: %v", err)
+	}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: filepath.Join(assetsDir, "runs")},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		pki:                    pki,
+		certsDir:               certsDir,
+	}
+	return e, assetsDir
+}
+
+func certificatesDeployTestPlan() *Plan {
+	plan := etcdMembersTestPlan()
+	plan.AddOns.CNI = &CNI{}
+	return plan
+}
+
+func TestDeployCertificatesValid(t *testing.T) {
+	plan := certificatesDeployTestPlan()
+	e, assetsDir := certificatesDeployTestExecutor(t, plan)
+	defer os.RemoveAll(assetsDir)
+
+	if err := e.DeployCertificates(*plan, DeployCertificatesOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(e.options.RunsDirectory, "deploy-certificates")); err == nil {
+		t.Error("certificates were deployed, even though all of them are valid")
+	}
+}
+
+func TestDeployCertificatesRegeneratesInvalid(t *testing.T) {
+	plan := certificatesDeployTestPlan()
+	e, assetsDir := certificatesDeployTestExecutor(t, plan)
+	defer os.RemoveAll(assetsDir)
+	before, err := ioutil.ReadFile(filepath.Join(e.certsDir, "etcd01-etcd.pem"))
+	if err != nil {
+		t.Fatalf("error reading certificate: %v", err)
+	}
+	// the node's IP changed, so the SANs of its certificates no longer match
+	plan.Etcd.Nodes[0].IP = "10.0.0.10"
+	if err = os.Remove(filepath.Join(e.certsDir, "worker01-kubelet.pem")); err != nil {
+		t.Fatalf("error removing certificate: %v", err)
+	}
+
+	if err = e.DeployCertificates(*plan, DeployCertificatesOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := ioutil.ReadFile(filepath.Join(e.certsDir, "etcd01-etcd.pem"))
+	if err != nil {
+		t.Fatalf("error reading certificate: %v", err)
+	}
+	if bytes.Equal(before, after) {
+		t.Error("the certificate whose SANs no longer match the plan was not regenerated")
+	}
+	if _, err = os.Stat(filepath.Join(e.certsDir, "worker01-kubelet.pem")); err != nil {
+		t.Errorf("the missing certificate was not regenerated: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(e.options.RunsDirectory, "deploy-certificates")); err != nil {
+		t.Errorf("the regenerated certificates were not deployed: %v", err)
+	}
+}
+
+func TestNodesUsingCertificates(t *testing.T) {
+	plan := certificatesDeployTestPlan()
+	tests := []struct {
+		filenames []string
+		expected  []string
+	}{
+		{filenames: []string{"worker01-kubelet"}, expected: []string{"worker01"}},
+		{filenames: []string{"etcd02-etcd", "master01-apiserver"}, expected: []string{"etcd02", "master01"}},
+		{filenames: []string{"kube-proxy"}, expected: []string{"master01", "worker01"}},
+		{filenames: []string{adminCertFilename}},
+	}
+	for _, test := range tests {
+		var specs []certificateSpec
+		for _, f := range test.filenames {
+			specs = append(specs, certificateSpec{filename: f})
+		}
+		nodes, err := nodesUsingCertificates(*plan, specs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var hosts []string
+		for _, n := range nodes {
+			hosts = append(hosts, n.Host)
+		}
+		if len(hosts) != len(test.expected) {
+			t.Errorf("%v: expected nodes %v, got %v", test.filenames, test.expected, hosts)
+			continue
+		}
+		for i := range hosts {
+			if hosts[i] != test.expected[i] {
+				t.Errorf("%v: expected nodes %v, got %v", test.filenames, test.expected, hosts)
+				break
+			}
+		}
+	}
+}
+
+func TestDeployCertificatesRotateCA(t *testing.T) {
+	plan := certificatesDeployTestPlan()
+	e, assetsDir := certificatesDeployTestExecutor(t, plan)
+	defer os.RemoveAll(assetsDir)
+	oldCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	serviceAccount, err := ioutil.ReadFile(filepath.Join(e.certsDir, serviceAccountCertFilename+".pem"))
+	if err != nil {
+		t.Fatalf("error reading service account certificate: %v", err)
+	}
+
+	if err = e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	newCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	if bytes.Equal(oldCA, newCA) {
+		t.Fatal("the CA was not replaced")
+	}
+	caCert, err := helpers.ParseCertificatePEM(newCA)
+	if err != nil {
+		t.Fatalf("error parsing CA: %v", err)
+	}
+	kubelet, err := tls.ReadCert("worker01-kubelet", e.certsDir)
+	if err != nil {
+		t.Fatalf("error reading certificate: %v", err)
+	}
+	if err = kubelet.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("the certificates were not signed by the new CA: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(e.certsDir, serviceAccountCertFilename+".pem"))
+	if err != nil || !bytes.Equal(b, serviceAccount) {
+		t.Errorf("the service account signing certificate was regenerated: %v", err)
+	}
+	for _, name := range []string{"rotate-ca-trust-bundle", "rotate-ca-certificates", "rotate-ca-complete"} {
+		if _, err = os.Stat(filepath.Join(e.options.RunsDirectory, name)); err != nil {
+			t.Errorf("expected task %q to run: %v", name, err)
+		}
+	}
+	if exists, _ := tls.CertKeyPairExists(previousCAFilename, e.certsDir); exists {
+		t.Error("the previous CA still marks a rotation in progress")
+	}
+	replaced, _ := filepath.Glob(filepath.Join(e.certsDir, "ca-replaced-*.pem"))
+	if len(replaced) != 2 {
+		t.Errorf("expected the previous CA to be kept, got %v", replaced)
+	}
+	if _, err = os.Stat(filepath.Join(assetsDir, transitionalCertsDir)); err == nil {
+		t.Error("the transitional certificates were not removed")
+	}
+}
+
+func TestDeployCertificatesRotateCAResumes(t *testing.T) {
+	plan := certificatesDeployTestPlan()
+	e, assetsDir := certificatesDeployTestExecutor(t, plan)
+	defer os.RemoveAll(assetsDir)
+	e.runnerExplainerFactory = fakeRunnerExplainer(errors.New("exec error"))
+	if err := e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true}); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	newCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	bundle, err := ioutil.ReadFile(filepath.Join(assetsDir, transitionalCertsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading trust bundle: %v", err)
+	}
+	if !bytes.Contains(bundle, bytes.TrimSpace(newCA)) {
+		t.Error("the trust bundle does not include the new CA")
+	}
+
+	e.runnerExplainerFactory = fakeRunnerExplainer(nil)
+	if err = e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true, ExpiringWithin: time.Hour}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resumedCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	if !bytes.Equal(newCA, resumedCA) {
+		t.Error("the rotation did not resume with the CA generated by the failed run")
+	}
+}
+
+func TestDeployCertificatesRotateCARestarts(t *testing.T) {
+	tests := []struct {
+		name      string
+		interrupt func(certsDir string) error
+	}{
+		{
+			name:      "the new CA was not generated",
+			interrupt: func(string) error { return nil },
+		},
+		{
+			name: "the CA was removed",
+			interrupt: func(certsDir string) error {
+				for _, f := range []string{"ca.pem", "ca-key.pem"} {
+					if err := os.Remove(filepath.Join(certsDir, f)); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		plan := certificatesDeployTestPlan()
+		e, assetsDir := certificatesDeployTestExecutor(t, plan)
+		defer os.RemoveAll(assetsDir)
+		// A previous run backed up the CA, and stopped before generating the new CA
+		oldCA, err := e.pki.GetClusterCA()
+		if err != nil {
+			t.Fatalf("error reading CA: %v", err)
+		}
+		if err = tls.WriteCert(oldCA.Key, oldCA.Cert, previousCAFilename, e.certsDir); err != nil {
+			t.Fatalf("error backing up CA: %v", err)
+		}
+		if err = test.interrupt(e.certsDir); err != nil {
+			t.Fatalf("error interrupting the rotation: %v", err)
+		}
+
+		if err = e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true}); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		newCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+		if err != nil {
+			t.Fatalf("error reading CA: %v", err)
+		}
+		if bytes.Equal(bytes.TrimSpace(oldCA.Cert), bytes.TrimSpace(newCA)) {
+			t.Errorf("%s: the rotation completed with the previous CA", test.name)
+		}
+		replaced, _ := filepath.Glob(filepath.Join(e.certsDir, "ca-replaced-*.pem"))
+		if len(replaced) != 2 {
+			t.Errorf("%s: expected the previous CA to be kept, got %v", test.name, replaced)
+		}
+		for _, f := range replaced {
+			if strings.HasSuffix(f, "-key.pem") {
+				continue
+			}
+			b, err := ioutil.ReadFile(f)
+			if err != nil || !bytes.Equal(b, oldCA.Cert) {
+				t.Errorf("%s: expected the previous CA to be kept in %q", test.name, f)
+			}
+		}
+	}
+}
+
+func TestDeployCertificatesRotateCAProvided(t *testing.T) {
+	caDir := mustGetTempDir(t)
+	defer os.RemoveAll(caDir)
+	plan := certificatesDeployTestPlan()
+	certs := &plan.Cluster.Certificates
+	certs.CACert, certs.CAKey, certs.CAChain = writeTestIntermediateCA(t, caDir)
+	e, assetsDir := certificatesDeployTestExecutor(t, plan)
+	defer os.RemoveAll(assetsDir)
+	oldCA, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+
+	// The plan still provides the current CA
+	if err = e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true}); err == nil {
+		t.Fatal("expected an error rotating to the current CA, but didn't get one")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil || !bytes.Equal(b, oldCA) {
+		t.Errorf("the CA was changed: %v", err)
+	}
+	if exists, _ := tls.CertKeyPairExists(previousCAFilename, e.certsDir); exists {
+		t.Error("the CA was backed up, and marks a rotation in progress")
+	}
+
+	// Retry with the plan updated to provide a new CA
+	newDir := filepath.Join(caDir, "new")
+	if err = os.Mkdir(newDir, 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	certs.CACert, certs.CAKey, certs.CAChain = writeTestIntermediateCA(t, newDir)
+	if err = e.DeployCertificates(*plan, DeployCertificatesOptions{RotateCA: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	same, err := sameCACert(certs.CACert, filepath.Join(e.certsDir, "ca.pem"))
+	if err != nil || !same {
+		t.Errorf("the CA was not replaced with the CA provided in the plan: %v", err)
+	}
+}
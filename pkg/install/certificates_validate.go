@@ -0,0 +1,199 @@
+package install
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	kubernetesCertsDir     = "/etc/kubernetes/pki"
+	etcdNetworkingCertsDir = "/etc/etcd_networking"
+)
+
+// The states of a deployed certificate
+const (
+	CertificateValid       = "valid"
+	CertificateExpiring    = "expiring"
+	CertificateExpired     = "expired"
+	CertificateInvalid     = "invalid"
+	CertificateMissing     = "missing"
+	CertificateUnreachable = "unreachable"
+)
+
+// DeployedCertificate is the state of a certificate that is deployed on a node
+type DeployedCertificate struct {
+	Node        string `json:"node"`
+	Description string `json:"description"`
+	// Path of the certificate on the node
+	Path    string     `json:"path,omitempty"`
+	Issuer  string     `json:"issuer,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	State   string     `json:"state"`
+	// Problems explains why the certificate is not valid
+	Problems []string `json:"problems,omitempty"`
+}
+
+// NeedsAttention returns true if the certificate is not valid
+func (c DeployedCertificate) NeedsAttention() bool {
+	return c.State != CertificateValid
+}
+
+// a certificate spec along with the location of the certificate on the node
+type deployedCertSpec struct {
+	spec certificateSpec
+	path string
+	// the cluster CA has no expected subject, and is compared against the local CA instead
+	isCA bool
+}
+
+// ValidateDeployedCertificates connects to the nodes of the cluster, and validates the certificates
+// deployed on them against the certificates that are expected for the node according to the plan.
+// Certificates that expire within the warning window are flagged as expiring. When the cluster CA
+// is provided, the certificates are also verified to be issued by it.
+func ValidateDeployedCertificates(plan Plan, caCert []byte, warningWindow time.Duration, now time.Time, sshClient func(Node) (ssh.Client, error)) ([]DeployedCertificate, error) {
+	var ca *x509.Certificate
+	if caCert != nil {
+		var err error
+		if ca, err = helpers.ParseCertificatePEM(caCert); err != nil {
+			return nil, fmt.Errorf("error parsing CA certificate: %v", err)
+		}
+	}
+	var certs []DeployedCertificate
+	for _, node := range plan.GetUniqueNodes() {
+		specs, err := deployedCertSpecsForNode(plan, node)
+		if err != nil {
+			return nil, err
+		}
+		client, err := sshClient(node)
+		if err == nil {
+			_, err = client.Output(false, "true")
+		}
+		if err != nil {
+			certs = append(certs, DeployedCertificate{
+				Node:     node.Host,
+				State:    CertificateUnreachable,
+				Problems: []string{fmt.Sprintf("node is unreachable: %v", err)},
+			})
+			continue
+		}
+		for _, s := range specs {
+			certs = append(certs, validateDeployedCert(node, s, client, ca, warningWindow, now))
+		}
+	}
+	return certs, nil
+}
+
+func validateDeployedCert(node Node, s deployedCertSpec, client ssh.Client, ca *x509.Certificate, warningWindow time.Duration, now time.Time) DeployedCertificate {
+	dc := DeployedCertificate{
+		Node:        node.Host,
+		Description: s.spec.description,
+		Path:        s.path,
+	}
+	out, err := client.Output(false, fmt.Sprintf("sudo cat %s", s.path))
+	if err != nil {
+		dc.State = CertificateMissing
+		dc.Problems = []string{fmt.Sprintf("error reading certificate: %s", strings.TrimSpace(out))}
+		return dc
+	}
+	// The CA file can be a bundle with the chain to the root CA,
+	// so only the first certificate is validated
+	certs, err := helpers.ParseCertificatesPEM([]byte(out))
+	if err == nil && len(certs) == 0 {
+		err = errors.New("no certificate found")
+	}
+	if err != nil {
+		dc.State = CertificateInvalid
+		dc.Problems = []string{fmt.Sprintf("error parsing certificate: %v", err)}
+		return dc
+	}
+	cert := certs[0]
+	dc.Issuer = cert.Issuer.CommonName
+	expires := cert.NotAfter
+	dc.Expires = &expires
+
+	var problems []error
+	if s.isCA {
+		if ca != nil && !ca.Equal(cert) {
+			problems = append(problems, fmt.Errorf("Certificate %q is not the cluster CA", s.path))
+		}
+	} else {
+		problems = tls.ValidateCert(cert, s.path, s.spec.commonName, s.spec.subjectAlternateNames, s.spec.organizations)
+		if ca != nil {
+			if err := cert.CheckSignatureFrom(ca); err != nil {
+				problems = append(problems, fmt.Errorf("Certificate %q is not issued by the cluster CA", s.path))
+			}
+		}
+	}
+	for _, p := range problems {
+		dc.Problems = append(dc.Problems, p.Error())
+	}
+
+	switch {
+	case now.After(cert.NotAfter):
+		dc.State = CertificateExpired
+	case len(problems) > 0:
+		dc.State = CertificateInvalid
+	case now.Add(warningWindow).After(cert.NotAfter):
+		dc.State = CertificateExpiring
+	default:
+		dc.State = CertificateValid
+	}
+	return dc
+}
+
+// returns the certificates that are expected to be deployed on the node,
+// along with their location on the node
+func deployedCertSpecsForNode(plan Plan, node Node) ([]deployedCertSpec, error) {
+	m, err := certManifestForNode(plan, node)
+	if err != nil {
+		return nil, err
+	}
+	roles := plan.GetRolesForIP(node.IP)
+	var specs []deployedCertSpec
+	caSpec := certificateSpec{description: "cluster CA"}
+	if contains("etcd", roles) {
+		for _, dir := range []string{etcdK8sCertsDir, etcdNetworkingCertsDir} {
+			specs = append(specs, deployedCertSpec{spec: caSpec, path: path.Join(dir, "ca.pem"), isCA: true})
+		}
+	}
+	if containsAny([]string{"master", "worker", "ingress", "storage"}, roles) {
+		specs = append(specs, deployedCertSpec{spec: caSpec, path: path.Join(kubernetesCertsDir, "ca.pem"), isCA: true})
+	}
+	for _, s := range m {
+		for _, p := range deployedCertPaths(s, node) {
+			specs = append(specs, deployedCertSpec{spec: s, path: p})
+		}
+	}
+	return specs, nil
+}
+
+// returns the locations on the node where the certificate is deployed
+func deployedCertPaths(s certificateSpec, node Node) []string {
+	switch s.filename {
+	case fmt.Sprintf("%s-etcd", node.Host):
+		return []string{path.Join(etcdK8sCertsDir, "etcd.pem"), path.Join(etcdNetworkingCertsDir, "etcd.pem")}
+	case fmt.Sprintf("%s-apiserver", node.Host):
+		return []string{path.Join(kubernetesCertsDir, "api-server.pem")}
+	case controllerManagerCertFilenamePrefix:
+		return []string{path.Join(kubernetesCertsDir, "controller-manager.pem")}
+	case schedulerCertFilenamePrefix:
+		return []string{path.Join(kubernetesCertsDir, "scheduler.pem")}
+	case serviceAccountCertFilename:
+		return []string{path.Join(kubernetesCertsDir, "service-account.pem")}
+	case fmt.Sprintf("%s-kubelet", node.Host):
+		return []string{path.Join(kubernetesCertsDir, "kubelet.pem")}
+	case kubeProxyCertFilenamePrefix:
+		return []string{path.Join(kubernetesCertsDir, "kube-proxy.pem")}
+	case "etcd-client":
+		return []string{path.Join(kubernetesCertsDir, "etcd-client.pem")}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// returns an SSH client factory for which the certificates generated by the PKI
+// are deployed on the nodes. The deployed files can be replaced by another generated file.
+func deployedCertsSSHClients(t *testing.T, plan Plan, pki LocalPKI, replace map[string]string) func(Node) (ssh.Client, error) {
+	return func(n Node) (ssh.Client, error) {
+		specs, err := deployedCertSpecsForNode(plan, n)
+		if err != nil {
+			t.Fatalf("error getting deployed certificates: %v", err)
+		}
+		client := fakeSSHClient{outputs: map[string]string{}, errors: map[string]error{}}
+		for _, s := range specs {
+			filename := s.spec.filename
+			if s.isCA {
+				filename = "ca"
+			}
+			if r, ok := replace[s.path]; ok {
+				filename = r
+			}
+			if filename == "" {
+				client.errors[s.path] = errors.New("No such file or directory")
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(pki.GeneratedCertsDirectory, filename+".pem"))
+			if err != nil {
+				t.Fatalf("error reading generated certificate: %v", err)
+			}
+			client.outputs[s.path] = string(b)
+		}
+		return client, nil
+	}
+}
+
+func TestValidateDeployedCertificates(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	plan := etcdMembersTestPlan()
+	plan.AddOns.CNI = &CNI{}
+	ca, err := pki.GenerateClusterCA(plan)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(plan, ca); err != nil {
+		t.Fatalf("error generating cluster certificates: %v", err)
+	}
+	if _, err = pki.GenerateCertificate("other-kubelet", "1h", "other", nil, nil, ca, false); err != nil {
+		t.Fatalf("error generating certificate: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		window        time.Duration
+		replace       map[string]string
+		expectedState string
+	}{
+		{
+			name:          "valid",
+			now:           time.Now(),
+			expectedState: CertificateValid,
+		},
+		{
+			name:          "expiring",
+			now:           time.Now(),
+			window:        2 * time.Hour,
+			expectedState: CertificateExpiring,
+		},
+		{
+			name:          "expired",
+			now:           time.Now().Add(2 * time.Hour),
+			expectedState: CertificateExpired,
+		},
+		{
+			name:          "mismatched",
+			now:           time.Now(),
+			replace:       map[string]string{"/etc/kubernetes/pki/kubelet.pem": "other-kubelet"},
+			expectedState: CertificateInvalid,
+		},
+		{
+			name:          "missing",
+			now:           time.Now(),
+			replace:       map[string]string{"/etc/kubernetes/pki/kubelet.pem": ""},
+			expectedState: CertificateMissing,
+		},
+	}
+	for _, test := range tests {
+		certs, err := ValidateDeployedCertificates(*plan, ca.Cert, test.window, test.now, deployedCertsSSHClients(t, *plan, pki, test.replace))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		var kubelet *DeployedCertificate
+		for i, c := range certs {
+			if c.Node == "worker01" && c.Path == "/etc/kubernetes/pki/kubelet.pem" {
+				kubelet = &certs[i]
+			}
+		}
+		if kubelet == nil {
+			t.Fatalf("%s: the kubelet certificate of worker01 was not validated", test.name)
+		}
+		if kubelet.State != test.expectedState {
+			t.Errorf("%s: expected state %q, got %q: %v", test.name, test.expectedState, kubelet.State, kubelet.Problems)
+		}
+		if test.expectedState == CertificateValid {
+			for _, c := range certs {
+				if c.NeedsAttention() {
+					t.Errorf("%s: expected all certificates to be valid, but %s on %s is %s: %v", test.name, c.Path, c.Node, c.State, c.Problems)
+				}
+			}
+		}
+	}
+}
+
+func TestValidateDeployedCertificatesOtherCA(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	plan := etcdMembersTestPlan()
+	plan.AddOns.CNI = &CNI{}
+	ca, err := pki.GenerateClusterCA(plan)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(plan, ca); err != nil {
+		t.Fatalf("error generating cluster certificates: %v", err)
+	}
+	otherPKI := getPKI(t)
+	defer cleanup(otherPKI.GeneratedCertsDirectory, t)
+	otherCA, err := otherPKI.GenerateClusterCA(plan)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+
+	certs, err := ValidateDeployedCertificates(*plan, otherCA.Cert, 0, time.Now(), deployedCertsSSHClients(t, *plan, pki, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range certs {
+		if c.State != CertificateInvalid {
+			t.Errorf("expected %s on %s to be invalid, as it is not issued by the cluster CA, got %s", c.Path, c.Node, c.State)
+		}
+	}
+}
+
+func TestValidateDeployedCertificatesUnreachableNode(t *testing.T) {
+	plan := etcdMembersTestPlan()
+	plan.AddOns.CNI = &CNI{}
+	certs, err := ValidateDeployedCertificates(*plan, nil, 0, time.Now(), etcdSSHClients([]string{"worker01"}, nil, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, c := range certs {
+		if c.Node == "worker01" {
+			found = true
+			if c.State != CertificateUnreachable {
+				t.Errorf("expected worker01 to be unreachable, got %s", c.State)
+			}
+		}
+	}
+	if !found {
+		t.Error("the unreachable node was not reported")
+	}
+}
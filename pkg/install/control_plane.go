@@ -0,0 +1,294 @@
+package install
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// AddMaster adds a master node to the control plane of the cluster described
+// in the plan. If successful, the updated plan is returned.
+func (ae *ansibleExecutor) AddMaster(originalPlan *Plan, newMaster Node) (*Plan, error) {
+	if err := checkAddMasterPrereqs(*originalPlan, ae.pki, newMaster); err != nil {
+		return nil, err
+	}
+	updatedPlan := addMasterToPlan(*originalPlan, newMaster)
+
+	// Generate node certificates
+	util.PrintHeader(ae.stdout, "Generating Certificates For Master Node", '=')
+	ca, err := ae.pki.GetClusterCA()
+	if err != nil {
+		return nil, err
+	}
+	if err = ae.pki.GenerateNodeCertificate(&updatedPlan, newMaster, ca); err != nil {
+		return nil, fmt.Errorf("error generating certificates for new master: %v", err)
+	}
+	regenerated, err := ae.regenerateServerCertificates(updatedPlan, originalPlan.Master.Nodes, "apiserver", ca)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := buildInventoryFromPlan(&updatedPlan)
+	cc, err := ae.buildClusterCatalog(&updatedPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	util.PrintHeader(ae.stdout, "Adding Master Node to Cluster", '=')
+	t := task{
+		name:           "add-master",
+		playbook:       "kubernetes-master.yaml",
+		plan:           updatedPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{newMaster.Host},
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error running playbook: %v", err)
+	}
+
+	if len(regenerated) > 0 {
+		util.PrintHeader(ae.stdout, "Deploying Updated API Server Certificates", '=')
+		t = task{
+			name:           "add-master-certs",
+			playbook:       "_certs.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          regenerated,
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error deploying API server certificates: %v", err)
+		}
+	}
+
+	// We need to run ansible against all hosts to update the hosts files
+	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
+		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		t = task{
+			name:           "add-master-update-hosts",
+			playbook:       "_hosts.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error updating hosts files on all nodes: %v", err)
+		}
+	}
+
+	// The API server count has changed, so restart the existing API servers
+	util.PrintHeader(ae.stdout, "Restarting API Servers On Existing Master Nodes", '=')
+	if err = ae.restartAPIServers(updatedPlan, originalPlan.Master.Nodes, "add-master-restart-apiserver", true); err != nil {
+		return nil, err
+	}
+	return &updatedPlan, nil
+}
+
+// RemoveMaster drains the master node, stops and cleans up the cluster services
+// running on it, and removes it from the control plane of the cluster described in the plan.
+// If successful, the updated plan is returned.
+func (ae *ansibleExecutor) RemoveMaster(originalPlan *Plan, master Node) (*Plan, error) {
+	if err := checkRemoveMasterPrereqs(*originalPlan, master); err != nil {
+		return nil, err
+	}
+	updatedPlan := removeMasterFromPlan(*originalPlan, master)
+
+	inventory := buildInventoryFromPlan(originalPlan)
+	cc, err := ae.buildClusterCatalog(originalPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.WorkerNode = master.Host
+
+	util.PrintHeader(ae.stdout, "Draining Master Node", '=')
+	t := task{
+		name:           "remove-master-drain",
+		playbook:       "_kube-drain-node.yaml",
+		plan:           *originalPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{master.Host},
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error draining master node: %v", err)
+	}
+
+	util.PrintHeader(ae.stdout, "Cleaning Up Master Node", '=')
+	t = task{
+		name:           "remove-master-cleanup",
+		playbook:       "_kube-node-cleanup.yaml",
+		plan:           *originalPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{master.Host},
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error cleaning up master node: %v", err)
+	}
+
+	// The remaining nodes make up the inventory from here on
+	inventory = buildInventoryFromPlan(&updatedPlan)
+	cc, err = ae.buildClusterCatalog(&updatedPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.WorkerNode = master.Host
+	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
+		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		t = task{
+			name:           "remove-master-update-hosts",
+			playbook:       "_hosts.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error updating hosts files on all nodes: %v", err)
+		}
+	}
+
+	util.PrintHeader(ae.stdout, "Restarting API Servers On Remaining Master Nodes", '=')
+	if err = ae.restartAPIServers(updatedPlan, updatedPlan.Master.Nodes, "remove-master-restart-apiserver", false); err != nil {
+		return nil, err
+	}
+
+	util.PrintHeader(ae.stdout, "Removing Master Node From Cluster", '=')
+	t = task{
+		name:           "remove-master",
+		playbook:       "_kube-delete-node.yaml",
+		plan:           updatedPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		appliesPlan:    true,
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error deleting node from the cluster: %v", err)
+	}
+	return &updatedPlan, nil
+}
+
+// restartAPIServers redeploys the API server on the given master nodes, one node at a time.
+// When appliesPlan is set, the plan is marked as applied once the last API server is restarted.
+func (ae *ansibleExecutor) restartAPIServers(plan Plan, masters []Node, name string, appliesPlan bool) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.ForceAPIServerRestart = true
+	for i, n := range masters {
+		t := task{
+			name:           name,
+			playbook:       "_kube-apiserver.yaml",
+			plan:           plan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          []string{n.Host},
+			appliesPlan:    appliesPlan && i == len(masters)-1,
+		}
+		if err = ae.execute(t); err != nil {
+			return fmt.Errorf("error restarting API server on %q: %v", n.Host, err)
+		}
+	}
+	return nil
+}
+
+// regenerateServerCertificates regenerates the server certificates of the given component
+// (i.e. "apiserver" or "etcd") on the given nodes that are missing or whose subject
+// alternate names have changed. The nodes whose certificates were regenerated are returned.
+func (ae *ansibleExecutor) regenerateServerCertificates(plan Plan, nodes []Node, component string, ca *tls.CA) ([]string, error) {
+	var regenerated []string
+	for _, n := range nodes {
+		m, err := certManifestForNode(plan, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range m {
+			if s.filename != fmt.Sprintf("%s-%s", n.Host, component) {
+				continue
+			}
+			exists, err := tls.CertKeyPairExists(s.filename, ae.certsDir)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				warn, err := tls.CertValid(s.commonName, s.subjectAlternateNames, s.organizations, s.filename, ae.certsDir)
+				if err != nil {
+					return nil, err
+				}
+				if len(warn) == 0 {
+					continue
+				}
+			}
+			if _, err := ae.pki.GenerateCertificate(s.filename, plan.Cluster.Certificates.Expiry, s.commonName, s.subjectAlternateNames, s.organizations, ca, true); err != nil {
+				return nil, fmt.Errorf("error regenerating certificate for %s: %v", s.description, err)
+			}
+			util.PrettyPrintOk(ae.stdout, "Regenerated certificate for %s", s.description)
+			regenerated = append(regenerated, n.Host)
+		}
+	}
+	return regenerated, nil
+}
+
+func checkAddMasterPrereqs(plan Plan, pki PKI, newMaster Node) error {
+	for _, n := range plan.Master.Nodes {
+		if n.Host == newMaster.Host || n.IP == newMaster.IP {
+			return fmt.Errorf("node %q is already a master node in the plan file", newMaster.Host)
+		}
+	}
+	return checkAddWorkerPrereqs(pki, newMaster)
+}
+
+func addMasterToPlan(plan Plan, master Node) Plan {
+	plan.Master.ExpectedCount++
+	plan.Master.Nodes = append(plan.Master.Nodes, master)
+	return plan
+}
+
+func removeMasterFromPlan(plan Plan, master Node) Plan {
+	var nodes []Node
+	for _, n := range plan.Master.Nodes {
+		if n.Host != master.Host {
+			nodes = append(nodes, n)
+		}
+	}
+	plan.Master.ExpectedCount--
+	plan.Master.Nodes = nodes
+	return plan
+}
+
+// the node must be a master that is not shared with other Kubernetes roles,
+// and it cannot be the last master or the load balanced endpoint
+func checkRemoveMasterPrereqs(plan Plan, master Node) error {
+	found := false
+	for _, n := range plan.Master.Nodes {
+		if n.Host == master.Host {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("node %q is not a master node in the plan file", master.Host)
+	}
+	for _, r := range plan.GetRolesForIP(master.IP) {
+		if r != "master" && r != "etcd" {
+			return fmt.Errorf("node %q has the %s role. Only nodes that are dedicated masters can be removed", master.Host, r)
+		}
+	}
+	if len(plan.Master.Nodes) == 1 {
+		return fmt.Errorf("node %q is the only master node in the cluster", master.Host)
+	}
+	if plan.Master.LoadBalancedFQDN == master.Host || plan.Master.LoadBalancedFQDN == master.IP {
+		return fmt.Errorf("node %q is the load balanced endpoint of the master nodes", master.Host)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func controlPlaneTestPlan() *Plan {
+	return &Plan{
+		Cluster: Cluster{
+			Certificates: CertsConfig{Expiry: "1h"},
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+		Etcd: NodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "etcd01", IP: "10.0.0.1"}},
+		},
+		Master: MasterNodeGroup{
+			ExpectedCount:    2,
+			Nodes:            []Node{{Host: "master01", IP: "10.0.0.2"}, {Host: "master02", IP: "10.0.0.3"}},
+			LoadBalancedFQDN: "lb.example.com",
+		},
+		Worker: NodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "worker01", IP: "10.0.0.4"}},
+		},
+	}
+}
+
+func TestAddMasterPlanIsUpdated(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{caExists: true},
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	originalPlan := controlPlaneTestPlan()
+	newMaster := Node{Host: "master03", IP: "10.0.0.5"}
+	updatedPlan, err := e.AddMaster(originalPlan, newMaster)
+	if err != nil {
+		t.Fatalf("unexpected error while adding master: %v", err)
+	}
+	if updatedPlan.Master.ExpectedCount != 3 {
+		t.Errorf("expected count was not incremented")
+	}
+	if len(updatedPlan.Master.Nodes) != 3 || !updatedPlan.Master.Nodes[2].Equal(newMaster) {
+		t.Errorf("the updated plan does not include the new master")
+	}
+	if len(originalPlan.Master.Nodes) != 2 {
+		t.Errorf("the original plan was modified")
+	}
+}
+
+func TestAddMasterExistingNode(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{caExists: true},
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	if _, err := e.AddMaster(controlPlaneTestPlan(), Node{Host: "master02", IP: "10.0.0.3"}); err == nil {
+		t.Errorf("expected an error, but didn't get one")
+	}
+}
+
+func TestRemoveMasterPlanNotUpdatedAfterFailure(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	originalPlan := controlPlaneTestPlan()
+	updatedPlan, err := e.RemoveMaster(originalPlan, originalPlan.Master.Nodes[1])
+	if err == nil {
+		t.Errorf("expected an error, but didn't get one")
+	}
+	if updatedPlan != nil {
+		t.Error("plan was updated, even though removing master failed")
+	}
+}
+
+func TestRemoveMasterPlanIsUpdated(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+	}
+	originalPlan := controlPlaneTestPlan()
+	updatedPlan, err := e.RemoveMaster(originalPlan, originalPlan.Master.Nodes[0])
+	if err != nil {
+		t.Fatalf("unexpected error while removing master: %v", err)
+	}
+	if updatedPlan.Master.ExpectedCount != 1 {
+		t.Errorf("expected count was not decremented")
+	}
+	if len(updatedPlan.Master.Nodes) != 1 || updatedPlan.Master.Nodes[0].Host != "master02" {
+		t.Errorf("expected only master02 to remain in the plan, got %v", updatedPlan.Master.Nodes)
+	}
+}
+
+func TestRemoveMasterPrereqs(t *testing.T) {
+	tests := []struct {
+		name   string
+		plan   func() *Plan
+		master Node
+	}{
+		{
+			name:   "not a master",
+			plan:   controlPlaneTestPlan,
+			master: Node{Host: "worker01", IP: "10.0.0.4"},
+		},
+		{
+			name: "master with worker role",
+			plan: func() *Plan {
+				p := controlPlaneTestPlan()
+				p.Worker.Nodes = append(p.Worker.Nodes, p.Master.Nodes[0])
+				return p
+			},
+			master: Node{Host: "master01", IP: "10.0.0.2"},
+		},
+		{
+			name: "only master",
+			plan: func() *Plan {
+				p := controlPlaneTestPlan()
+				p.Master.Nodes = p.Master.Nodes[:1]
+				return p
+			},
+			master: Node{Host: "master01", IP: "10.0.0.2"},
+		},
+		{
+			name: "load balanced endpoint",
+			plan: func() *Plan {
+				p := controlPlaneTestPlan()
+				p.Master.LoadBalancedFQDN = "master01"
+				return p
+			},
+			master: Node{Host: "master01", IP: "10.0.0.2"},
+		},
+	}
+	for _, test := range tests {
+		if err := checkRemoveMasterPrereqs(*test.plan(), test.master); err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+	}
+	// a master that is also an etcd node can be removed
+	p := controlPlaneTestPlan()
+	p.Etcd.Nodes = append(p.Etcd.Nodes, p.Master.Nodes[0])
+	if err := checkRemoveMasterPrereqs(*p, p.Master.Nodes[0]); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegenerateServerCertificates(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := controlPlaneTestPlan()
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	for _, n := range p.Master.Nodes {
+		if err = pki.GenerateNodeCertificate(p, n, ca); err != nil {
+			t.Fatalf("error generating node certificate: %v", err)
+		}
+	}
+	e := ansibleExecutor{
+		stdout:   ioutil.Discard,
+		pki:      &pki,
+		certsDir: pki.GeneratedCertsDirectory,
+	}
+	regenerated, err := e.regenerateServerCertificates(*p, p.Master.Nodes, "apiserver", ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(regenerated) != 0 {
+		t.Errorf("expected no certificates to be regenerated, got %v", regenerated)
+	}
+
+	// the load balanced name is a SAN of all API server certificates
+	p.Master.LoadBalancedFQDN = "new-lb.example.com"
+	regenerated, err = e.regenerateServerCertificates(*p, p.Master.Nodes, "apiserver", ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"master01", "master02"}; !reflect.DeepEqual(regenerated, expected) {
+		t.Errorf("expected %v to be regenerated, got %v", expected, regenerated)
+	}
+	regenerated, err = e.regenerateServerCertificates(*p, p.Master.Nodes, "apiserver", ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(regenerated) != 0 {
+		t.Errorf("expected regenerated certificates to be valid, but %v were regenerated again", regenerated)
+	}
+}
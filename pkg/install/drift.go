@@ -0,0 +1,365 @@
+package install
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const notSet = "<not set>"
+
+// Difference between what the plan would deploy on a node, and what is
+// actually deployed on it
+type Difference struct {
+	Component string `json:"component"`
+	Setting   string `json:"setting"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+// NodeDrift contains the differences found on a single node
+type NodeDrift struct {
+	Node        string       `json:"node"`
+	Differences []Difference `json:"differences"`
+	// Error that prevented drift detection on the node
+	Error string `json:"error,omitempty"`
+}
+
+// Drifted returns true if the node does not match the plan
+func (nd NodeDrift) Drifted() bool {
+	return nd.Error != "" || len(nd.Differences) > 0
+}
+
+func (nd *NodeDrift) add(component, setting, expected, actual string) {
+	nd.Differences = append(nd.Differences, Difference{
+		Component: component,
+		Setting:   setting,
+		Expected:  expected,
+		Actual:    actual,
+	})
+}
+
+// DeploymentDefaults are the component versions and options that are deployed
+// by KET when they are not overridden in the plan file. They are read from
+// the ansible variables that ship with KET.
+type DeploymentDefaults struct {
+	APIServerOptions         map[string]string `yaml:"kubernetes_api_server_option_defaults"`
+	ControllerManagerOptions map[string]string `yaml:"kube_controller_manager_option_defaults"`
+	SchedulerOptions         map[string]string `yaml:"kube_scheduler_option_defaults"`
+	ProxyOptions             map[string]string `yaml:"kube_proxy_option_defaults"`
+	KubeletOptions           map[string]string `yaml:"kubelet_defaults"`
+	Images                   map[string]struct {
+		Name    string
+		Version string
+	} `yaml:"official_images"`
+}
+
+// ReadDeploymentDefaults reads the deployment defaults from the ansible directory
+func ReadDeploymentDefaults(ansibleDir string) (*DeploymentDefaults, error) {
+	d := &DeploymentDefaults{}
+	for _, f := range []string{"all.yaml", "container_images.yaml"} {
+		file := filepath.Join(ansibleDir, "group_vars", f)
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %q: %v", file, err)
+		}
+		if err := yaml.Unmarshal(b, d); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %q: %v", file, err)
+		}
+	}
+	return d, nil
+}
+
+// driftComponent is a cluster component whose version and options are compared against the plan
+type driftComponent struct {
+	name      string
+	image     string
+	defaults  map[string]string
+	overrides map[string]string
+}
+
+// DetectDrift compares the nodes of the cluster against what the plan would
+// deploy on them. The deployed versions of KET and the cluster components,
+// the options of the Kubernetes components, the node labels, the hosts file
+// entries and the docker registry configuration are verified.
+func DetectDrift(plan Plan, defaults DeploymentDefaults, sshClient func(Node) (ssh.Client, error), kubeClient data.NodeLister) []NodeDrift {
+	var registered map[string]data.Node
+	var labelsErr error
+	nodeList, err := kubeClient.ListNodes()
+	if err != nil {
+		labelsErr = err
+	} else {
+		registered = map[string]data.Node{}
+		if nodeList != nil {
+			for _, n := range nodeList.Items {
+				registered[n.Name] = n
+			}
+		}
+	}
+
+	drift := []NodeDrift{}
+	for _, node := range plan.GetUniqueNodes() {
+		nd := NodeDrift{Node: node.Host}
+		client, err := sshClient(node)
+		if err != nil {
+			nd.Error = err.Error()
+			drift = append(drift, nd)
+			continue
+		}
+		roles := plan.GetRolesForIP(node.IP)
+		detectVersionDrift(&nd, client)
+		for _, c := range driftComponents(plan, defaults, node, roles) {
+			detectComponentDrift(&nd, client, c, defaults)
+		}
+		if !(len(roles) == 1 && roles[0] == "etcd") {
+			if labelsErr != nil {
+				nd.add("labels", "", "", fmt.Sprintf("error listing nodes: %v", labelsErr))
+			} else {
+				detectLabelDrift(&nd, plan, node, roles, registered)
+			}
+		}
+		if plan.Cluster.Networking.UpdateHostsFiles {
+			detectHostsFileDrift(&nd, plan, client)
+		}
+		if plan.PrivateRegistryProvided() && plan.DockerRegistry.CAPath != "" {
+			detectRegistryDrift(&nd, plan, client)
+		}
+		drift = append(drift, nd)
+	}
+	return drift
+}
+
+// driftComponents returns the components that are deployed on a node with the given roles
+func driftComponents(plan Plan, defaults DeploymentDefaults, node Node, roles []string) []driftComponent {
+	var components []driftComponent
+	if contains("master", roles) {
+		components = append(components,
+			driftComponent{name: "kube-apiserver", image: "kube_apiserver", defaults: defaults.APIServerOptions, overrides: plan.Cluster.APIServerOptions.Overrides},
+			driftComponent{name: "kube-controller-manager", image: "kube_controller_manager", defaults: defaults.ControllerManagerOptions, overrides: plan.Cluster.KubeControllerManagerOptions.Overrides},
+			driftComponent{name: "kube-scheduler", image: "kube_scheduler", defaults: defaults.SchedulerOptions, overrides: plan.Cluster.KubeSchedulerOptions.Overrides},
+		)
+	}
+	if contains("master", roles) || contains("worker", roles) || contains("ingress", roles) || contains("storage", roles) {
+		kubeletOverrides := map[string]string{}
+		for k, v := range plan.Cluster.KubeletOptions.Overrides {
+			kubeletOverrides[k] = v
+		}
+		for k, v := range node.KubeletOptions.Overrides {
+			kubeletOverrides[k] = v
+		}
+		components = append(components,
+			driftComponent{name: "kube-proxy", image: "kube_proxy", defaults: defaults.ProxyOptions, overrides: plan.Cluster.KubeProxyOptions.Overrides},
+			// the kubelet is installed from packages, but is the same version as the kube-proxy
+			driftComponent{name: "kubelet", image: "kube_proxy", defaults: defaults.KubeletOptions, overrides: kubeletOverrides},
+		)
+	}
+	return components
+}
+
+func detectVersionDrift(nd *NodeDrift, client ssh.Client) {
+	out, err := client.Output(false, "cat /etc/kismatic-version")
+	actual := strings.TrimSpace(out)
+	if err != nil || actual == "" {
+		nd.add("kismatic", "version", KismaticVersion.String(), notSet)
+		return
+	}
+	if v, err := parseVersion(actual); err != nil || !v.Equals(KismaticVersion) {
+		nd.add("kismatic", "version", KismaticVersion.String(), actual)
+	}
+}
+
+func detectComponentDrift(nd *NodeDrift, client ssh.Client, c driftComponent, defaults DeploymentDefaults) {
+	out, err := client.Output(false, fmt.Sprintf("ps -C %s -o args=", c.name))
+	if err != nil || strings.TrimSpace(out) == "" {
+		nd.add(c.name, "process", "running", "not running")
+		return
+	}
+	actual := parseProcessFlags(out)
+
+	if image, ok := defaults.Images[c.image]; ok {
+		if v := componentVersion(c.name, client); v != image.Version {
+			nd.add(c.name, "version", image.Version, v)
+		}
+	}
+
+	// flags that are set on the node, but would not be deployed by the plan
+	for _, f := range sortedKeys(actual) {
+		_, isDefault := c.defaults[f]
+		_, isOverride := c.overrides[f]
+		if !isDefault && !isOverride {
+			nd.add(c.name, "--"+f, notSet, actual[f])
+		}
+	}
+	// flags that are set in the plan, or have a default that does not depend on the cluster
+	expected := map[string]string{}
+	for k, v := range c.defaults {
+		if !strings.Contains(v, "{{") && !strings.Contains(v, "{%") {
+			expected[k] = v
+		}
+	}
+	for k, v := range c.overrides {
+		expected[k] = v
+	}
+	for _, f := range sortedKeys(expected) {
+		want := expected[f]
+		got, ok := actual[f]
+		switch {
+		case want == "" && ok:
+			// empty options are not deployed
+			nd.add(c.name, "--"+f, notSet, got)
+		case want != "" && !ok:
+			nd.add(c.name, "--"+f, want, notSet)
+		case want != "" && got != want:
+			nd.add(c.name, "--"+f, want, got)
+		}
+	}
+}
+
+// componentVersion returns the version of the component that is running on the node
+func componentVersion(name string, client ssh.Client) string {
+	if name == "kubelet" {
+		// kubelet --version prints "Kubernetes v1.8.4"
+		out, err := client.Output(false, "kubelet --version")
+		fields := strings.Fields(out)
+		if err != nil || len(fields) == 0 {
+			return notSet
+		}
+		return fields[len(fields)-1]
+	}
+	out, err := client.Output(false, fmt.Sprintf("sudo docker ps -f status=running -f name=k8s_%s_ --format '{{.Image}}'", name))
+	image := strings.TrimSpace(strings.Split(strings.TrimSpace(out), "\n")[0])
+	if err != nil || image == "" {
+		return notSet
+	}
+	// the image might have been pulled from a private registry, so only the tag is compared
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// parseProcessFlags returns the --flag=value options of a process' command line
+func parseProcessFlags(args string) map[string]string {
+	flags := map[string]string{}
+	for _, arg := range strings.Fields(args) {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(kv) == 1 {
+			flags[kv[0]] = "true"
+			continue
+		}
+		flags[kv[0]] = kv[1]
+	}
+	return flags
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func detectLabelDrift(nd *NodeDrift, plan Plan, node Node, roles []string, registered map[string]data.Node) {
+	n, ok := registered[node.Host]
+	if !ok {
+		nd.add("labels", "", "registered", "node is not registered with Kubernetes")
+		return
+	}
+	expected := map[string]string{"kismatic/host": node.Host}
+	if contains("ingress", roles) {
+		expected["kismatic/ingress"] = "true"
+	}
+	if contains("storage", roles) {
+		expected["kismatic/storage"] = "true"
+	}
+	// a node might be listed under multiple roles with different labels
+	for _, pn := range plan.getAllNodes() {
+		if pn.Host != node.Host {
+			continue
+		}
+		for k, v := range pn.Labels {
+			expected[k] = v
+		}
+	}
+	for _, k := range sortedKeys(expected) {
+		got, ok := n.Labels[k]
+		if !ok {
+			got = notSet
+		}
+		if got != expected[k] {
+			nd.add("labels", k, expected[k], got)
+		}
+	}
+}
+
+func detectHostsFileDrift(nd *NodeDrift, plan Plan, client ssh.Client) {
+	out, err := client.Output(false, "cat /etc/hosts")
+	if err != nil {
+		nd.add("hosts file", "/etc/hosts", "readable", strings.TrimSpace(out))
+		return
+	}
+	actual := map[string]bool{}
+	inBlock := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch line {
+		case "# Kismatic hosts BEGIN":
+			inBlock = true
+			continue
+		case "# Kismatic hosts END":
+			inBlock = false
+			continue
+		}
+		if inBlock && line != "" {
+			actual[strings.Join(strings.Fields(line), " ")] = true
+		}
+	}
+	expected := map[string]bool{}
+	for _, n := range plan.GetUniqueNodes() {
+		ip := n.InternalIP
+		if ip == "" {
+			ip = n.IP
+		}
+		entry := fmt.Sprintf("%s %s", ip, n.Host)
+		expected[entry] = true
+		if !actual[entry] {
+			nd.add("hosts file", n.Host, entry, notSet)
+		}
+	}
+	for entry := range actual {
+		if !expected[entry] {
+			nd.add("hosts file", strings.Fields(entry)[len(strings.Fields(entry))-1], notSet, entry)
+		}
+	}
+}
+
+func detectRegistryDrift(nd *NodeDrift, plan Plan, client ssh.Client) {
+	b, err := ioutil.ReadFile(plan.DockerRegistry.CAPath)
+	if err != nil {
+		nd.add("docker registry", "ca.crt", "readable", fmt.Sprintf("error reading %q: %v", plan.DockerRegistry.CAPath, err))
+		return
+	}
+	expected := fmt.Sprintf("%x", sha256.Sum256(b))
+	file := fmt.Sprintf("/etc/docker/certs.d/%s/ca.crt", plan.DockerRegistry.Server)
+	out, err := client.Output(false, fmt.Sprintf("sudo sha256sum %s", file))
+	fields := strings.Fields(out)
+	if err != nil || len(fields) == 0 {
+		nd.add("docker registry", file, "sha256:"+expected, notSet)
+		return
+	}
+	if fields[0] != expected {
+		nd.add("docker registry", file, "sha256:"+expected, "sha256:"+fields[0])
+	}
+}
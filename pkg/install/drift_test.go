@@ -0,0 +1,135 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+type fakeNodeLister struct {
+	nodes *data.NodeList
+}
+
+func (f fakeNodeLister) ListNodes() (*data.NodeList, error) {
+	return f.nodes, nil
+}
+
+func driftTestDefaults() DeploymentDefaults {
+	d := DeploymentDefaults{
+		KubeletOptions: map[string]string{
+			"v":                 "2",
+			"hostname-override": "{{ inventory_hostname }}",
+			"cloud-provider":    "{{ cloud_provider }}",
+		},
+		ProxyOptions: map[string]string{
+			"proxy-mode": "iptables",
+		},
+	}
+	d.Images = map[string]struct {
+		Name    string
+		Version string
+	}{"kube_proxy": {Name: "gcr.io/google-containers/kube-proxy-amd64", Version: "v1.8.4"}}
+	return d
+}
+
+func findDifference(nd NodeDrift, component, setting string) *Difference {
+	for _, d := range nd.Differences {
+		if d.Component == component && d.Setting == setting {
+			return &d
+		}
+	}
+	return nil
+}
+
+func TestDetectDrift(t *testing.T) {
+	SetVersion("1.6.0")
+	p := Plan{
+		Cluster: Cluster{
+			KubeletOptions: KubeletOptions{Overrides: map[string]string{"max-pods": "50"}},
+			Networking:     NetworkConfig{UpdateHostsFiles: true},
+		},
+		Worker: NodeGroup{Nodes: []Node{
+			{
+				Host:           "worker01",
+				IP:             "10.0.0.1",
+				InternalIP:     "192.168.0.1",
+				Labels:         map[string]string{"team": "blue"},
+				KubeletOptions: KubeletOptions{Overrides: map[string]string{"v": "4"}},
+			},
+		}},
+	}
+	client := fakeSSHClient{
+		outputs: map[string]string{
+			"kismatic-version":  "1.5.3",
+			"ps -C kubelet":     "/usr/bin/kubelet --hostname-override=worker01 --max-pods=110 --v=4 --fail-swap-on=false",
+			"ps -C kube-proxy":  "kube-proxy --proxy-mode=iptables",
+			"kubelet --version": "Kubernetes v1.8.4",
+			"docker ps":         "gcr.io/google-containers/kube-proxy-amd64:v1.8.1",
+			"cat /etc/hosts":    "127.0.0.1 localhost\n# Kismatic hosts BEGIN\n192.168.0.1 worker01\n192.168.0.9 oldnode\n# Kismatic hosts END\n",
+			"sha256sum":         "",
+		},
+	}
+	kubeClient := fakeNodeLister{nodes: &data.NodeList{Items: []data.Node{
+		{ObjectMeta: data.ObjectMeta{Name: "worker01", Labels: map[string]string{"kismatic/host": "worker01"}}},
+	}}}
+	drift := DetectDrift(p, driftTestDefaults(), func(Node) (ssh.Client, error) { return client, nil }, kubeClient)
+	if len(drift) != 1 {
+		t.Fatalf("expected drift for 1 node, got %d", len(drift))
+	}
+	nd := drift[0]
+	if !nd.Drifted() {
+		t.Fatalf("expected node to have drifted")
+	}
+	tests := []struct {
+		component string
+		setting   string
+		expected  string
+		actual    string
+	}{
+		{"kismatic", "version", "1.6.0", "1.5.3"},
+		{"kubelet", "--max-pods", "50", "110"},
+		{"kubelet", "--fail-swap-on", notSet, "false"},
+		{"kube-proxy", "version", "v1.8.4", "v1.8.1"},
+		{"labels", "team", "blue", notSet},
+		{"hosts file", "oldnode", notSet, "192.168.0.9 oldnode"},
+	}
+	for _, test := range tests {
+		d := findDifference(nd, test.component, test.setting)
+		if d == nil {
+			t.Errorf("expected difference in %s %s, but found none. Differences: %+v", test.component, test.setting, nd.Differences)
+			continue
+		}
+		if d.Expected != test.expected || d.Actual != test.actual {
+			t.Errorf("%s %s: expected %q/%q, got %q/%q", test.component, test.setting, test.expected, test.actual, d.Expected, d.Actual)
+		}
+	}
+	// node level override matches, and templated defaults are not compared
+	for _, setting := range []string{"--v", "--hostname-override", "--proxy-mode"} {
+		if d := findDifference(nd, "kubelet", setting); d != nil {
+			t.Errorf("unexpected difference: %+v", d)
+		}
+	}
+	if d := findDifference(nd, "kubelet", "version"); d != nil {
+		t.Errorf("unexpected kubelet version difference: %+v", d)
+	}
+}
+
+func TestReadDeploymentDefaults(t *testing.T) {
+	ansibleDir := filepath.Join("..", "..", "ansible")
+	if _, err := os.Stat(ansibleDir); err != nil {
+		t.Skip("ansible directory not found")
+	}
+	d, err := ReadDeploymentDefaults(ansibleDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.APIServerOptions["secure-port"] == "" {
+		t.Errorf("expected API server defaults to be read")
+	}
+	if d.Images["kube_apiserver"].Version == "" {
+		t.Errorf("expected image versions to be read")
+	}
+}
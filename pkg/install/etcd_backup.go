@@ -0,0 +1,205 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+const (
+	etcdBackupManifestFile   = "manifest.json"
+	etcdK8sSnapshotFile      = "etcd-k8s.db"
+	etcdNetworkingBackupFile = "etcd-networking.tar.gz"
+	// the generated assets are copied into this directory of backups taken before upgrades
+	etcdBackupGeneratedAssetsDir = "generated"
+	// the location of the backup is recorded in this file of the run directory
+	etcdBackupLocationFile = "etcd-backup-location"
+)
+
+// EtcdBackupManifest describes the contents of an etcd backup
+type EtcdBackupManifest struct {
+	ClusterName     string    `json:"clusterName"`
+	KismaticVersion string    `json:"kismaticVersion"`
+	Members         []string  `json:"members"`
+	Timestamp       time.Time `json:"timestamp"`
+	// Networking is set when the backup includes the networking etcd cluster
+	Networking bool `json:"networking"`
+}
+
+// PrepareEtcdBackup finds a healthy etcd member to take the backup from, and returns
+// the manifest of the backup along with the member. When the networking etcd cluster
+// is backed up, the member must be healthy in both etcd clusters.
+func PrepareEtcdBackup(plan Plan, networking bool, sshClient func(Node) (ssh.Client, error)) (*EtcdBackupManifest, *Node, error) {
+	if networking && !plan.NetworkingEtcdEnabled() {
+		return nil, nil, errors.New("the networking etcd cluster is only deployed when the CNI provider is calico or contiv")
+	}
+	healthy, healthyNetworking, _ := checkEtcdMembersHealth(plan, sshClient)
+	if len(healthy) == 0 {
+		return nil, nil, errors.New("none of the etcd members are healthy")
+	}
+	if networking {
+		if healthy = intersectNodes(healthy, healthyNetworking); len(healthy) == 0 {
+			return nil, nil, errors.New("none of the etcd nodes is a healthy member of both the Kubernetes and the networking etcd clusters")
+		}
+	}
+	member := healthy[0]
+	client, err := sshClient(member)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := listEtcdMembers(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &EtcdBackupManifest{
+		ClusterName:     plan.Cluster.Name,
+		KismaticVersion: KismaticVersion.String(),
+		Timestamp:       time.Now().UTC(),
+		Networking:      networking,
+	}
+	for _, em := range members {
+		m.Members = append(m.Members, em.Name)
+	}
+	return m, &member, nil
+}
+
+// WriteEtcdBackupManifest writes the manifest into the backup directory
+func WriteEtcdBackupManifest(dir string, m EtcdBackupManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling backup manifest: %v", err)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, etcdBackupManifestFile), b, 0644)
+}
+
+// ReadEtcdBackup reads the manifest of the backup in the given directory, and verifies
+// that the backup files it describes are present and that it can be restored to the cluster
+func ReadEtcdBackup(plan Plan, dir string) (*EtcdBackupManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, etcdBackupManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup manifest: %v", err)
+	}
+	m := &EtcdBackupManifest{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("error unmarshalling backup manifest: %v", err)
+	}
+	files := []string{etcdK8sSnapshotFile}
+	if m.Networking {
+		files = append(files, etcdNetworkingBackupFile)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return nil, fmt.Errorf("backup file %q is missing: %v", f, err)
+		}
+	}
+	if m.ClusterName != plan.Cluster.Name {
+		return nil, fmt.Errorf("the backup was taken from cluster %q, but the plan file describes cluster %q", m.ClusterName, plan.Cluster.Name)
+	}
+	if m.Networking && !plan.NetworkingEtcdEnabled() {
+		return nil, errors.New("the backup includes the networking etcd cluster, but the plan file does not use calico or contiv")
+	}
+	return m, nil
+}
+
+// BackupEtcd takes a snapshot of the Kubernetes etcd cluster, and optionally a backup
+// of the networking etcd cluster, from the given member, and downloads them into the directory.
+func (ae *ansibleExecutor) BackupEtcd(plan Plan, member Node, dir string, networking bool) error {
+	util.PrintHeader(ae.stdout, "Backing Up Etcd", '=')
+	return ae.backupEtcd(plan, member, dir, networking, "etcd-backup")
+}
+
+// BackupBeforeUpgrade backs up the etcd clusters like BackupEtcd, and copies the generated
+// assets directory into the backup directory. The location of the backup is recorded
+// in the run directory of the backup, and in the run directories of the node upgrades
+// that follow it.
+func (ae *ansibleExecutor) BackupBeforeUpgrade(plan Plan, member Node, dir string, networking bool) error {
+	util.PrintHeader(ae.stdout, "Backing Up Etcd Before Upgrade", '=')
+	if err := ae.backupEtcd(plan, member, dir, networking, "upgrade-etcd-backup"); err != nil {
+		return err
+	}
+	if ae.options.DryRun {
+		return nil
+	}
+	if _, err := util.CopyDirectory(ae.options.GeneratedAssetsDirectory, filepath.Join(dir, etcdBackupGeneratedAssetsDir)); err != nil {
+		return fmt.Errorf("error backing up generated assets: %v", err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", dir, err)
+	}
+	ae.upgradeEtcdBackupDir = absDir
+	return nil
+}
+
+func (ae *ansibleExecutor) backupEtcd(plan Plan, member Node, dir string, networking bool, name string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", dir, err)
+	}
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.EtcdBackupDirectory = absDir
+	cc.EtcdBackupNetworking = networking
+	t := task{
+		name:           name,
+		playbook:       "etcd-backup.yaml",
+		plan:           plan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{member.Host},
+		runFiles:       map[string]string{etcdBackupLocationFile: absDir + "\n"},
+	}
+	if err = ae.execute(t); err != nil {
+		return fmt.Errorf("error backing up etcd: %v", err)
+	}
+	return nil
+}
+
+// RestoreEtcd rebuilds the Kubernetes etcd cluster, and optionally the networking etcd
+// cluster, on the etcd nodes in the plan from the backup in the given directory.
+// The API servers are restarted once the data is restored.
+func (ae *ansibleExecutor) RestoreEtcd(plan Plan, dir string, networking bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", dir, err)
+	}
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.EtcdBackupDirectory = absDir
+	cc.EtcdBackupNetworking = networking
+	util.PrintHeader(ae.stdout, "Restoring Etcd", '=')
+	t := task{
+		name:           "etcd-restore",
+		playbook:       "etcd-restore.yaml",
+		plan:           plan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+	}
+	if err = ae.execute(t); err != nil {
+		return fmt.Errorf("error restoring etcd: %v", err)
+	}
+	// The API servers cache the data they watch, so they are restarted to pick up the restored data
+	util.PrintHeader(ae.stdout, "Restarting API Servers", '=')
+	return ae.restartAPIServers(plan, plan.Master.Nodes, "etcd-restore-restart-apiserver", false)
+}
+
+// NetworkingEtcdEnabled returns true when the networking etcd cluster is deployed
+func (p Plan) NetworkingEtcdEnabled() bool {
+	return p.AddOns.CNI != nil && !p.AddOns.CNI.Disable &&
+		(p.AddOns.CNI.Provider == cniProviderCalico || p.AddOns.CNI.Provider == cniProviderContiv)
+}
@@ -0,0 +1,213 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestPrepareEtcdBackup(t *testing.T) {
+	plan := etcdMembersTestPlan()
+	plan.Cluster.Name = "test"
+	m, member, err := PrepareEtcdBackup(*plan, false, etcdSSHClients([]string{"etcd01"}, nil, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if member.Host != "etcd02" {
+		t.Errorf("expected the backup to be taken from the first healthy member etcd02, got %q", member.Host)
+	}
+	if m.ClusterName != "test" || len(m.Members) != 1 || m.Members[0] != "etcd01" {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+
+	if _, _, err = PrepareEtcdBackup(*plan, false, etcdSSHClients(nil, []string{"etcd01", "etcd02", "etcd03"}, nil)); err == nil {
+		t.Error("expected an error when no members are healthy, but didn't get one")
+	}
+	// the networking backup is taken from a member that is healthy in both clusters
+	_, member, err = PrepareEtcdBackup(*plan, true, etcdSSHClients(nil, nil, []string{"etcd01"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if member.Host != "etcd02" {
+		t.Errorf("expected the networking backup to be taken from etcd02, got %q", member.Host)
+	}
+	if _, _, err = PrepareEtcdBackup(*plan, true, etcdSSHClients(nil, nil, []string{"etcd01", "etcd02", "etcd03"})); err == nil {
+		t.Error("expected an error when no networking members are healthy, but didn't get one")
+	}
+	if _, _, err = PrepareEtcdBackup(*plan, false, etcdSSHClients(nil, nil, []string{"etcd01", "etcd02", "etcd03"})); err != nil {
+		t.Errorf("unexpected error backing up the Kubernetes etcd cluster while the networking members are unhealthy: %v", err)
+	}
+	noNetworking := *plan
+	noNetworking.AddOns.CNI = nil
+	if _, _, err = PrepareEtcdBackup(noNetworking, true, etcdSSHClients(nil, nil, nil)); err == nil {
+		t.Error("expected an error when backing up networking without calico or contiv, but didn't get one")
+	}
+}
+
+func TestReadEtcdBackup(t *testing.T) {
+	plan := etcdMembersTestPlan()
+	plan.Cluster.Name = "test"
+	tests := []struct {
+		name      string
+		manifest  EtcdBackupManifest
+		files     []string
+		cni       *CNI
+		expectErr bool
+	}{
+		{
+			name:     "kubernetes backup",
+			manifest: EtcdBackupManifest{ClusterName: "test"},
+			files:    []string{etcdK8sSnapshotFile},
+		},
+		{
+			name:      "snapshot missing",
+			manifest:  EtcdBackupManifest{ClusterName: "test"},
+			expectErr: true,
+		},
+		{
+			name:      "different cluster",
+			manifest:  EtcdBackupManifest{ClusterName: "other"},
+			files:     []string{etcdK8sSnapshotFile},
+			expectErr: true,
+		},
+		{
+			name:     "networking backup",
+			manifest: EtcdBackupManifest{ClusterName: "test", Networking: true},
+			files:    []string{etcdK8sSnapshotFile, etcdNetworkingBackupFile},
+			cni:      &CNI{Provider: cniProviderCalico},
+		},
+		{
+			name:      "networking backup without calico",
+			manifest:  EtcdBackupManifest{ClusterName: "test", Networking: true},
+			files:     []string{etcdK8sSnapshotFile, etcdNetworkingBackupFile},
+			cni:       &CNI{Provider: cniProviderWeave},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		dir := mustGetTempDir(t)
+		defer os.RemoveAll(dir)
+		test.manifest.Timestamp = time.Now().UTC().Truncate(time.Second)
+		if err := WriteEtcdBackupManifest(dir, test.manifest); err != nil {
+			t.Fatalf("%s: error writing manifest: %v", test.name, err)
+		}
+		for _, f := range test.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, f), []byte("data"), 0644); err != nil {
+				t.Fatalf("%s: error writing backup file: %v", test.name, err)
+			}
+		}
+		p := *plan
+		p.AddOns.CNI = test.cni
+		m, err := ReadEtcdBackup(p, dir)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, but didn't get one", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !m.Timestamp.Equal(test.manifest.Timestamp) || m.Networking != test.manifest.Networking {
+			t.Errorf("%s: expected manifest %+v, got %+v", test.name, test.manifest, *m)
+		}
+	}
+}
+
+func TestRestoreEtcdRestartsAPIServers(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	if err := e.RestoreEtcd(*etcdMembersTestPlan(), "backup", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"etcd-restore", "etcd-restore-restart-apiserver"} {
+		if _, err := os.Stat(filepath.Join(runsDir, name)); err != nil {
+			t.Errorf("expected task %q to run: %v", name, err)
+		}
+	}
+}
+
+func TestRestoreEtcdFailure(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+		certsDir:               mustGetTempDir(t),
+	}
+	if err := e.RestoreEtcd(*etcdMembersTestPlan(), "backup", false); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	if _, err := os.Stat(filepath.Join(runsDir, "etcd-restore-restart-apiserver")); err == nil {
+		t.Error("the API servers were restarted, even though the restore failed")
+	}
+}
+
+func TestBackupBeforeUpgrade(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	assetsDir := mustGetTempDir(t)
+	defer os.RemoveAll(assetsDir)
+	if err := ioutil.WriteFile(filepath.Join(assetsDir, "kubeconfig"), []byte("config"), 0644); err != nil {
+		t.Fatalf("error writing generated asset: %v", err)
+	}
+	backupDir := mustGetTempDir(t)
+	defer os.RemoveAll(backupDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir, GeneratedAssetsDirectory: assetsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	plan := etcdMembersTestPlan()
+	if err := e.BackupBeforeUpgrade(*plan, plan.Etcd.Nodes[0], backupDir, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, etcdBackupGeneratedAssetsDir, "kubeconfig")); err != nil {
+		t.Errorf("expected the generated assets to be copied into the backup: %v", err)
+	}
+	runs, err := filepath.Glob(filepath.Join(runsDir, "upgrade-etcd-backup", "*", etcdBackupLocationFile))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected the backup location to be recorded in the run directory, got %v: %v", runs, err)
+	}
+	b, err := ioutil.ReadFile(runs[0])
+	if err != nil {
+		t.Fatalf("error reading backup location: %v", err)
+	}
+	if strings.TrimSpace(string(b)) != backupDir {
+		t.Errorf("expected backup location %q, got %q", backupDir, string(b))
+	}
+
+	// the location is also recorded in the run directory of the upgrade it protects
+	nodes := []ListableNode{{Node: plan.Worker.Nodes[0], Roles: []string{"worker"}}}
+	if err = e.UpgradeNodes(*plan, [][]ListableNode{nodes}, false); err != nil {
+		t.Fatalf("unexpected error upgrading nodes: %v", err)
+	}
+	runs, err = filepath.Glob(filepath.Join(runsDir, "upgrade-nodes", "*", etcdBackupLocationFile))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected the backup location to be recorded in the run directory of the upgrade, got %v: %v", runs, err)
+	}
+	if b, err = ioutil.ReadFile(runs[0]); err != nil {
+		t.Fatalf("error reading backup location: %v", err)
+	}
+	if strings.TrimSpace(string(b)) != backupDir {
+		t.Errorf("expected backup location %q in the upgrade run directory, got %q", backupDir, string(b))
+	}
+}
@@ -0,0 +1,328 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// EtcdMembershipChange is a change to the members of the Kubernetes and networking
+// etcd clusters. When both are set, the member being removed leaves the clusters
+// before the new member joins them, which allows for replacing a failed member.
+type EtcdMembershipChange struct {
+	// Add is the node that joins the etcd clusters
+	Add *Node
+	// Remove is the node that leaves the etcd clusters
+	Remove *Node
+	// Member is a healthy member of the etcd clusters that is used to make the change
+	Member Node
+	// CleanupRemoved determines whether etcd is stopped and its data is removed
+	// from the node that leaves the clusters. Set when the node is reachable.
+	CleanupRemoved bool
+}
+
+// PlanEtcdMembershipChange checks the health of the etcd members defined in the plan,
+// and returns the change required for adding and/or removing the given nodes.
+// An error is returned if the change would drop the Kubernetes or the networking
+// etcd cluster below quorum.
+func PlanEtcdMembershipChange(plan Plan, add, remove *Node, sshClient func(Node) (ssh.Client, error)) (*EtcdMembershipChange, error) {
+	if err := checkEtcdMembershipChangePrereqs(plan, add, remove); err != nil {
+		return nil, err
+	}
+	change := &EtcdMembershipChange{Add: add, Remove: remove}
+	healthyK8s, healthyNetworking, reachable := checkEtcdMembersHealth(plan, sshClient)
+	if remove != nil {
+		change.CleanupRemoved = reachable[remove.Host]
+	}
+	if err := checkEtcdQuorum("Kubernetes", len(plan.Etcd.Nodes), healthyK8s, remove); err != nil {
+		return nil, err
+	}
+	healthy := healthyK8s
+	if plan.NetworkingEtcdEnabled() {
+		if err := checkEtcdQuorum("networking", len(plan.Etcd.Nodes), healthyNetworking, remove); err != nil {
+			return nil, err
+		}
+		// The change is made by a member of both clusters
+		healthy = intersectNodes(healthyK8s, healthyNetworking)
+	}
+	for _, n := range healthy {
+		if remove == nil || n.Host != remove.Host {
+			change.Member = n
+			break
+		}
+	}
+	if change.Member.Host == "" {
+		return nil, errors.New("none of the remaining etcd nodes is a healthy member of all the etcd clusters")
+	}
+	return change, nil
+}
+
+// checkEtcdMembersHealth returns the etcd nodes in the plan whose Kubernetes etcd member is healthy,
+// the ones whose networking etcd member is healthy, and whether each of the etcd nodes is reachable.
+// The networking etcd members are only checked when the networking etcd cluster is deployed.
+func checkEtcdMembersHealth(plan Plan, sshClient func(Node) (ssh.Client, error)) ([]Node, []Node, map[string]bool) {
+	var healthyK8s, healthyNetworking []Node
+	reachable := make(map[string]bool)
+	for _, n := range plan.Etcd.Nodes {
+		client, err := sshClient(n)
+		if err == nil {
+			_, err = client.Output(false, "true")
+		}
+		if err != nil {
+			continue
+		}
+		reachable[n.Host] = true
+		if checkEtcdHealth(client) == nil {
+			healthyK8s = append(healthyK8s, n)
+		}
+		if plan.NetworkingEtcdEnabled() && checkEtcdNetworkingHealth(client) == nil {
+			healthyNetworking = append(healthyNetworking, n)
+		}
+	}
+	return healthyK8s, healthyNetworking, reachable
+}
+
+// intersectNodes returns the nodes that are in both lists
+func intersectNodes(nodes, others []Node) []Node {
+	var both []Node
+	for _, n := range nodes {
+		for _, o := range others {
+			if n.Host == o.Host {
+				both = append(both, n)
+				break
+			}
+		}
+	}
+	return both
+}
+
+// the quorum of an etcd cluster is the majority of its members
+func etcdQuorum(members int) int {
+	return members/2 + 1
+}
+
+// checkEtcdQuorum verifies that the etcd cluster has quorum, and keeps it once the node is removed.
+// A cluster that has quorum keeps it when a member is added, as the new member is healthy once it joins.
+func checkEtcdQuorum(cluster string, members int, healthy []Node, remove *Node) error {
+	healthyCount := len(healthy)
+	if healthyCount < etcdQuorum(members) {
+		return fmt.Errorf("the %s etcd cluster has %d healthy members out of %d, which is below the quorum of %d", cluster, healthyCount, members, etcdQuorum(members))
+	}
+	if remove != nil {
+		if members == 1 {
+			return fmt.Errorf("node %q is the only member of the %s etcd cluster", remove.Host, cluster)
+		}
+		members--
+		for _, n := range healthy {
+			if n.Host == remove.Host {
+				healthyCount--
+			}
+		}
+		if healthyCount < etcdQuorum(members) {
+			return fmt.Errorf("removing node %q would leave the %s etcd cluster with %d healthy members out of %d, which is below the quorum of %d", remove.Host, cluster, healthyCount, members, etcdQuorum(members))
+		}
+	}
+	return nil
+}
+
+func checkEtcdMembershipChangePrereqs(plan Plan, add, remove *Node) error {
+	if add == nil && remove == nil {
+		return errors.New("no etcd nodes to add or remove")
+	}
+	// Contiv connects to a single member of the networking etcd cluster, which is not reconfigured
+	if plan.AddOns.CNI != nil && !plan.AddOns.CNI.Disable && plan.AddOns.CNI.Provider == cniProviderContiv {
+		return errors.New("the etcd members cannot be changed when the CNI provider is contiv")
+	}
+	if remove != nil {
+		found := false
+		for _, n := range plan.Etcd.Nodes {
+			if n.Host == remove.Host {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("node %q is not an etcd node in the plan file", remove.Host)
+		}
+	}
+	if add != nil {
+		for _, n := range plan.Etcd.Nodes {
+			if remove != nil && n.Host == remove.Host {
+				continue
+			}
+			if n.Host == add.Host || n.IP == add.IP {
+				return fmt.Errorf("node %q is already an etcd node in the plan file", add.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// ChangeEtcdMembers removes and/or adds members to the Kubernetes and networking etcd clusters,
+// and reconfigures the components that connect to etcd. If successful, the updated plan is returned.
+func (ae *ansibleExecutor) ChangeEtcdMembers(originalPlan *Plan, change EtcdMembershipChange) (*Plan, error) {
+	if err := checkEtcdMembershipChangePrereqs(*originalPlan, change.Add, change.Remove); err != nil {
+		return nil, err
+	}
+	updatedPlan := *originalPlan
+
+	if change.Remove != nil {
+		inventory := buildInventoryFromPlan(originalPlan)
+		cc, err := ae.buildClusterCatalog(originalPlan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+		}
+		cc.EtcdNode = change.Remove.Host
+		cc.EtcdMember = change.Member.Host
+		util.PrintHeader(ae.stdout, "Removing Etcd Member", '=')
+		t := task{
+			name:           "remove-etcd-member",
+			playbook:       "etcd-member-remove.yaml",
+			plan:           *originalPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          []string{change.Member.Host},
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error removing etcd member: %v", err)
+		}
+		if change.CleanupRemoved {
+			util.PrintHeader(ae.stdout, "Cleaning Up Etcd Node", '=')
+			t = task{
+				name:           "remove-etcd-cleanup",
+				playbook:       "_etcd-node-cleanup.yaml",
+				plan:           *originalPlan,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+				limit:          []string{change.Remove.Host},
+			}
+			if err = ae.execute(t); err != nil {
+				return nil, fmt.Errorf("error cleaning up etcd node: %v", err)
+			}
+		}
+		updatedPlan = removeEtcdFromPlan(updatedPlan, *change.Remove)
+	}
+
+	if change.Add != nil {
+		updatedPlan = addEtcdToPlan(updatedPlan, *change.Add)
+		util.PrintHeader(ae.stdout, "Generating Certificates For Etcd Node", '=')
+		ca, err := ae.pki.GetClusterCA()
+		if err != nil {
+			return nil, err
+		}
+		// A certificate left behind by a previous node with the same name is replaced
+		if _, err = ae.regenerateServerCertificates(updatedPlan, []Node{*change.Add}, "etcd", ca); err != nil {
+			return nil, err
+		}
+		if err = ae.pki.GenerateNodeCertificate(&updatedPlan, *change.Add, ca); err != nil {
+			return nil, fmt.Errorf("error generating certificates for new etcd node: %v", err)
+		}
+		inventory := buildInventoryFromPlan(&updatedPlan)
+		cc, err := ae.buildClusterCatalog(&updatedPlan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+		}
+		cc.EtcdNode = change.Add.Host
+		cc.EtcdMember = change.Member.Host
+		util.PrintHeader(ae.stdout, "Preparing Etcd Node", '=')
+		t := task{
+			name:           "add-etcd-node",
+			playbook:       "etcd-node.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          []string{change.Add.Host},
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error preparing etcd node: %v", err)
+		}
+		// The new member is announced by an existing member before it is started
+		util.PrintHeader(ae.stdout, "Adding Etcd Member", '=')
+		t = task{
+			name:           "add-etcd-member",
+			playbook:       "etcd-member-add.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			limit:          []string{change.Member.Host, change.Add.Host},
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error adding etcd member: %v", err)
+		}
+	}
+
+	if err := ae.reconfigureEtcdClients(updatedPlan); err != nil {
+		return nil, err
+	}
+	return &updatedPlan, nil
+}
+
+// reconfigureEtcdClients updates the hosts files and the components that connect to etcd
+// with the etcd members in the plan. The plan is marked as applied once they are updated.
+func (ae *ansibleExecutor) reconfigureEtcdClients(plan Plan) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	if plan.Cluster.Networking.UpdateHostsFiles {
+		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		t := task{
+			name:           "etcd-members-update-hosts",
+			playbook:       "_hosts.yaml",
+			plan:           plan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+		}
+		if err = ae.execute(t); err != nil {
+			return fmt.Errorf("error updating hosts files on all nodes: %v", err)
+		}
+	}
+
+	calico := plan.AddOns.CNI != nil && !plan.AddOns.CNI.Disable && plan.AddOns.CNI.Provider == cniProviderCalico
+	util.PrintHeader(ae.stdout, "Restarting API Servers", '=')
+	if err = ae.restartAPIServers(plan, plan.Master.Nodes, "etcd-members-restart-apiserver", !calico); err != nil {
+		return err
+	}
+	if calico {
+		util.PrintHeader(ae.stdout, "Updating Calico Etcd Endpoints", '=')
+		t := task{
+			name:           "etcd-members-calico",
+			playbook:       "_calico.yaml",
+			plan:           plan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+			appliesPlan:    true,
+		}
+		if err = ae.execute(t); err != nil {
+			return fmt.Errorf("error updating calico etcd endpoints: %v", err)
+		}
+	}
+	return nil
+}
+
+func addEtcdToPlan(plan Plan, etcd Node) Plan {
+	plan.Etcd.ExpectedCount++
+	plan.Etcd.Nodes = append(plan.Etcd.Nodes, etcd)
+	return plan
+}
+
+func removeEtcdFromPlan(plan Plan, etcd Node) Plan {
+	var nodes []Node
+	for _, n := range plan.Etcd.Nodes {
+		if n.Host != etcd.Host {
+			nodes = append(nodes, n)
+		}
+	}
+	plan.Etcd.ExpectedCount--
+	plan.Etcd.Nodes = nodes
+	return plan
+}
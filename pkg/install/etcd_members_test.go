@@ -0,0 +1,286 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+func etcdMembersTestPlan() *Plan {
+	return &Plan{
+		Cluster: Cluster{
+			Certificates: CertsConfig{Expiry: "1h"},
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+		Etcd: NodeGroup{
+			ExpectedCount: 3,
+			Nodes: []Node{
+				{Host: "etcd01", IP: "10.0.0.1"},
+				{Host: "etcd02", IP: "10.0.0.2"},
+				{Host: "etcd03", IP: "10.0.0.3"},
+			},
+		},
+		Master: MasterNodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "master01", IP: "10.0.0.4"}},
+		},
+		Worker: NodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "worker01", IP: "10.0.0.5"}},
+		},
+		AddOns: AddOns{
+			CNI: &CNI{Provider: cniProviderCalico},
+		},
+	}
+}
+
+// returns an SSH client factory for which the given nodes are unreachable,
+// and the etcd members on the other nodes are healthy unless listed as unhealthy.
+// The members of the networking etcd cluster can be unhealthy on their own.
+func etcdSSHClients(unreachable []string, unhealthy []string, unhealthyNetworking []string) func(Node) (ssh.Client, error) {
+	return func(n Node) (ssh.Client, error) {
+		if contains(n.Host, unreachable) {
+			return nil, errors.New("connection refused")
+		}
+		client := healthyNodeClient()
+		if contains(n.Host, unhealthy) {
+			client.outputs["/health"] = `{"health": "false"}`
+		}
+		if contains(n.Host, unhealthy) || contains(n.Host, unhealthyNetworking) {
+			client.outputs[":6666/health"] = `{"health": "false"}`
+		}
+		return client, nil
+	}
+}
+
+func TestPlanEtcdMembershipChange(t *testing.T) {
+	newNode := &Node{Host: "etcd04", IP: "10.0.0.6"}
+	tests := []struct {
+		name                string
+		cniProvider         string
+		add                 *Node
+		remove              *Node
+		unreachable         []string
+		unhealthy           []string
+		unhealthyNetworking []string
+		expectErr           bool
+		expectedMember      string
+		expectedCleanup     bool
+	}{
+		{
+			name:           "add to healthy cluster",
+			add:            newNode,
+			expectedMember: "etcd01",
+		},
+		{
+			name:        "add to cluster without quorum",
+			add:         newNode,
+			unreachable: []string{"etcd01"},
+			unhealthy:   []string{"etcd02"},
+			expectErr:   true,
+		},
+		{
+			name:            "remove healthy member",
+			remove:          &Node{Host: "etcd01", IP: "10.0.0.1"},
+			expectedMember:  "etcd02",
+			expectedCleanup: true,
+		},
+		{
+			name:      "remove healthy member while another member is unhealthy",
+			remove:    &Node{Host: "etcd01", IP: "10.0.0.1"},
+			unhealthy: []string{"etcd02"},
+			expectErr: true,
+		},
+		{
+			name:           "replace unreachable member",
+			add:            newNode,
+			remove:         &Node{Host: "etcd03", IP: "10.0.0.3"},
+			unreachable:    []string{"etcd03"},
+			expectedMember: "etcd01",
+		},
+		{
+			name:            "replace unhealthy member",
+			add:             newNode,
+			remove:          &Node{Host: "etcd01", IP: "10.0.0.1"},
+			unhealthy:       []string{"etcd01"},
+			expectedMember:  "etcd02",
+			expectedCleanup: true,
+		},
+		{
+			name:                "add to networking cluster without quorum",
+			add:                 newNode,
+			unhealthyNetworking: []string{"etcd01", "etcd02"},
+			expectErr:           true,
+		},
+		{
+			name:                "remove member while another networking member is unhealthy",
+			remove:              &Node{Host: "etcd01", IP: "10.0.0.1"},
+			unhealthyNetworking: []string{"etcd02"},
+			expectErr:           true,
+		},
+		{
+			name:                "change is made by a healthy member of both clusters",
+			add:                 newNode,
+			unhealthyNetworking: []string{"etcd01"},
+			expectedMember:      "etcd02",
+		},
+		{
+			name:                "networking cluster is not checked without calico or contiv",
+			cniProvider:         "weave",
+			add:                 newNode,
+			unhealthyNetworking: []string{"etcd01", "etcd02"},
+			expectedMember:      "etcd01",
+		},
+		{
+			name:        "contiv",
+			cniProvider: cniProviderContiv,
+			add:         newNode,
+			expectErr:   true,
+		},
+		{
+			name:      "not an etcd node",
+			remove:    &Node{Host: "worker01", IP: "10.0.0.5"},
+			expectErr: true,
+		},
+		{
+			name:      "already an etcd node",
+			add:       &Node{Host: "etcd02", IP: "10.0.0.2"},
+			expectErr: true,
+		},
+		{
+			name:      "nothing to change",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		plan := etcdMembersTestPlan()
+		if test.cniProvider != "" {
+			plan.AddOns.CNI.Provider = test.cniProvider
+		}
+		change, err := PlanEtcdMembershipChange(*plan, test.add, test.remove, etcdSSHClients(test.unreachable, test.unhealthy, test.unhealthyNetworking))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, but didn't get one", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if change.Member.Host != test.expectedMember {
+			t.Errorf("%s: expected %q to make the change, got %q", test.name, test.expectedMember, change.Member.Host)
+		}
+		if change.CleanupRemoved != test.expectedCleanup {
+			t.Errorf("%s: expected cleanup to be %v, got %v", test.name, test.expectedCleanup, change.CleanupRemoved)
+		}
+	}
+}
+
+func TestCheckEtcdQuorum(t *testing.T) {
+	nodes := etcdMembersTestPlan().Etcd.Nodes
+	tests := []struct {
+		members   int
+		healthy   []Node
+		remove    *Node
+		expectErr bool
+	}{
+		{members: 1, healthy: nodes[:1]},
+		{members: 1, healthy: nodes[:1], remove: &nodes[0], expectErr: true},
+		{members: 2, healthy: nodes[:2], remove: &nodes[0]},
+		{members: 2, healthy: nodes[:1], remove: &nodes[1], expectErr: true},
+		{members: 3, healthy: nodes[:2], remove: &nodes[2]},
+		{members: 3, healthy: nodes[:2], remove: &nodes[0], expectErr: true},
+		{members: 3, healthy: nodes[:1], expectErr: true},
+	}
+	for i, test := range tests {
+		err := checkEtcdQuorum("Kubernetes", test.members, test.healthy, test.remove)
+		if test.expectErr && err == nil {
+			t.Errorf("test %d: expected an error, but didn't get one", i)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestChangeEtcdMembersPlanIsUpdated(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{caExists: true},
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		certsDir:               mustGetTempDir(t),
+	}
+	originalPlan := etcdMembersTestPlan()
+	change := EtcdMembershipChange{
+		Add:    &Node{Host: "etcd04", IP: "10.0.0.6"},
+		Remove: &originalPlan.Etcd.Nodes[0],
+		Member: originalPlan.Etcd.Nodes[1],
+	}
+	updatedPlan, err := e.ChangeEtcdMembers(originalPlan, change)
+	if err != nil {
+		t.Fatalf("unexpected error while changing etcd members: %v", err)
+	}
+	if updatedPlan.Etcd.ExpectedCount != 3 {
+		t.Errorf("expected count should be unchanged after replacing a member, got %d", updatedPlan.Etcd.ExpectedCount)
+	}
+	var hosts []string
+	for _, n := range updatedPlan.Etcd.Nodes {
+		hosts = append(hosts, n.Host)
+	}
+	if len(hosts) != 3 || contains("etcd01", hosts) || !contains("etcd04", hosts) {
+		t.Errorf("expected etcd01 to be replaced by etcd04, got %v", hosts)
+	}
+	if originalPlan.Etcd.Nodes[0].Host != "etcd01" {
+		t.Errorf("the original plan was modified")
+	}
+	// the removed node was unreachable, so it is not cleaned up
+	if _, err := os.Stat(filepath.Join(runsDir, "remove-etcd-cleanup")); err == nil {
+		t.Errorf("the removed node was cleaned up, even though it was not requested")
+	}
+	applied, err := LastAppliedPlan(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error getting applied plan: %v", err)
+	}
+	if len(applied.Etcd.Nodes) != 3 || applied.Etcd.Nodes[2].Host != "etcd04" {
+		t.Errorf("expected the applied plan to include the new etcd node, got %v", applied.Etcd.Nodes)
+	}
+}
+
+func TestChangeEtcdMembersPlanNotUpdatedAfterFailure(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	originalPlan := etcdMembersTestPlan()
+	change := EtcdMembershipChange{
+		Remove:         &originalPlan.Etcd.Nodes[0],
+		Member:         originalPlan.Etcd.Nodes[1],
+		CleanupRemoved: true,
+	}
+	updatedPlan, err := e.ChangeEtcdMembers(originalPlan, change)
+	if err == nil {
+		t.Errorf("expected an error, but didn't get one")
+	}
+	if updatedPlan != nil {
+		t.Error("plan was updated, even though removing the etcd member failed")
+	}
+	if _, err := os.Stat(filepath.Join(runsDir, "remove-etcd-cleanup")); err == nil {
+		t.Error("the node was cleaned up, even though removing the etcd member failed")
+	}
+}
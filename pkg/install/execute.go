@@ -1,18 +1,21 @@
 package install
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"time"
 
 	"strings"
 
 	"github.com/apprenda/kismatic/pkg/ansible"
 	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/junit"
 	"github.com/apprenda/kismatic/pkg/tls"
 	"github.com/apprenda/kismatic/pkg/util"
 )
@@ -22,6 +25,8 @@ import (
 type PreFlightExecutor interface {
 	RunPreFlightCheck(*Plan) error
 	RunNewWorkerPreFlightCheck(Plan, Node) error
+	RunNewNodePreFlightCheck(Plan, Node, string) error
+	RunNewMasterPreFlightCheck(Plan, Node) error
 	RunUpgradePreFlightCheck(*Plan, ListableNode) error
 }
 
@@ -32,10 +37,27 @@ type Executor interface {
 	GenerateCertificates(p *Plan, useExistingCA bool) error
 	RunSmokeTest(*Plan) error
 	AddWorker(*Plan, Node) (*Plan, error)
+	AddNode(*Plan, Node, string) (*Plan, error)
+	RemoveWorker(*Plan, Node) (*Plan, error)
+	AddMaster(*Plan, Node) (*Plan, error)
+	RemoveMaster(*Plan, Node) (*Plan, error)
+	ChangeEtcdMembers(*Plan, EtcdMembershipChange) (*Plan, error)
+	BackupEtcd(plan Plan, member Node, dir string, networking bool) error
+	BackupBeforeUpgrade(plan Plan, member Node, dir string, networking bool) error
+	RestoreEtcd(plan Plan, dir string, networking bool) error
+	Reconcile(*Plan) error
+	DeployCertificates(plan Plan, opts DeployCertificatesOptions) error
+	Reset(p *Plan, nodes []Node, keepPackages bool) error
 	RunPlay(string, *Plan) error
 	AddVolume(*Plan, StorageVolume) error
 	DeleteVolume(*Plan, string) error
-	UpgradeNodes(plan Plan, nodesToUpgrade []ListableNode, onlineUpgrade bool, maxParallelWorkers int) error
+	UpgradeNodes(plan Plan, batches [][]ListableNode, onlineUpgrade bool) error
+	RunUpgradeWaveHooks(plan Plan, wave HookWave) error
+	RollbackNode(plan Plan, node Node) error
+	RemoveUpgradeBackup(plan Plan, node Node) error
+	PrePullUpgrade(plan Plan, nodes []ListableNode) ([]NodePrePullResult, error)
+	DrainNode(plan Plan, node Node) error
+	UncordonNode(plan Plan, node Node) error
 	ValidateControlPlane(plan Plan) error
 	UpgradeClusterServices(plan Plan) error
 }
@@ -63,6 +85,11 @@ type ExecutorOptions struct {
 	DiagnosticsDirecty string
 	// DryRun determines if the executor should actually run the task
 	DryRun bool
+	// Report collects the outcome of the tasks run by the executor, when set
+	Report *junit.Report
+	// PlanFile is the plan file the cluster is configured from. The hash of its
+	// contents is recorded on the nodes, when set.
+	PlanFile string
 }
 
 // NewExecutor returns an executor for performing installations according to the installation plan.
@@ -166,6 +193,9 @@ type ansibleExecutor struct {
 	ansibleDir          string
 	certsDir            string
 	pki                 PKI
+	// the location of the etcd backup taken before the upgrade, which is
+	// recorded in the run directories of the upgrade
+	upgradeEtcdBackupDir string
 
 	// Hook for testing purposes.. default implementation is used at runtime
 	runnerExplainerFactory func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error)
@@ -186,6 +216,33 @@ type task struct {
 	plan Plan
 	// run the task on specific nodes
 	limit []string
+	// lifecycle events that are fired before and after the playbook runs.
+	// The on-failure event is fired if either of these is set and the task fails.
+	preHookEvent  string
+	postHookEvent string
+	// the nodes that are reported to node-level hooks
+	hookNodes []Node
+	// the cluster is in the state described by the plan once the task succeeds
+	appliesPlan bool
+	// files that are recorded in the run directory, keyed by file name
+	runFiles map[string]string
+}
+
+// planHash returns the hash of the plan file that the task's plan was read from.
+// A task that changes the plan, such as adding a node, does not run the plan in the
+// plan file. The plan file is rewritten with the recorded plan once such a task
+// succeeds, so the recorded plan is hashed instead.
+func (ae *ansibleExecutor) planHash(plan Plan, recorded []byte) string {
+	planBytes := recorded
+	if ae.options.PlanFile != "" {
+		fp := FilePlanner{File: ae.options.PlanFile}
+		if p, err := fp.Read(); err == nil && reflect.DeepEqual(*p, plan) {
+			if b, err := ioutil.ReadFile(fp.File); err == nil {
+				planBytes = b
+			}
+		}
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(planBytes))
 }
 
 // execute will run the given task, and setup all what's needed for us to run ansible.
@@ -204,16 +261,36 @@ func (ae *ansibleExecutor) execute(t task) error {
 	if err = fp.Write(&t.plan); err != nil {
 		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
 	}
+	planBytes, err := ioutil.ReadFile(fp.File)
+	if err != nil {
+		return fmt.Errorf("error reading recorded plan file %s: %v", fp.File, err)
+	}
+	t.clusterCatalog.PlanHash = ae.planHash(t.plan, planBytes)
+	t.clusterCatalog.RunID = runID(ae.options.RunsDirectory, runDirectory)
+	for name, contents := range t.runFiles {
+		if err = ioutil.WriteFile(filepath.Join(runDirectory, name), []byte(contents), 0644); err != nil {
+			return fmt.Errorf("error recording %s: %v", name, err)
+		}
+	}
 	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
 	ansibleLogFile, err := os.Create(ansibleLogFilename)
 	if err != nil {
 		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
 	}
+	if ae.options.Report != nil {
+		t.explainer = explain.JUnitExplainer(t.name, ae.options.Report, t.explainer)
+	}
 	runner, explainer, err := ae.ansibleRunnerWithExplainer(t.explainer, ansibleLogFile, runDirectory)
 	if err != nil {
 		return err
 	}
 
+	if t.preHookEvent != "" {
+		if err = runHooks(ae.stdout, t.plan, t.preHookEvent, t.hookNodes, runDirectory, nil); err != nil {
+			return ae.taskFailed(t, runDirectory, err)
+		}
+	}
+
 	// Start running ansible with the given playbook
 	var eventStream <-chan ansible.Event
 	if t.limit != nil && len(t.limit) != 0 {
@@ -222,7 +299,7 @@ func (ae *ansibleExecutor) execute(t task) error {
 		eventStream, err = runner.StartPlaybook(t.playbook, t.inventory, t.clusterCatalog)
 	}
 	if err != nil {
-		return fmt.Errorf("error running ansible playbook: %v", err)
+		return ae.taskFailed(t, runDirectory, fmt.Errorf("error running ansible playbook: %v", err))
 	}
 	// Ansible blocks until explainer starts reading from stream. Start
 	// explainer in a separate go routine
@@ -230,11 +307,36 @@ func (ae *ansibleExecutor) execute(t task) error {
 
 	// Wait until ansible exits
 	if err = runner.WaitPlaybook(); err != nil {
-		return fmt.Errorf("error running playbook: %v", err)
+		return ae.taskFailed(t, runDirectory, fmt.Errorf("error running playbook: %v", err))
+	}
+
+	if t.postHookEvent != "" {
+		if err = runHooks(ae.stdout, t.plan, t.postHookEvent, t.hookNodes, runDirectory, nil); err != nil {
+			return ae.taskFailed(t, runDirectory, err)
+		}
+	}
+	if t.appliesPlan {
+		// Mark the recorded plan as applied, so that it can be used for reconciling the cluster
+		if err = ioutil.WriteFile(filepath.Join(runDirectory, appliedPlanMarker), nil, 0644); err != nil {
+			return fmt.Errorf("error marking plan as applied: %v", err)
+		}
 	}
 	return nil
 }
 
+// taskFailed fires the on-failure hooks if the task has lifecycle events, and
+// returns the original error. Errors returned by the on-failure hooks are printed
+// but do not replace the original error.
+func (ae *ansibleExecutor) taskFailed(t task, runDirectory string, taskErr error) error {
+	if t.preHookEvent == "" && t.postHookEvent == "" {
+		return taskErr
+	}
+	if err := runHooks(ae.stdout, t.plan, HookEventOnFailure, t.hookNodes, runDirectory, taskErr); err != nil {
+		util.PrettyPrintErr(ae.stdout, "Running %s hooks: %v", HookEventOnFailure, err)
+	}
+	return taskErr
+}
+
 // GenerateCertificatesprivate generates keys and certificates for the cluster, if needed
 func (ae *ansibleExecutor) GenerateCertificates(p *Plan, useExistingCA bool) error {
 	if err := os.MkdirAll(ae.certsDir, 0777); err != nil {
@@ -290,6 +392,9 @@ func (ae *ansibleExecutor) Install(p *Plan) error {
 		inventory:      buildInventoryFromPlan(p),
 		clusterCatalog: *cc,
 		explainer:      ae.defaultExplainer(),
+		preHookEvent:   HookEventPreInstall,
+		postHookEvent:  HookEventPostInstall,
+		appliesPlan:    true,
 	}
 	util.PrintHeader(ae.stdout, "Installing Cluster", '=')
 	return ae.execute(t)
@@ -335,6 +440,37 @@ func (ae *ansibleExecutor) RunPreFlightCheck(p *Plan) error {
 
 // RunNewWorkerPreFlightCheck runs the preflight checks against a new worker node
 func (ae *ansibleExecutor) RunNewWorkerPreFlightCheck(p Plan, node Node) error {
+	return ae.RunNewNodePreFlightCheck(p, node, "worker")
+}
+
+// RunNewNodePreFlightCheck runs the preflight checks against a new node with the given role
+func (ae *ansibleExecutor) RunNewNodePreFlightCheck(p Plan, node Node, role string) error {
+	cc, err := ae.buildClusterCatalog(&p)
+	if err != nil {
+		return err
+	}
+	cc, err = setPreflightOptions(p, *cc)
+	if err != nil {
+		return err
+	}
+	p, err = addNodeToPlan(p, node, role)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "add-" + role + "-preflight",
+		playbook:       "preflight.yaml",
+		inventory:      buildInventoryFromPlan(&p),
+		clusterCatalog: *cc,
+		explainer:      ae.preflightExplainer(),
+		plan:           p,
+		limit:          []string{node.Host},
+	}
+	return ae.execute(t)
+}
+
+// RunNewMasterPreFlightCheck runs the preflight checks against a new master node
+func (ae *ansibleExecutor) RunNewMasterPreFlightCheck(p Plan, node Node) error {
 	cc, err := ae.buildClusterCatalog(&p)
 	if err != nil {
 		return err
@@ -343,10 +479,10 @@ func (ae *ansibleExecutor) RunNewWorkerPreFlightCheck(p Plan, node Node) error {
 	if err != nil {
 		return err
 	}
-	p.Worker.ExpectedCount++
-	p.Worker.Nodes = append(p.Worker.Nodes, node)
+	p.Master.ExpectedCount++
+	p.Master.Nodes = append(p.Master.Nodes, node)
 	t := task{
-		name:           "add-worker-preflight",
+		name:           "add-master-preflight",
 		playbook:       "preflight.yaml",
 		inventory:      buildInventoryFromPlan(&p),
 		clusterCatalog: *cc,
@@ -473,7 +609,8 @@ func (ae *ansibleExecutor) DeleteVolume(plan *Plan, name string) error {
 	return ae.execute(t)
 }
 
-// UpgradeNodes upgrades the nodes of the cluster in the following phases:
+// UpgradeNodes upgrades the nodes of the cluster one batch at a time, in the order given by
+// UpgradeBatches or ReplicaAwareUpgradeBatches:
 //   1. Etcd nodes
 //   2. Master nodes
 //   3. Worker nodes (regardless of specialization)
@@ -481,66 +618,27 @@ func (ae *ansibleExecutor) DeleteVolume(plan *Plan, name string) error {
 // When a node is being upgraded, all the components of the node are upgraded, regardless of
 // which phase of the upgrade we are in. For example, when upgrading a node that is both an etcd and master,
 // the etcd components and the master components will be upgraded when we are in the upgrade etcd nodes
-// phase.
-func (ae *ansibleExecutor) UpgradeNodes(plan Plan, nodesToUpgrade []ListableNode, onlineUpgrade bool, maxParallelWorkers int) error {
-	// Nodes can have multiple roles. For this reason, we need to keep track of which nodes
-	// have been upgraded to avoid re-upgrading them.
-	upgradedNodes := map[string]bool{}
-	// Upgrade etcd nodes
-	for _, nodeToUpgrade := range nodesToUpgrade {
-		for _, role := range nodeToUpgrade.Roles {
-			if role == "etcd" {
-				node := nodeToUpgrade
-				if err := ae.upgradeNodes(plan, onlineUpgrade, node); err != nil {
-					return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
+// phase. The nodes in a batch are upgraded in parallel.
+func (ae *ansibleExecutor) UpgradeNodes(plan Plan, batches [][]ListableNode, onlineUpgrade bool) error {
+	for _, batch := range batches {
+		if err := ae.upgradeNodes(plan, onlineUpgrade, batch...); err != nil {
+			return fmt.Errorf("error upgrading node %q: %v", batch[len(batch)-1].Node.Host, err)
 		}
 	}
+	return nil
+}
 
-	// Upgrade master nodes
-	for _, nodeToUpgrade := range nodesToUpgrade {
-		if upgradedNodes[nodeToUpgrade.Node.IP] == true {
-			continue
-		}
-		for _, role := range nodeToUpgrade.Roles {
-			if role == "master" {
-				node := nodeToUpgrade
-				if err := ae.upgradeNodes(plan, onlineUpgrade, node); err != nil {
-					return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
-		}
+// RunUpgradeWaveHooks fires the pre-upgrade-wave hooks. A failed hook stops the upgrade
+// before the wave is upgraded.
+func (ae *ansibleExecutor) RunUpgradeWaveHooks(plan Plan, wave HookWave) error {
+	if ae.options.DryRun || len(hooksForEvent(plan.Hooks, HookEventPreUpgradeWave)) == 0 {
+		return nil
 	}
-
-	var limitNodes []ListableNode
-	// Upgrade the rest of the nodes
-	for n, nodeToUpgrade := range nodesToUpgrade {
-		if upgradedNodes[nodeToUpgrade.Node.IP] == true {
-			continue
-		}
-		for _, role := range nodeToUpgrade.Roles {
-			if role != "etcd" && role != "master" {
-				node := nodeToUpgrade
-				limitNodes = append(limitNodes, node)
-				// don't forget to run the remaining nodes if its < maxParallelWorkers
-				if len(limitNodes) == maxParallelWorkers || n == len(nodesToUpgrade)-1 {
-					if err := ae.upgradeNodes(plan, onlineUpgrade, limitNodes...); err != nil {
-						return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-					}
-					// empty the slice
-					limitNodes = limitNodes[:0]
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
-		}
+	runDirectory, err := ae.createRunDirectory("upgrade-wave")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for %q: %v", "upgrade-wave", err)
 	}
-	return nil
+	return runWaveHooks(ae.stdout, plan, wave, runDirectory)
 }
 
 func (ae *ansibleExecutor) upgradeNodes(plan Plan, onlineUpgrade bool, nodes ...ListableNode) error {
@@ -551,9 +649,11 @@ func (ae *ansibleExecutor) upgradeNodes(plan Plan, onlineUpgrade bool, nodes ...
 	}
 	cc.OnlineUpgrade = onlineUpgrade
 	var limit []string
+	var hookNodes []Node
 	nodeRoles := make(map[string][]string)
 	for _, node := range nodes {
 		limit = append(limit, node.Node.Host)
+		hookNodes = append(hookNodes, node.Node)
 		nodeRoles[node.Node.Host] = node.Roles
 	}
 	t := task{
@@ -564,6 +664,12 @@ func (ae *ansibleExecutor) upgradeNodes(plan Plan, onlineUpgrade bool, nodes ...
 		plan:           plan,
 		explainer:      ae.defaultExplainer(),
 		limit:          limit,
+		preHookEvent:   HookEventPreNodeUpgrade,
+		postHookEvent:  HookEventPostNodeUpgrade,
+		hookNodes:      hookNodes,
+	}
+	if ae.upgradeEtcdBackupDir != "" {
+		t.runFiles = map[string]string{etcdBackupLocationFile: ae.upgradeEtcdBackupDir + "\n"}
 	}
 	if len(limit) == 1 {
 		util.PrintHeader(ae.stdout, fmt.Sprintf("Upgrade Node: %s %s", limit, nodes[0].Roles), '=')
@@ -582,7 +688,7 @@ func (ae *ansibleExecutor) ValidateControlPlane(plan Plan) error {
 	}
 	t := task{
 		name:           "validate-control-plane",
-		playbook:       "validate-control-plane.yaml",
+		playbook:       "_validate-control-plane-node.yaml",
 		inventory:      inventory,
 		clusterCatalog: *cc,
 		plan:           plan,
@@ -635,6 +741,10 @@ func (ae *ansibleExecutor) buildClusterCatalog(p *Plan) (*ansible.ClusterCatalog
 	if err != nil {
 		return nil, fmt.Errorf("failed to determine absolute path to %s: %v", ae.certsDir, err)
 	}
+	caFile, err := caTrustFilename("ca", ae.certsDir)
+	if err != nil {
+		return nil, err
+	}
 
 	dnsIP, err := getDNSServiceIP(p)
 	if err != nil {
@@ -645,6 +755,7 @@ func (ae *ansibleExecutor) buildClusterCatalog(p *Plan) (*ansible.ClusterCatalog
 		ClusterName:                  p.Cluster.Name,
 		AdminPassword:                p.Cluster.AdminPassword,
 		TLSDirectory:                 tlsDir,
+		TLSCAFile:                    caFile,
 		ServicesCIDR:                 p.Cluster.Networking.ServiceCIDRBlock,
 		PodCIDR:                      p.Cluster.Networking.PodCIDRBlock,
 		DNSServiceIP:                 dnsIP,
@@ -795,6 +906,15 @@ func (ae *ansibleExecutor) createRunDirectory(runName string) (string, error) {
 	return runDirectory, nil
 }
 
+// runID identifies a run by the path of its directory, relative to the runs directory
+func runID(runsDirectory, runDirectory string) string {
+	id, err := filepath.Rel(runsDirectory, runDirectory)
+	if err != nil {
+		return filepath.Base(runDirectory)
+	}
+	return filepath.ToSlash(id)
+}
+
 func (ae *ansibleExecutor) ansibleRunnerWithExplainer(explainer explain.AnsibleEventExplainer, ansibleLog io.Writer, runDirectory string) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
 	if ae.runnerExplainerFactory != nil {
 		return ae.runnerExplainerFactory(explainer, ansibleLog)
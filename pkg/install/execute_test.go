@@ -0,0 +1,70 @@
+package install
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanHash(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	// The plan file is written by hand, and is not what the planner would write
+	planFile := filepath.Join(dir, "kismatic-cluster.yaml")
+	planBytes := []byte(`# my cluster
+cluster:
+  name: kubernetes
+worker:
+  expected_count: 1
+  nodes:
+  - host: worker01
+    ip: 10.0.0.3
+`)
+	if err := ioutil.WriteFile(planFile, planBytes, 0644); err != nil {
+		t.Fatalf("error writing plan file: %v", err)
+	}
+	fp := FilePlanner{File: planFile}
+	plan, err := fp.Read()
+	if err != nil {
+		t.Fatalf("error reading plan file: %v", err)
+	}
+	changed := *plan
+	changed.Worker.Nodes = append([]Node{}, plan.Worker.Nodes...)
+	changed.Worker.Nodes = append(changed.Worker.Nodes, Node{Host: "worker02", IP: "10.0.0.4"})
+	recorded := []byte("recorded plan")
+
+	tests := []struct {
+		name     string
+		planFile string
+		plan     Plan
+		expected []byte
+	}{
+		{
+			name:     "plan file is hashed",
+			planFile: planFile,
+			plan:     *plan,
+			expected: planBytes,
+		},
+		{
+			name:     "changed plan is hashed as recorded",
+			planFile: planFile,
+			plan:     changed,
+			expected: recorded,
+		},
+		{
+			name:     "recorded plan is hashed without a plan file",
+			plan:     *plan,
+			expected: recorded,
+		},
+	}
+	for _, test := range tests {
+		ae := ansibleExecutor{options: ExecutorOptions{PlanFile: test.planFile}}
+		hash := ae.planHash(test.plan, recorded)
+		if expected := fmt.Sprintf("%x", sha256.Sum256(test.expected)); hash != expected {
+			t.Errorf("%s: expected hash %s, but got %s", test.name, expected, hash)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/inspector/rule"
+	"github.com/apprenda/kismatic/pkg/junit"
+)
+
+// JUnitExplainer records the outcome of the tasks in the report, and passes
+// the events along to the given explainer. The results of each host are
+// recorded in a separate test suite, named after the phase and the host. When
+// a task produces inspector rule results, a test case is recorded per rule.
+func JUnitExplainer(phase string, report *junit.Report, explainer AnsibleEventExplainer) AnsibleEventExplainer {
+	return &junitExplainer{
+		phase:     phase,
+		report:    report,
+		explainer: explainer,
+	}
+}
+
+type junitExplainer struct {
+	phase       string
+	report      *junit.Report
+	explainer   AnsibleEventExplainer
+	currentPlay string
+	currentTask string
+	taskStart   time.Time
+}
+
+func (exp *junitExplainer) ExplainEvent(ansibleEvent ansible.Event) {
+	switch event := ansibleEvent.(type) {
+	case *ansible.PlayStartEvent:
+		exp.currentPlay = event.Name
+	case *ansible.TaskStartEvent:
+		exp.currentTask = event.Name
+		exp.taskStart = time.Now()
+	case *ansible.HandlerTaskStartEvent:
+		exp.currentTask = event.Name
+		exp.taskStart = time.Now()
+	case *ansible.RunnerOKEvent:
+		exp.record(event.Host, event.Result.Stdout, nil, nil)
+	case *ansible.RunnerFailedEvent:
+		if event.IgnoreErrors {
+			exp.record(event.Host, event.Result.Stdout, nil, nil)
+			break
+		}
+		exp.record(event.Host, event.Result.Stdout, &junit.Failure{
+			Message:  failureMessage(event.Result.Message, event.Result.Stderr),
+			Contents: event.Result.Stdout,
+		}, nil)
+	case *ansible.RunnerUnreachableEvent:
+		exp.record(event.Host, "", &junit.Failure{Message: "host is unreachable: " + event.Result.Message}, nil)
+	case *ansible.RunnerSkippedEvent:
+		exp.record(event.Host, "", nil, &junit.Skipped{})
+	}
+	if exp.explainer != nil {
+		exp.explainer.ExplainEvent(ansibleEvent)
+	}
+}
+
+func (exp *junitExplainer) record(host, stdout string, failure *junit.Failure, skipped *junit.Skipped) {
+	suite := fmt.Sprintf("%s: %s", exp.phase, host)
+	elapsed := time.Since(exp.taskStart).Seconds()
+	if exp.taskStart.IsZero() {
+		elapsed = 0
+	}
+	results := []rule.Result{}
+	if err := json.Unmarshal([]byte(stdout), &results); err == nil && len(results) > 0 {
+		for _, r := range results {
+			tc := junit.TestCase{Name: r.Name, ClassName: exp.currentTask}
+			if !r.Success {
+				tc.Failure = &junit.Failure{Message: r.Error, Contents: r.Remediation}
+			}
+			exp.report.AddTestCase(suite, tc)
+		}
+		return
+	}
+	exp.report.AddTestCase(suite, junit.TestCase{
+		Name:      exp.currentTask,
+		ClassName: exp.currentPlay,
+		Time:      elapsed,
+		Failure:   failure,
+		Skipped:   skipped,
+	})
+}
+
+func failureMessage(msgs ...string) string {
+	for _, m := range msgs {
+		if m = strings.TrimSpace(m); m != "" {
+			return m
+		}
+	}
+	return "task failed"
+}
@@ -0,0 +1,234 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// Lifecycle events that can trigger a hook
+const (
+	HookEventPreInstall       = "pre-install"
+	HookEventPostInstall      = "post-install"
+	HookEventPreNodeUpgrade   = "pre-node-upgrade"
+	HookEventPostNodeUpgrade  = "post-node-upgrade"
+	HookEventPreUpgradeWave   = "pre-upgrade-wave"
+	HookEventPreAddWorker     = "pre-add-worker"
+	HookEventPostAddWorker    = "post-add-worker"
+	HookEventPreRemoveWorker  = "pre-remove-worker"
+	HookEventPostRemoveWorker = "post-remove-worker"
+	HookEventOnFailure        = "on-failure"
+
+	defaultHookTimeout = "5m"
+)
+
+func hookEvents() []string {
+	return []string{
+		HookEventPreInstall,
+		HookEventPostInstall,
+		HookEventPreNodeUpgrade,
+		HookEventPostNodeUpgrade,
+		HookEventPreUpgradeWave,
+		HookEventPreAddWorker,
+		HookEventPostAddWorker,
+		HookEventPreRemoveWorker,
+		HookEventPostRemoveWorker,
+		HookEventOnFailure,
+	}
+}
+
+// HookPayload is the JSON document that is sent to a hook when it is fired
+type HookPayload struct {
+	// Event that triggered the hook
+	Event string `json:"event"`
+	// Cluster is the name of the cluster
+	Cluster string `json:"cluster"`
+	// Node that the event refers to. Not set for cluster-wide events.
+	Node *HookNode `json:"node,omitempty"`
+	// Wave of a staged upgrade that the event refers to. Only set for pre-upgrade-wave events.
+	Wave *HookWave `json:"wave,omitempty"`
+	// RunDirectory is the directory where the logs of the operation are kept
+	RunDirectory string `json:"run_directory"`
+	// Error that caused the operation to fail. Only set for on-failure events.
+	Error string `json:"error,omitempty"`
+}
+
+// HookNode describes the node that a hook event refers to
+type HookNode struct {
+	Host       string   `json:"host"`
+	IP         string   `json:"ip"`
+	InternalIP string   `json:"internal_ip,omitempty"`
+	Roles      []string `json:"roles"`
+}
+
+// HookWave describes the wave of a staged upgrade that is about to be upgraded
+type HookWave struct {
+	// Number of the wave, starting at 1
+	Number int `json:"number"`
+	// Total number of waves in the upgrade
+	Total int      `json:"total"`
+	Nodes []string `json:"nodes"`
+}
+
+type hookFailedErr struct {
+	event string
+	hook  string
+	err   error
+}
+
+func (e hookFailedErr) Error() string {
+	return fmt.Sprintf("%s hook %q failed: %v", e.event, e.hook, e.err)
+}
+
+// runHooks fires all the hooks in the plan that are registered for the given event.
+// When nodes are provided, the hooks are fired once per node. Otherwise, they
+// are fired once for the whole cluster. The output of command hooks is
+// appended to the hooks log file in the run directory.
+func runHooks(out io.Writer, p Plan, event string, nodes []Node, runDirectory string, cause error) error {
+	hooks := hooksForEvent(p.Hooks, event)
+	if len(hooks) == 0 {
+		return nil
+	}
+	payloads := []HookPayload{}
+	base := HookPayload{
+		Event:        event,
+		Cluster:      p.Cluster.Name,
+		RunDirectory: runDirectory,
+	}
+	if cause != nil {
+		base.Error = cause.Error()
+	}
+	if len(nodes) == 0 {
+		payloads = append(payloads, base)
+	}
+	for _, n := range nodes {
+		payload := base
+		payload.Node = &HookNode{
+			Host:       n.Host,
+			IP:         n.IP,
+			InternalIP: n.InternalIP,
+			Roles:      p.GetRolesForIP(n.IP),
+		}
+		payloads = append(payloads, payload)
+	}
+	return runHookPayloads(out, hooks, payloads, runDirectory)
+}
+
+// runWaveHooks fires the hooks in the plan that are registered for the
+// pre-upgrade-wave event, once for the whole wave.
+func runWaveHooks(out io.Writer, p Plan, wave HookWave, runDirectory string) error {
+	hooks := hooksForEvent(p.Hooks, HookEventPreUpgradeWave)
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload := HookPayload{
+		Event:        HookEventPreUpgradeWave,
+		Cluster:      p.Cluster.Name,
+		Wave:         &wave,
+		RunDirectory: runDirectory,
+	}
+	return runHookPayloads(out, hooks, []HookPayload{payload}, runDirectory)
+}
+
+func runHookPayloads(out io.Writer, hooks []Hook, payloads []HookPayload, runDirectory string) error {
+	logFilename := filepath.Join(runDirectory, "hooks.log")
+	logFile, err := os.OpenFile(logFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating hooks log file %q: %v", logFilename, err)
+	}
+	defer logFile.Close()
+
+	for _, payload := range payloads {
+		for _, h := range hooks {
+			name := h.Command
+			if name == "" {
+				name = h.URL
+			}
+			event := payload.Event
+			msg := fmt.Sprintf("Running %s hook %q", event, name)
+			if payload.Node != nil {
+				msg = fmt.Sprintf("Running %s hook %q for node %q", event, name, payload.Node.Host)
+			}
+			if payload.Wave != nil {
+				msg = fmt.Sprintf("Running %s hook %q for wave %d of %d", event, name, payload.Wave.Number, payload.Wave.Total)
+			}
+			if err := runHook(h, payload, logFile); err != nil {
+				if h.IgnoreFailure {
+					util.PrettyPrintErrorIgnored(out, msg)
+					continue
+				}
+				util.PrettyPrintErr(out, msg)
+				return hookFailedErr{event: event, hook: name, err: err}
+			}
+			util.PrettyPrintOk(out, msg)
+		}
+	}
+	return nil
+}
+
+func hooksForEvent(hooks []Hook, event string) []Hook {
+	var matched []Hook
+	for _, h := range hooks {
+		if h.Event == event {
+			matched = append(matched, h)
+		}
+	}
+	return matched
+}
+
+func runHook(h Hook, payload HookPayload, log io.Writer) error {
+	timeout := h.Timeout
+	if timeout == "" {
+		timeout = defaultHookTimeout
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %v", timeout, err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling hook payload: %v", err)
+	}
+	if h.Command != "" {
+		return runCommandHook(h.Command, body, d, log)
+	}
+	return runWebhook(h.URL, body, d)
+}
+
+func runCommandHook(command string, payload []byte, timeout time.Duration, log io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+func runWebhook(url string, payload []byte, timeout time.Duration) error {
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %q", resp.Status)
+	}
+	return nil
+}
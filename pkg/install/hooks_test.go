@@ -0,0 +1,223 @@
+package install
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+func mustWriteHookScript(t *testing.T, dir string, script string) string {
+	file := filepath.Join(dir, "hook.sh")
+	if err := ioutil.WriteFile(file, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write hook script: %v", err)
+	}
+	return file
+}
+
+func TestRunHooksCommandReceivesPayload(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	payloadFile := filepath.Join(dir, "payload.json")
+	script := mustWriteHookScript(t, dir, "cat > "+payloadFile)
+	p := Plan{
+		Cluster: Cluster{Name: "test"},
+		Worker:  NodeGroup{Nodes: []Node{{Host: "worker01", IP: "10.0.0.1"}}},
+		Hooks:   []Hook{{Event: HookEventPreNodeUpgrade, Command: script}},
+	}
+	if err := runHooks(ioutil.Discard, p, HookEventPreNodeUpgrade, p.Worker.Nodes, dir, nil); err != nil {
+		t.Fatalf("unexpected error running hooks: %v", err)
+	}
+	b, err := ioutil.ReadFile(payloadFile)
+	if err != nil {
+		t.Fatalf("hook did not receive payload: %v", err)
+	}
+	var payload HookPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatalf("error unmarshaling payload: %v", err)
+	}
+	if payload.Event != HookEventPreNodeUpgrade {
+		t.Errorf("expected event %q, but got %q", HookEventPreNodeUpgrade, payload.Event)
+	}
+	if payload.RunDirectory != dir {
+		t.Errorf("expected run directory %q, but got %q", dir, payload.RunDirectory)
+	}
+	if payload.Node == nil || payload.Node.Host != "worker01" {
+		t.Fatalf("expected payload for node worker01, but got %+v", payload.Node)
+	}
+	if len(payload.Node.Roles) != 1 || payload.Node.Roles[0] != "worker" {
+		t.Errorf("expected roles [worker], but got %v", payload.Node.Roles)
+	}
+}
+
+func TestRunHooksOnlyFiresMatchingEvent(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	script := mustWriteHookScript(t, dir, "exit 1")
+	p := Plan{
+		Hooks: []Hook{{Event: HookEventPostInstall, Command: script}},
+	}
+	if err := runHooks(ioutil.Discard, p, HookEventPreInstall, nil, dir, nil); err != nil {
+		t.Errorf("unexpected error running hooks: %v", err)
+	}
+}
+
+func TestRunHooksCommandFailure(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	script := mustWriteHookScript(t, dir, "exit 1")
+	tests := []struct {
+		ignoreFailure bool
+		expectErr     bool
+	}{
+		{ignoreFailure: false, expectErr: true},
+		{ignoreFailure: true, expectErr: false},
+	}
+	for _, test := range tests {
+		p := Plan{
+			Hooks: []Hook{{Event: HookEventPreInstall, Command: script, IgnoreFailure: test.ignoreFailure}},
+		}
+		err := runHooks(ioutil.Discard, p, HookEventPreInstall, nil, dir, nil)
+		if test.expectErr && err == nil {
+			t.Errorf("expected an error, but didn't get one")
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestRunHooksWebhook(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		status    int
+		expectErr bool
+	}{
+		{status: http.StatusOK, expectErr: false},
+		{status: http.StatusNoContent, expectErr: false},
+		{status: http.StatusInternalServerError, expectErr: true},
+	}
+	for _, test := range tests {
+		var received HookPayload
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Errorf("error decoding payload: %v", err)
+			}
+			w.WriteHeader(test.status)
+		}))
+		p := Plan{
+			Cluster: Cluster{Name: "test"},
+			Hooks:   []Hook{{Event: HookEventOnFailure, URL: server.URL}},
+		}
+		err := runHooks(ioutil.Discard, p, HookEventOnFailure, nil, dir, io.ErrUnexpectedEOF)
+		server.Close()
+		if test.expectErr && err == nil {
+			t.Errorf("status %d: expected an error, but didn't get one", test.status)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("status %d: unexpected error: %v", test.status, err)
+		}
+		if received.Error != io.ErrUnexpectedEOF.Error() {
+			t.Errorf("expected error %q in payload, but got %q", io.ErrUnexpectedEOF.Error(), received.Error)
+		}
+	}
+}
+
+func TestRunWaveHooksReceivesWave(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	payloadFile := filepath.Join(dir, "payload.json")
+	script := mustWriteHookScript(t, dir, "cat > "+payloadFile)
+	p := Plan{
+		Cluster: Cluster{Name: "test"},
+		Hooks:   []Hook{{Event: HookEventPreUpgradeWave, Command: script}},
+	}
+	wave := HookWave{Number: 2, Total: 3, Nodes: []string{"worker01", "worker02"}}
+	if err := runWaveHooks(ioutil.Discard, p, wave, dir); err != nil {
+		t.Fatalf("unexpected error running hooks: %v", err)
+	}
+	b, err := ioutil.ReadFile(payloadFile)
+	if err != nil {
+		t.Fatalf("hook did not receive payload: %v", err)
+	}
+	var payload HookPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatalf("error unmarshaling payload: %v", err)
+	}
+	if payload.Event != HookEventPreUpgradeWave {
+		t.Errorf("expected event %q, but got %q", HookEventPreUpgradeWave, payload.Event)
+	}
+	if payload.Node != nil {
+		t.Errorf("expected no node in payload, but got %+v", payload.Node)
+	}
+	if payload.Wave == nil || payload.Wave.Number != 2 || payload.Wave.Total != 3 || len(payload.Wave.Nodes) != 2 {
+		t.Errorf("expected payload for wave %+v, but got %+v", wave, payload.Wave)
+	}
+}
+
+func TestInstallPreInstallHookFailureAbortsInstall(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	script := mustWriteHookScript(t, dir, "exit 1")
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:             ExecutorOptions{RunsDirectory: dir},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		certsDir:            dir,
+		runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return runner, &explain.AnsibleEventStreamExplainer{}, nil
+		},
+	}
+	p := &Plan{
+		Master: MasterNodeGroup{
+			Nodes: []Node{{InternalIP: "10.10.2.20"}},
+		},
+		Cluster: Cluster{
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+		Hooks: []Hook{{Event: HookEventPreInstall, Command: script}},
+	}
+	if err := e.Install(p); err == nil {
+		t.Errorf("expected an error, but didn't get one")
+	}
+	if len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected no playbooks to run, but ran %v", runner.allNodesPlaybooks)
+	}
+}
+
+func TestValidateHook(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	script := mustWriteHookScript(t, dir, "exit 0")
+	tests := []struct {
+		hook  Hook
+		valid bool
+	}{
+		{hook: Hook{Event: HookEventPreInstall, Command: script}, valid: true},
+		{hook: Hook{Event: HookEventOnFailure, URL: "https://example.com/hook", Timeout: "30s"}, valid: true},
+		{hook: Hook{Event: "pre-everything", Command: script}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall, Command: script, URL: "https://example.com/hook"}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall, Command: "hook.sh"}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall, Command: filepath.Join(dir, "missing.sh")}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall, URL: "ftp://example.com"}, valid: false},
+		{hook: Hook{Event: HookEventPreInstall, Command: script, Timeout: "soon"}, valid: false},
+	}
+	for i, test := range tests {
+		ok, _ := test.hook.validate()
+		if ok != test.valid {
+			t.Errorf("test #%d: expected valid to be %v, but got %v", i, test.valid, ok)
+		}
+	}
+}
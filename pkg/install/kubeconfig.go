@@ -54,8 +54,12 @@ func GenerateKubeconfig(p *Plan, generatedAssetsDir string) error {
 
 	certsDir := filepath.Join(generatedAssetsDir, "keys")
 
-	// Base64 encoded ca
-	caEncoded, err := util.Base64String(filepath.Join(certsDir, "ca.pem"))
+	// Base64 encoded ca, including the chain to the root CA if there is one
+	caFile, err := caTrustFilename("ca", certsDir)
+	if err != nil {
+		return err
+	}
+	caEncoded, err := util.Base64String(filepath.Join(certsDir, caFile))
 	if err != nil {
 		return fmt.Errorf("error reading ca file for kubeconfig: %v", err)
 	}
@@ -0,0 +1,89 @@
+package install
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// DrainNode cordons the node and evicts the pods running on it
+func (ae *ansibleExecutor) DrainNode(plan Plan, node Node) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "node-drain",
+		playbook:       "_kube-drain-node.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{node.Host},
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Drain Node: %s", node.Host), '=')
+	return ae.execute(t)
+}
+
+// UncordonNode allows pods to be scheduled on the worker node again
+func (ae *ansibleExecutor) UncordonNode(plan Plan, node Node) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "node-uncordon",
+		playbook:       "_kube-uncordon-node.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{node.Host},
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Uncordon Node: %s", node.Host), '=')
+	return ae.execute(t)
+}
+
+// the boot ID changes every time the node boots
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// RebootNode reboots the node, and waits until it has booted and is reachable over SSH again.
+// An error is returned if the node does not come back before the timeout.
+func RebootNode(client ssh.Client, timeout, interval time.Duration) error {
+	bootID, err := nodeBootID(client)
+	if err != nil {
+		return fmt.Errorf("error getting the boot ID of the node: %v", err)
+	}
+	// The reboot is delayed so that the SSH session can be closed cleanly
+	if _, err = client.Output(false, "sudo nohup sh -c 'sleep 2 && systemctl reboot' > /dev/null 2>&1 &"); err != nil {
+		return fmt.Errorf("error rebooting the node: %v", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(interval)
+		// Errors are expected while the node is rebooting
+		if id, err := nodeBootID(client); err == nil && id != bootID {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the node to reboot")
+		}
+	}
+}
+
+func nodeBootID(client ssh.Client) (string, error) {
+	out, err := client.Output(false, "cat "+bootIDFile)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(out)
+	if id == "" {
+		return "", fmt.Errorf("%s is empty", bootIDFile)
+	}
+	return id, nil
+}
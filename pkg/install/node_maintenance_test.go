@@ -0,0 +1,152 @@
+package install
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// rebootingSSHClient reports a new boot ID after the node is rebooted,
+// and is unreachable for the given number of attempts in between
+type rebootingSSHClient struct {
+	rebooted    bool
+	unreachable int
+	neverBoots  bool
+}
+
+func (c *rebootingSSHClient) Output(pty bool, args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	if strings.Contains(cmd, "systemctl reboot") {
+		c.rebooted = true
+		return "", nil
+	}
+	if !c.rebooted {
+		return "old-boot-id\n", nil
+	}
+	if c.unreachable > 0 || c.neverBoots {
+		c.unreachable--
+		return "", errors.New("connection refused")
+	}
+	return "new-boot-id\n", nil
+}
+
+func (c *rebootingSSHClient) Shell(pty bool, args ...string) error {
+	_, err := c.Output(pty, args...)
+	return err
+}
+
+func TestRebootNode(t *testing.T) {
+	client := &rebootingSSHClient{unreachable: 3}
+	if err := RebootNode(client, time.Second, time.Millisecond); err != nil {
+		t.Errorf("unexpected error rebooting node: %v", err)
+	}
+	if !client.rebooted {
+		t.Error("the node was not rebooted")
+	}
+}
+
+func TestRebootNodeTimeout(t *testing.T) {
+	client := &rebootingSSHClient{neverBoots: true}
+	if err := RebootNode(client, 10*time.Millisecond, time.Millisecond); err == nil {
+		t.Error("expected an error, but didn't get one")
+	}
+}
+
+type playbookPlay struct {
+	Hosts     string
+	VarsFiles []string `yaml:"vars_files"`
+	Tasks     []struct {
+		Name    string
+		Command string
+		When    string
+	}
+}
+
+func mustReadPlaybook(t *testing.T, file string) []playbookPlay {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading playbook: %v", err)
+	}
+	var plays []playbookPlay
+	if err = yaml.Unmarshal(b, &plays); err != nil {
+		t.Fatalf("error unmarshaling playbook %q: %v", file, err)
+	}
+	if len(plays) != 1 {
+		t.Fatalf("expected playbook %q to have 1 play, but it has %d", file, len(plays))
+	}
+	return plays
+}
+
+// every node that is drained must be uncordoned, or it is left unschedulable
+func TestUncordonTargetsDrainedNodes(t *testing.T) {
+	drain := mustReadPlaybook(t, "../../ansible/_kube-drain-node.yaml")[0]
+	uncordon := mustReadPlaybook(t, "../../ansible/_kube-uncordon-node.yaml")[0]
+	if drain.Hosts != uncordon.Hosts {
+		t.Errorf("nodes are drained on %q, but uncordoned on %q", drain.Hosts, uncordon.Hosts)
+	}
+	var drainWhen, uncordonWhen string
+	for _, task := range drain.Tasks {
+		if strings.Contains(task.Command, "kubectl drain") {
+			drainWhen = task.When
+		}
+	}
+	for _, task := range uncordon.Tasks {
+		if strings.Contains(task.Command, "kubectl uncordon") {
+			uncordonWhen = task.When
+		}
+	}
+	if drainWhen != uncordonWhen {
+		t.Errorf("nodes are drained when %q, but uncordoned when %q", drainWhen, uncordonWhen)
+	}
+}
+
+func TestDrainAndUncordonNode(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	plan := Plan{
+		Cluster: Cluster{
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+		Etcd:    NodeGroup{Nodes: []Node{{Host: "etcd01", IP: "10.0.0.1"}}},
+		Master:  MasterNodeGroup{Nodes: []Node{{Host: "master01", IP: "10.0.0.2"}}},
+		Worker:  NodeGroup{Nodes: []Node{{Host: "worker01", IP: "10.0.0.3"}}},
+		Ingress: OptionalNodeGroup{Nodes: []Node{{Host: "ingress01", IP: "10.0.0.4"}}},
+		Storage: OptionalNodeGroup{Nodes: []Node{{Host: "storage01", IP: "10.0.0.5"}}},
+	}
+	nodes := []Node{plan.Master.Nodes[0], plan.Worker.Nodes[0], plan.Ingress.Nodes[0], plan.Storage.Nodes[0]}
+	for _, n := range nodes {
+		runner := &fakeRunner{}
+		e := ansibleExecutor{
+			options:             ExecutorOptions{RunsDirectory: dir},
+			stdout:              ioutil.Discard,
+			consoleOutputFormat: ansible.RawFormat,
+			runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+				return runner, &explain.AnsibleEventStreamExplainer{}, nil
+			},
+		}
+		if err := e.DrainNode(plan, n); err != nil {
+			t.Errorf("unexpected error draining node %q: %v", n.Host, err)
+		}
+		if err := e.UncordonNode(plan, n); err != nil {
+			t.Errorf("unexpected error uncordoning node %q: %v", n.Host, err)
+		}
+		expected := []string{"_kube-drain-node.yaml", "_kube-uncordon-node.yaml"}
+		if !reflect.DeepEqual(runner.onNodePlaybooks, expected) {
+			t.Errorf("expected playbooks %v to run on node %q, but ran %v", expected, n.Host, runner.onNodePlaybooks)
+		}
+		if !reflect.DeepEqual(runner.limit, []string{n.Host}) {
+			t.Errorf("expected the playbooks to be limited to %q, but were limited to %v", n.Host, runner.limit)
+		}
+	}
+}
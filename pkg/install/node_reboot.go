@@ -0,0 +1,38 @@
+package install
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// WaitForEtcdHealthy waits until all the members of the Kubernetes etcd cluster are
+// healthy, so that the cluster keeps its quorum when one of the members is taken down.
+// An error is returned if any of the members is not healthy before the timeout.
+func WaitForEtcdHealthy(plan Plan, sshClient func(Node) (ssh.Client, error), timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := etcdHealthy(plan, sshClient)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out waiting for etcd to be healthy: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func etcdHealthy(plan Plan, sshClient func(Node) (ssh.Client, error)) error {
+	for _, n := range plan.Etcd.Nodes {
+		client, err := sshClient(n)
+		if err != nil {
+			return fmt.Errorf("etcd node %q: %v", n.Host, err)
+		}
+		if err = checkEtcdHealth(client); err != nil {
+			return fmt.Errorf("etcd node %q: %v", n.Host, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package install
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+func TestWaitForEtcdHealthy(t *testing.T) {
+	plan := Plan{
+		Etcd: NodeGroup{
+			Nodes: []Node{{Host: "etcd01"}, {Host: "etcd02"}, {Host: "etcd03"}},
+		},
+	}
+	unhealthy := fakeSSHClient{outputs: map[string]string{"/health": `{"health": "false"}`}}
+	tests := []struct {
+		name      string
+		sshClient func(Node) (ssh.Client, error)
+		valid     bool
+	}{
+		{
+			name:      "all members healthy",
+			sshClient: func(Node) (ssh.Client, error) { return healthyNodeClient(), nil },
+			valid:     true,
+		},
+		{
+			name: "one member unhealthy",
+			sshClient: func(n Node) (ssh.Client, error) {
+				if n.Host == "etcd02" {
+					return unhealthy, nil
+				}
+				return healthyNodeClient(), nil
+			},
+		},
+		{
+			name: "one member unreachable",
+			sshClient: func(n Node) (ssh.Client, error) {
+				if n.Host == "etcd03" {
+					return nil, errors.New("connection refused")
+				}
+				return healthyNodeClient(), nil
+			},
+		},
+	}
+	for _, test := range tests {
+		err := WaitForEtcdHealthy(plan, test.sshClient, 10*time.Millisecond, time.Millisecond)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package install
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,7 @@ import (
 	"github.com/apprenda/kismatic/pkg/tls"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 const (
@@ -254,14 +256,28 @@ func (lp *LocalPKI) GetClusterCA() (*tls.CA, error) {
 	}, nil
 }
 
-// GenerateClusterCA creates a Certificate Authority for the cluster
+// GenerateClusterCA creates a Certificate Authority for the cluster. When an existing
+// Certificate Authority is provided in the plan, it is used instead of generating one.
+// The Certificate Authority is never overwritten once it exists.
 func (lp *LocalPKI) GenerateClusterCA(p *Plan) (*tls.CA, error) {
 	exists, err := tls.CertKeyPairExists("ca", lp.GeneratedCertsDirectory)
 	if err != nil {
 		return nil, fmt.Errorf("error verifying CA certificate/key: %v", err)
 	}
 	if exists {
-		return lp.GetClusterCA()
+		ca, err := lp.GetClusterCA()
+		if err != nil {
+			return nil, err
+		}
+		if p.CAProvided() {
+			if err = lp.verifyProvidedCA(p, ca); err != nil {
+				return nil, err
+			}
+		}
+		return ca, nil
+	}
+	if p.CAProvided() {
+		return lp.importClusterCA(p)
 	}
 
 	// CA keypair doesn't exist, generate one
@@ -273,12 +289,116 @@ func (lp *LocalPKI) GenerateClusterCA(p *Plan) (*tls.CA, error) {
 	if err = tls.WriteCert(key, cert, "ca", lp.GeneratedCertsDirectory); err != nil {
 		return nil, fmt.Errorf("error writing CA files: %v", err)
 	}
+	if err = writeCABundle(lp.GeneratedCertsDirectory, cert, nil); err != nil {
+		return nil, err
+	}
 	return &tls.CA{
 		Cert: cert,
 		Key:  key,
 	}, nil
 }
 
+// importClusterCA validates the Certificate Authority provided in the plan,
+// and copies it into the certificates directory
+func (lp *LocalPKI) importClusterCA(p *Plan) (*tls.CA, error) {
+	certs := p.Cluster.Certificates
+	cert, err := ioutil.ReadFile(certs.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	key, err := ioutil.ReadFile(certs.CAKey)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA key: %v", err)
+	}
+	var chain []byte
+	if certs.CAChain != "" {
+		if chain, err = ioutil.ReadFile(certs.CAChain); err != nil {
+			return nil, fmt.Errorf("error reading CA certificate chain: %v", err)
+		}
+	}
+	expiry, err := time.ParseDuration(certs.Expiry)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid duration for certificate expiry", certs.Expiry)
+	}
+	if err = tls.ValidateCA(key, cert, chain, expiry, time.Now()); err != nil {
+		return nil, fmt.Errorf("the CA in %q cannot be used to sign the cluster certificates: %v", certs.CACert, err)
+	}
+
+	util.PrettyPrintOk(lp.Log, "Using the Certificate Authority in %q", certs.CACert)
+	if err = tls.WriteCert(key, cert, "ca", lp.GeneratedCertsDirectory); err != nil {
+		return nil, fmt.Errorf("error writing CA files: %v", err)
+	}
+	if err = writeCABundle(lp.GeneratedCertsDirectory, cert, chain); err != nil {
+		return nil, err
+	}
+	return &tls.CA{
+		Cert: cert,
+		Key:  key,
+	}, nil
+}
+
+// verifyProvidedCA verifies that the existing cluster CA is the one provided in the plan,
+// and refreshes the certificate chain in case it has changed
+func (lp *LocalPKI) verifyProvidedCA(p *Plan, ca *tls.CA) error {
+	certs := p.Cluster.Certificates
+	provided, err := ioutil.ReadFile(certs.CACert)
+	if err != nil {
+		return fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	providedCert, err := helpers.ParseCertificatePEM(provided)
+	if err != nil {
+		return fmt.Errorf("error parsing CA certificate %q: %v", certs.CACert, err)
+	}
+	existingCert, err := helpers.ParseCertificatePEM(ca.Cert)
+	if err != nil {
+		return fmt.Errorf("error parsing CA certificate: %v", err)
+	}
+	if !existingCert.Equal(providedCert) {
+		return fmt.Errorf("the cluster CA in %q is not the CA in %q, and it will not be overwritten. Use \"kismatic certificates deploy --rotate-ca\" to replace it", lp.GeneratedCertsDirectory, certs.CACert)
+	}
+	var chain []byte
+	if certs.CAChain != "" {
+		if chain, err = ioutil.ReadFile(certs.CAChain); err != nil {
+			return fmt.Errorf("error reading CA certificate chain: %v", err)
+		}
+	}
+	return writeCABundle(lp.GeneratedCertsDirectory, ca.Cert, chain)
+}
+
+// writeCABundle writes the CA certificate followed by its chain to the bundle file,
+// which is trusted by the nodes instead of the CA certificate. The bundle is removed
+// when there is no chain, as the CA certificate is the root of trust.
+func writeCABundle(dir string, cert, chain []byte) error {
+	file := filepath.Join(dir, caBundleFilename("ca"))
+	if len(chain) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing CA bundle: %v", err)
+		}
+		return nil
+	}
+	bundle := bytes.Join([][]byte{bytes.TrimSpace(cert), bytes.TrimSpace(chain)}, []byte("\n"))
+	if err := ioutil.WriteFile(file, append(bundle, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing CA bundle: %v", err)
+	}
+	return nil
+}
+
+// caTrustFilename returns the name of the file with the certificates that are trusted
+// for the CA with the given name. This is the CA bundle when the CA is not self-signed.
+func caTrustFilename(name, dir string) (string, error) {
+	bundle := caBundleFilename(name)
+	_, err := os.Stat(filepath.Join(dir, bundle))
+	if err == nil {
+		return bundle, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading CA bundle: %v", err)
+	}
+	return name + ".pem", nil
+}
+
+func caBundleFilename(name string) string { return name + "-bundle.pem" }
+
 // GenerateClusterCertificates creates all certificates required for the cluster
 // described in the plan file.
 func (lp *LocalPKI) GenerateClusterCertificates(p *Plan, ca *tls.CA) error {
@@ -1,9 +1,14 @@
 package install
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
@@ -24,9 +29,9 @@ func getPKI(t *testing.T) LocalPKI {
 		t.Fatalf("Failed to create temp directory: %v", err)
 	}
 	pki := LocalPKI{
-		CACsr: "test/ca-csr.json",
+		CACsr:                   "test/ca-csr.json",
 		GeneratedCertsDirectory: tempDir,
-		Log: ioutil.Discard,
+		Log:                     ioutil.Discard,
 	}
 	return pki
 }
@@ -1089,3 +1094,149 @@ func TestGenerateCertificate(t *testing.T) {
 		}
 	}
 }
+
+// writes an intermediate CA, signed by a new root CA, and returns the paths to
+// the intermediate certificate, its key and the root certificate
+func writeTestIntermediateCA(t *testing.T, dir string) (string, string, string) {
+	rootKeyPEM, rootPEM, err := tls.NewCACert("test/ca-csr.json", "root", "87600h")
+	if err != nil {
+		t.Fatalf("error creating root CA: %v", err)
+	}
+	root, err := helpers.ParseCertificatePEM(rootPEM)
+	if err != nil {
+		t.Fatalf("error parsing root CA: %v", err)
+	}
+	rootKey, err := helpers.ParsePrivateKeyPEM(rootKeyPEM)
+	if err != nil {
+		t.Fatalf("error parsing root CA key: %v", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(5 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("error creating intermediate CA: %v", err)
+	}
+	files := map[string][]byte{
+		"intermediate.pem":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"intermediate-key.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"root.pem":             rootPEM,
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "intermediate.pem"), filepath.Join(dir, "intermediate-key.pem"), filepath.Join(dir, "root.pem")
+}
+
+func TestGenerateClusterCAProvidedIntermediateCA(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	caDir := mustGetTempDir(t)
+	defer cleanup(caDir, t)
+
+	p := getPlan()
+	p.Cluster.Certificates.Expiry = "17520h"
+	p.Cluster.Certificates.CACert, p.Cluster.Certificates.CAKey, p.Cluster.Certificates.CAChain = writeTestIntermediateCA(t, caDir)
+
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error using provided CA: %v", err)
+	}
+	provided, err := ioutil.ReadFile(p.Cluster.Certificates.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ca.Cert) != string(provided) {
+		t.Errorf("the cluster CA is not the provided CA")
+	}
+	caFile, err := caTrustFilename("ca", pki.GeneratedCertsDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caFile != "ca-bundle.pem" {
+		t.Errorf("expected the CA bundle to be trusted, but got %q", caFile)
+	}
+	bundle, err := ioutil.ReadFile(filepath.Join(pki.GeneratedCertsDirectory, caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := helpers.ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatalf("error parsing CA bundle: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected 2 certificates in the CA bundle, but got %d", len(chain))
+	}
+
+	// Certificates signed by the intermediate CA chain to the root CA
+	if err = pki.GenerateClusterCertificates(p, ca); err != nil {
+		t.Fatalf("error generating cluster certificates: %v", err)
+	}
+	cert := mustReadCertFile(filepath.Join(pki.GeneratedCertsDirectory, "admin.pem"), t)
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	opts.Intermediates.AddCert(chain[0])
+	opts.Roots.AddCert(chain[1])
+	if _, err = cert.Verify(opts); err != nil {
+		t.Errorf("certificate does not chain to the root CA: %v", err)
+	}
+}
+
+func TestGenerateClusterCAProvidedCAIsValidated(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	caDir := mustGetTempDir(t)
+	defer cleanup(caDir, t)
+
+	p := getPlan()
+	p.Cluster.Certificates.CACert, p.Cluster.Certificates.CAKey, _ = writeTestIntermediateCA(t, caDir)
+	if _, err := pki.GenerateClusterCA(p); err == nil {
+		t.Errorf("expected an error when the chain of the intermediate CA is missing")
+	}
+	exists, err := pki.CertificateAuthorityExists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("the invalid CA was written to the certificates directory")
+	}
+}
+
+func TestGenerateClusterCAExistingCAIsNotOverwritten(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	caDir := mustGetTempDir(t)
+	defer cleanup(caDir, t)
+
+	p := getPlan()
+	existing, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	p.Cluster.Certificates.CACert, p.Cluster.Certificates.CAKey, p.Cluster.Certificates.CAChain = writeTestIntermediateCA(t, caDir)
+	if _, err = pki.GenerateClusterCA(p); err == nil {
+		t.Errorf("expected an error when the existing CA is not the provided CA")
+	}
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ca.Cert) != string(existing.Cert) || string(ca.Key) != string(existing.Key) {
+		t.Errorf("the existing CA was overwritten")
+	}
+}
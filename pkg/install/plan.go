@@ -147,6 +147,12 @@ func setDefaults(p *Plan) {
 	if p.AddOns.Dashboard == nil {
 		p.AddOns.Dashboard = &Dashboard{}
 	}
+
+	for i := range p.Hooks {
+		if p.Hooks[i].Timeout == "" {
+			p.Hooks[i].Timeout = defaultHookTimeout
+		}
+	}
 }
 
 var yamlKeyRE = regexp.MustCompile(`[^a-zA-Z]*([a-z_\-A-Z]+)[ ]*:`)
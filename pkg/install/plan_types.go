@@ -68,6 +68,9 @@ type Plan struct {
 	Storage OptionalNodeGroup
 	// NFS volumes of the cluster.
 	NFS NFS
+	// Hooks that are fired when lifecycle events occur during an installation,
+	// upgrade or when adding a worker node.
+	Hooks []Hook `yaml:"hooks,omitempty"`
 }
 
 // Cluster describes a Kubernetes cluster
@@ -184,6 +187,19 @@ type CertsConfig struct {
 	// For example: "17520h" for 2 years.
 	// +required.
 	CAExpiry string `yaml:"ca_expiry"`
+	// The absolute path of the certificate of an existing Certificate Authority
+	// that should be used to sign the cluster certificates, instead of generating
+	// a self-signed Certificate Authority. The Certificate Authority can be an
+	// intermediate CA, in which case the certificate chain is required.
+	CACert string `yaml:"ca_cert,omitempty"`
+	// The absolute path of the private key of the existing Certificate Authority.
+	// Required when ca_cert is set.
+	CAKey string `yaml:"ca_key,omitempty"`
+	// The absolute path of a file with the certificates that chain the existing
+	// Certificate Authority to the root CA, starting with the issuer of the
+	// Certificate Authority. The chain is added to the trusted certificates of
+	// the nodes and to the generated kubeconfig files.
+	CAChain string `yaml:"ca_chain,omitempty"`
 }
 
 // SSHConfig describes the cluster's SSH configuration for accessing nodes
@@ -524,6 +540,30 @@ type StorageVolume struct {
 	AccessModes []string
 }
 
+// A Hook is an action that is triggered when a lifecycle event occurs.
+// Hooks receive a JSON payload that describes the event, including the node
+// and its roles (for node-level events) and the run directory of the operation.
+type Hook struct {
+	// The lifecycle event that triggers the hook.
+	// +required
+	// +options=pre-install,post-install,pre-node-upgrade,post-node-upgrade,pre-upgrade-wave,pre-add-worker,post-add-worker,pre-remove-worker,post-remove-worker,on-failure
+	Event string
+	// The absolute path of a local executable that is run when the event occurs.
+	// The hook payload is written to the executable's standard input.
+	// Either the command or the URL must be set.
+	Command string
+	// The URL of an HTTP webhook that receives the hook payload in a POST request.
+	// Either the command or the URL must be set.
+	URL string `yaml:"url"`
+	// The length of time that the hook is allowed to run for.
+	// +default=5m
+	Timeout string
+	// Whether the failure of this hook should be ignored. When set to false,
+	// a non-zero exit code or a non-2xx HTTP response aborts the operation.
+	// +default=false
+	IgnoreFailure bool `yaml:"ignore_failure"`
+}
+
 type SSHConnection struct {
 	SSHConfig *SSHConfig
 	Node      *Node
@@ -679,6 +719,23 @@ func (p *Plan) GetRolesForIP(ip string) []string {
 	return allRoles
 }
 
+// GetNodesWithRole returns the nodes of the plan that have the given role
+func (p *Plan) GetNodesWithRole(role string) []Node {
+	switch role {
+	case "master":
+		return p.Master.Nodes
+	case "etcd":
+		return p.Etcd.Nodes
+	case "worker":
+		return p.Worker.Nodes
+	case "ingress":
+		return p.Ingress.Nodes
+	case "storage":
+		return p.Storage.Nodes
+	}
+	return nil
+}
+
 func hasIP(nodes *[]Node, ip string) bool {
 	for _, node := range *nodes {
 		if node.IP == ip {
@@ -694,6 +751,12 @@ func (p Plan) PrivateRegistryProvided() bool {
 	return p.DockerRegistry.Server != ""
 }
 
+// CAProvided returns true when an existing Certificate Authority
+// should be used instead of generating one
+func (p Plan) CAProvided() bool {
+	return p.Cluster.Certificates.CACert != ""
+}
+
 // NetworkConfigured returns true if pod validation/smoketest should run
 func (p Plan) NetworkConfigured() bool {
 	// CNI disabled or "custom" return false
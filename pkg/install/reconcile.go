@@ -0,0 +1,386 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// appliedPlanMarker is created in the run directory of a task that
+// successfully brought the cluster to the state described in its plan
+const appliedPlanMarker = "applied"
+
+var errNoAppliedPlan = errors.New("a plan that was successfully applied to the cluster was not found in the runs directory. " +
+	"Use \"install apply\" to apply the plan to the cluster")
+
+// Versions of Kismatic that did not mark the applied plans recorded runs that cannot be reconciled
+var errNoMarkedRun = errors.New("none of the runs in the runs directory is marked as a successfully applied plan. " +
+	"Runs recorded by previous versions of Kismatic are not marked, so a full \"install apply\" is required once " +
+	"before changes to the plan can be reconciled")
+
+// ReconcileStep is a change that is applied to the cluster by running a
+// single play against the affected nodes
+type ReconcileStep struct {
+	// Description of the change
+	Description string
+	playbook    string
+	// restart sets the restart flags required for the change to take effect
+	restart func(*ansible.ClusterCatalog)
+	// the nodes affected by the change. The play runs on all nodes when empty.
+	nodes []Node
+	// restart the master nodes one at a time
+	rollControlPlane bool
+}
+
+// LastAppliedPlan returns the most recent plan that was successfully
+// applied to the cluster, as recorded in the runs directory
+func LastAppliedPlan(runsDir string) (*Plan, error) {
+	var latest, latestRun string
+	var unmarked bool
+	names, err := ioutil.ReadDir(runsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading runs directory: %v", err)
+	}
+	for _, name := range names {
+		if !name.IsDir() {
+			continue
+		}
+		runs, err := ioutil.ReadDir(filepath.Join(runsDir, name.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading runs directory: %v", err)
+		}
+		for _, r := range runs {
+			dir := filepath.Join(runsDir, name.Name(), r.Name())
+			if _, err := os.Stat(filepath.Join(dir, appliedPlanMarker)); err != nil {
+				unmarked = true
+				continue
+			}
+			// run directories are named after their start time
+			if r.Name() > latestRun {
+				latest = dir
+				latestRun = r.Name()
+			}
+		}
+	}
+	if latest == "" && unmarked {
+		return nil, errNoMarkedRun
+	}
+	if latest == "" {
+		return nil, errNoAppliedPlan
+	}
+	fp := FilePlanner{File: filepath.Join(latest, "kismatic-cluster.yaml")}
+	p, err := fp.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading applied plan: %v", err)
+	}
+	return p, nil
+}
+
+// ReconcilePlan returns the steps required to bring a cluster that was
+// installed with the applied plan to the state described in the desired plan.
+// An error is returned if the plans differ in ways that cannot be reconciled.
+func ReconcilePlan(applied, desired Plan) ([]ReconcileStep, error) {
+	if unsupported := unreconcilableChanges(applied, desired); len(unsupported) > 0 {
+		return nil, fmt.Errorf("the following changes to the plan cannot be reconciled, use \"install apply\" instead: %s", strings.Join(unsupported, ", "))
+	}
+	var steps []ReconcileStep
+	masters := desired.Master.Nodes
+	kubeNodes := desired.kubeletNodes()
+
+	if !stringMapsEqual(applied.Cluster.APIServerOptions.Overrides, desired.Cluster.APIServerOptions.Overrides) {
+		steps = append(steps, ReconcileStep{
+			Description:      "Kubernetes API server options changed",
+			playbook:         "_kube-apiserver.yaml",
+			restart:          func(cc *ansible.ClusterCatalog) { cc.ForceAPIServerRestart = true },
+			nodes:            masters,
+			rollControlPlane: true,
+		})
+	}
+	if !stringMapsEqual(applied.Cluster.KubeControllerManagerOptions.Overrides, desired.Cluster.KubeControllerManagerOptions.Overrides) {
+		steps = append(steps, ReconcileStep{
+			Description:      "Kubernetes controller manager options changed",
+			playbook:         "_kube-controller-manager.yaml",
+			restart:          func(cc *ansible.ClusterCatalog) { cc.ForceControllerManagerRestart = true },
+			nodes:            masters,
+			rollControlPlane: true,
+		})
+	}
+	if !stringMapsEqual(applied.Cluster.KubeSchedulerOptions.Overrides, desired.Cluster.KubeSchedulerOptions.Overrides) {
+		steps = append(steps, ReconcileStep{
+			Description:      "Kubernetes scheduler options changed",
+			playbook:         "_kube-scheduler.yaml",
+			restart:          func(cc *ansible.ClusterCatalog) { cc.ForceSchedulerRestart = true },
+			nodes:            masters,
+			rollControlPlane: true,
+		})
+	}
+	if !stringMapsEqual(applied.Cluster.KubeProxyOptions.Overrides, desired.Cluster.KubeProxyOptions.Overrides) {
+		steps = append(steps, ReconcileStep{
+			Description:      "Kubernetes proxy options changed",
+			playbook:         "_kube-proxy.yaml",
+			restart:          func(cc *ansible.ClusterCatalog) { cc.ForceProxyRestart = true },
+			nodes:            kubeNodes,
+			rollControlPlane: true,
+		})
+	}
+	var kubeletNodes []Node
+	if !stringMapsEqual(applied.Cluster.KubeletOptions.Overrides, desired.Cluster.KubeletOptions.Overrides) {
+		kubeletNodes = kubeNodes
+	} else {
+		kubeletNodes = changedNodes(applied, desired, kubeNodes, func(n Node) interface{} { return n.KubeletOptions.Overrides })
+	}
+	if len(kubeletNodes) > 0 {
+		steps = append(steps, ReconcileStep{
+			Description:      "Kubelet options changed",
+			playbook:         "_kubelet.yaml",
+			restart:          func(cc *ansible.ClusterCatalog) { cc.ForceKubeletRestart = true },
+			nodes:            kubeletNodes,
+			rollControlPlane: true,
+		})
+	}
+	if labelNodes := changedNodes(applied, desired, kubeNodes, func(n Node) interface{} { return n.Labels }); len(labelNodes) > 0 {
+		steps = append(steps, ReconcileStep{
+			Description: "Node labels changed",
+			playbook:    "_label-nodes.yaml",
+			nodes:       labelNodes,
+		})
+	}
+	if !reflect.DeepEqual(applied.DockerRegistry, desired.DockerRegistry) {
+		steps = append(steps, ReconcileStep{
+			Description: "Docker registry settings changed",
+			playbook:    "_docker.yaml",
+		})
+	}
+	if !reflect.DeepEqual(applied.NFS, desired.NFS) && len(desired.NFS.Volumes) > 0 {
+		steps = append(steps, ReconcileStep{
+			Description: "NFS volumes changed",
+			playbook:    "_nfs-volumes.yaml",
+		})
+	}
+	if applied.AddOns.DNS.Disable && !desired.AddOns.DNS.Disable {
+		steps = append(steps, ReconcileStep{Description: "DNS add-on enabled", playbook: "_kube-dns.yaml"})
+	}
+	if !reflect.DeepEqual(applied.AddOns.HeapsterMonitoring, desired.AddOns.HeapsterMonitoring) {
+		steps = append(steps, ReconcileStep{Description: "Heapster add-on changed", playbook: "_heapster.yaml"})
+	}
+	if dashboardDisabled(applied) && !dashboardDisabled(desired) {
+		steps = append(steps, ReconcileStep{Description: "Dashboard add-on enabled", playbook: "_kube-dashboard.yaml"})
+	}
+	if applied.AddOns.PackageManager.Disable && !desired.AddOns.PackageManager.Disable {
+		steps = append(steps, ReconcileStep{Description: "Package manager add-on enabled", playbook: "_helm.yaml"})
+	}
+	if applied.AddOns.Rescheduler.Disable && !desired.AddOns.Rescheduler.Disable {
+		steps = append(steps, ReconcileStep{Description: "Rescheduler add-on enabled", playbook: "_rescheduler.yaml"})
+	}
+	return steps, nil
+}
+
+// unreconcilableChanges returns the sections of the plan that changed, but cannot be reconciled
+func unreconcilableChanges(applied, desired Plan) []string {
+	var unsupported []string
+	if applied.AddOns.HeapsterMonitoring != nil && !applied.AddOns.HeapsterMonitoring.Disable &&
+		(desired.AddOns.HeapsterMonitoring == nil || desired.AddOns.HeapsterMonitoring.Disable) {
+		unsupported = append(unsupported, "disabling the heapster add-on")
+	}
+	if !applied.AddOns.DNS.Disable && desired.AddOns.DNS.Disable {
+		unsupported = append(unsupported, "disabling the DNS add-on")
+	}
+	if !dashboardDisabled(applied) && dashboardDisabled(desired) {
+		unsupported = append(unsupported, "disabling the dashboard add-on")
+	}
+	if !applied.AddOns.PackageManager.Disable && desired.AddOns.PackageManager.Disable {
+		unsupported = append(unsupported, "disabling the package manager add-on")
+	}
+	if !applied.AddOns.Rescheduler.Disable && desired.AddOns.Rescheduler.Disable {
+		unsupported = append(unsupported, "disabling the rescheduler add-on")
+	}
+
+	// Clear everything that can be reconciled, and compare what's left
+	a, d := withoutReconcilableFields(applied), withoutReconcilableFields(desired)
+	av, dv := reflect.ValueOf(a), reflect.ValueOf(d)
+	for i := 0; i < av.NumField(); i++ {
+		if !reflect.DeepEqual(av.Field(i).Interface(), dv.Field(i).Interface()) {
+			name := strings.Split(av.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(av.Type().Field(i).Name)
+			}
+			unsupported = append(unsupported, name)
+		}
+	}
+	return unsupported
+}
+
+func withoutReconcilableFields(p Plan) Plan {
+	p.Hooks = nil
+	p.Cluster.APIServerOptions = APIServerOptions{}
+	p.Cluster.KubeControllerManagerOptions = KubeControllerManagerOptions{}
+	p.Cluster.KubeSchedulerOptions = KubeSchedulerOptions{}
+	p.Cluster.KubeProxyOptions = KubeProxyOptions{}
+	p.Cluster.KubeletOptions = KubeletOptions{}
+	p.DockerRegistry = DockerRegistry{}
+	p.NFS = NFS{}
+	p.AddOns.DNS = DNS{}
+	p.AddOns.HeapsterMonitoring = nil
+	p.AddOns.Dashboard = nil
+	p.AddOns.DashboardDeprecated = nil
+	p.AddOns.PackageManager = PackageManager{}
+	p.AddOns.Rescheduler = Rescheduler{}
+	p.Etcd.Nodes = withoutReconcilableNodeFields(p.Etcd.Nodes)
+	p.Master.Nodes = withoutReconcilableNodeFields(p.Master.Nodes)
+	p.Worker.Nodes = withoutReconcilableNodeFields(p.Worker.Nodes)
+	p.Ingress.Nodes = withoutReconcilableNodeFields(p.Ingress.Nodes)
+	p.Storage.Nodes = withoutReconcilableNodeFields(p.Storage.Nodes)
+	return p
+}
+
+func withoutReconcilableNodeFields(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	cleared := make([]Node, len(nodes))
+	for i, n := range nodes {
+		n.Labels = nil
+		n.KubeletOptions = KubeletOptions{}
+		cleared[i] = n
+	}
+	return cleared
+}
+
+func dashboardDisabled(p Plan) bool {
+	return p.AddOns.Dashboard != nil && p.AddOns.Dashboard.Disable
+}
+
+// kubeletNodes returns the unique nodes that run the kubelet
+func (p *Plan) kubeletNodes() []Node {
+	var nodes []Node
+	for _, n := range p.GetUniqueNodes() {
+		roles := p.GetRolesForIP(n.IP)
+		if len(roles) == 1 && roles[0] == "etcd" {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// changedNodes returns the nodes for which the given field is different in the two plans.
+// Nodes that are listed under multiple roles are compared using all their entries.
+func changedNodes(applied, desired Plan, nodes []Node, field func(Node) interface{}) []Node {
+	values := func(p Plan, host string) []interface{} {
+		var v []interface{}
+		for _, n := range p.getAllNodes() {
+			if n.Host == host {
+				v = append(v, field(n))
+			}
+		}
+		return v
+	}
+	var changed []Node
+	for _, n := range nodes {
+		a, d := values(applied, n.Host), values(desired, n.Host)
+		if len(a) != len(d) {
+			changed = append(changed, n)
+			continue
+		}
+		for i := range a {
+			if !reflect.DeepEqual(a[i], d[i]) && !(isEmptyMap(a[i]) && isEmptyMap(d[i])) {
+				changed = append(changed, n)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+func isEmptyMap(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Map && rv.Len() == 0
+}
+
+func stringMapsEqual(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Reconcile applies the changes made to the plan since it was last applied
+// to the cluster. Only the plays that are affected by the changes are run.
+func (ae *ansibleExecutor) Reconcile(p *Plan) error {
+	applied, err := LastAppliedPlan(ae.options.RunsDirectory)
+	if err != nil {
+		return err
+	}
+	steps, err := ReconcilePlan(*applied, *p)
+	if err != nil {
+		return err
+	}
+	util.PrintHeader(ae.stdout, "Reconciling Cluster", '=')
+	if len(steps) == 0 {
+		util.PrettyPrintOk(ae.stdout, "The cluster is up to date with the plan")
+		return nil
+	}
+	for _, s := range steps {
+		util.PrettyPrint(ae.stdout, "%s\n", s.Description)
+	}
+
+	inventory := buildInventoryFromPlan(p)
+	var tasks []task
+	for _, s := range steps {
+		cc, err := ae.buildClusterCatalog(p)
+		if err != nil {
+			return err
+		}
+		if s.restart != nil {
+			s.restart(cc)
+		}
+		for _, limit := range reconcileLimits(*p, s) {
+			tasks = append(tasks, task{
+				name:           "reconcile",
+				playbook:       s.playbook,
+				plan:           *p,
+				inventory:      inventory,
+				clusterCatalog: *cc,
+				explainer:      ae.defaultExplainer(),
+				limit:          limit,
+			})
+		}
+	}
+	// The plan has only been applied once all the tasks succeed
+	tasks[len(tasks)-1].appliesPlan = true
+	for _, t := range tasks {
+		if err := ae.execute(t); err != nil {
+			return fmt.Errorf("error running %s: %v", t.playbook, err)
+		}
+	}
+	return nil
+}
+
+// reconcileLimits returns the sets of nodes that the step should be run on, in order
+func reconcileLimits(p Plan, s ReconcileStep) [][]string {
+	if len(s.nodes) == 0 {
+		return [][]string{nil}
+	}
+	var limits [][]string
+	var rest []string
+	for _, n := range s.nodes {
+		if s.rollControlPlane && contains("master", p.GetRolesForIP(n.IP)) {
+			limits = append(limits, []string{n.Host})
+			continue
+		}
+		rest = append(rest, n.Host)
+	}
+	if len(rest) > 0 {
+		sort.Strings(rest)
+		limits = append(limits, rest)
+	}
+	return limits
+}
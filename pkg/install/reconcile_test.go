@@ -0,0 +1,191 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func reconcileTestPlan() Plan {
+	return Plan{
+		Cluster: Cluster{Name: "test"},
+		Etcd:    NodeGroup{Nodes: []Node{{Host: "etcd01", IP: "10.0.0.1"}}},
+		Master: MasterNodeGroup{Nodes: []Node{
+			{Host: "master01", IP: "10.0.0.2"},
+			{Host: "master02", IP: "10.0.0.3"},
+		}},
+		Worker: NodeGroup{Nodes: []Node{
+			{Host: "worker01", IP: "10.0.0.4"},
+			{Host: "worker02", IP: "10.0.0.5"},
+		}},
+	}
+}
+
+func TestReconcilePlanNoChanges(t *testing.T) {
+	steps, err := ReconcilePlan(reconcileTestPlan(), reconcileTestPlan())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("expected no steps, got %+v", steps)
+	}
+}
+
+func TestReconcilePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(*Plan)
+		playbook string
+		nodes    []string
+		restart  func(ansible.ClusterCatalog) bool
+	}{
+		{
+			name:     "API server options",
+			change:   func(p *Plan) { p.Cluster.APIServerOptions.Overrides = map[string]string{"v": "4"} },
+			playbook: "_kube-apiserver.yaml",
+			nodes:    []string{"master01", "master02"},
+			restart:  func(cc ansible.ClusterCatalog) bool { return cc.ForceAPIServerRestart },
+		},
+		{
+			name:     "cluster kubelet options",
+			change:   func(p *Plan) { p.Cluster.KubeletOptions.Overrides = map[string]string{"max-pods": "50"} },
+			playbook: "_kubelet.yaml",
+			nodes:    []string{"master01", "master02", "worker01", "worker02"},
+			restart:  func(cc ansible.ClusterCatalog) bool { return cc.ForceKubeletRestart },
+		},
+		{
+			name:     "node kubelet options",
+			change:   func(p *Plan) { p.Worker.Nodes[1].KubeletOptions.Overrides = map[string]string{"max-pods": "50"} },
+			playbook: "_kubelet.yaml",
+			nodes:    []string{"worker02"},
+			restart:  func(cc ansible.ClusterCatalog) bool { return cc.ForceKubeletRestart },
+		},
+		{
+			name:     "node labels",
+			change:   func(p *Plan) { p.Worker.Nodes[0].Labels = map[string]string{"team": "blue"} },
+			playbook: "_label-nodes.yaml",
+			nodes:    []string{"worker01"},
+		},
+		{
+			name:     "enable rescheduler",
+			change:   func(p *Plan) { p.AddOns.Rescheduler.Disable = false },
+			playbook: "_rescheduler.yaml",
+		},
+	}
+	for _, test := range tests {
+		applied := reconcileTestPlan()
+		applied.AddOns.Rescheduler.Disable = true
+		desired := reconcileTestPlan()
+		desired.AddOns.Rescheduler.Disable = true
+		test.change(&desired)
+		steps, err := ReconcilePlan(applied, desired)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(steps) != 1 {
+			t.Errorf("%s: expected 1 step, got %+v", test.name, steps)
+			continue
+		}
+		s := steps[0]
+		if s.playbook != test.playbook {
+			t.Errorf("%s: expected playbook %q, got %q", test.name, test.playbook, s.playbook)
+		}
+		var nodes []string
+		for _, n := range s.nodes {
+			nodes = append(nodes, n.Host)
+		}
+		if !reflect.DeepEqual(nodes, test.nodes) {
+			t.Errorf("%s: expected nodes %v, got %v", test.name, test.nodes, nodes)
+		}
+		if test.restart != nil {
+			cc := ansible.ClusterCatalog{}
+			s.restart(&cc)
+			if !test.restart(cc) {
+				t.Errorf("%s: expected restart flag to be set", test.name)
+			}
+		}
+	}
+}
+
+func TestReconcilePlanUnsupportedChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Plan)
+	}{
+		{
+			name:   "new worker",
+			change: func(p *Plan) { p.Worker.Nodes = append(p.Worker.Nodes, Node{Host: "worker03", IP: "10.0.0.6"}) },
+		},
+		{
+			name:   "cluster networking",
+			change: func(p *Plan) { p.Cluster.Networking.PodCIDRBlock = "172.16.0.0/16" },
+		},
+		{
+			name:   "disable DNS",
+			change: func(p *Plan) { p.AddOns.DNS.Disable = true },
+		},
+	}
+	for _, test := range tests {
+		desired := reconcileTestPlan()
+		test.change(&desired)
+		if _, err := ReconcilePlan(reconcileTestPlan(), desired); err == nil {
+			t.Errorf("%s: expected an error, but did not get one", test.name)
+		}
+	}
+}
+
+func TestReconcileLimitsRollControlPlane(t *testing.T) {
+	p := reconcileTestPlan()
+	s := ReconcileStep{nodes: p.kubeletNodes(), rollControlPlane: true}
+	limits := reconcileLimits(p, s)
+	expected := [][]string{{"master01"}, {"master02"}, {"worker01", "worker02"}}
+	if !reflect.DeepEqual(limits, expected) {
+		t.Errorf("expected limits %v, got %v", expected, limits)
+	}
+}
+
+func TestLastAppliedPlan(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	record := func(run, timestamp, name string, applied bool) {
+		dir := filepath.Join(runsDir, run, timestamp)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("error creating run dir: %v", err)
+		}
+		p := reconcileTestPlan()
+		p.Cluster.Name = name
+		fp := FilePlanner{File: filepath.Join(dir, "kismatic-cluster.yaml")}
+		if err := fp.Write(&p); err != nil {
+			t.Fatalf("error writing plan: %v", err)
+		}
+		if applied {
+			if err := ioutil.WriteFile(filepath.Join(dir, appliedPlanMarker), nil, 0644); err != nil {
+				t.Fatalf("error writing marker: %v", err)
+			}
+		}
+	}
+	if _, err := LastAppliedPlan(runsDir); err != errNoAppliedPlan {
+		t.Errorf("expected no applied plan error, got %v", err)
+	}
+	// Runs recorded before the applied plans were marked
+	record("apply", "2017-10-01-10-00-00", "unmarked", false)
+	if _, err := LastAppliedPlan(runsDir); err != errNoMarkedRun {
+		t.Errorf("expected no marked run error, got %v", err)
+	}
+	record("apply", "2017-11-01-10-00-00", "first", true)
+	record("add-worker", "2017-11-02-10-00-00", "second", true)
+	record("apply", "2017-11-03-10-00-00", "failed", false)
+	record("step", "2017-11-04-10-00-00", "step", false)
+	p, err := LastAppliedPlan(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Cluster.Name != "second" {
+		t.Errorf("expected plan %q, got %q", "second", p.Cluster.Name)
+	}
+}
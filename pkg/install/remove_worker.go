@@ -0,0 +1,139 @@
+package install
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// RemoveWorker drains the worker node, stops and cleans up the cluster services
+// running on it, and removes it from the cluster described in the plan.
+// If successful, the updated plan is returned.
+func (ae *ansibleExecutor) RemoveWorker(originalPlan *Plan, worker Node) (*Plan, error) {
+	if err := checkRemoveWorkerPrereqs(*originalPlan, worker); err != nil {
+		return nil, err
+	}
+	updatedPlan := removeWorkerFromPlan(*originalPlan, worker)
+
+	inventory := buildInventoryFromPlan(originalPlan)
+	cc, err := ae.buildClusterCatalog(originalPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	cc.WorkerNode = worker.Host
+
+	util.PrintHeader(ae.stdout, "Draining Worker Node", '=')
+	t := task{
+		name:           "remove-worker-drain",
+		playbook:       "_kube-drain-node.yaml",
+		plan:           *originalPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{worker.Host},
+		preHookEvent:   HookEventPreRemoveWorker,
+		hookNodes:      []Node{worker},
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error draining worker node: %v", err)
+	}
+
+	util.PrintHeader(ae.stdout, "Cleaning Up Worker Node", '=')
+	t = task{
+		name:           "remove-worker-cleanup",
+		playbook:       "_kube-node-cleanup.yaml",
+		plan:           *originalPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{worker.Host},
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error cleaning up worker node: %v", err)
+	}
+
+	// Revoke access of the worker to any storage volumes defined
+	if len(originalPlan.Storage.Nodes) > 0 {
+		util.PrintHeader(ae.stdout, "Updating Allowed IPs On Storage Volumes", '=')
+		t = task{
+			name:           "remove-worker-update-volumes",
+			playbook:       "_volume-remove-allowed.yaml",
+			plan:           *originalPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error removing worker from volume allow list: %v", err)
+		}
+	}
+
+	// The remaining nodes make up the inventory from here on
+	inventory = buildInventoryFromPlan(&updatedPlan)
+	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
+		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		t = task{
+			name:           "remove-worker-update-hosts",
+			playbook:       "_hosts.yaml",
+			plan:           updatedPlan,
+			inventory:      inventory,
+			clusterCatalog: *cc,
+			explainer:      ae.defaultExplainer(),
+		}
+		if err = ae.execute(t); err != nil {
+			return nil, fmt.Errorf("error updating hosts files on all nodes: %v", err)
+		}
+	}
+
+	util.PrintHeader(ae.stdout, "Removing Worker Node From Cluster", '=')
+	t = task{
+		name:           "remove-worker",
+		playbook:       "_kube-delete-node.yaml",
+		plan:           updatedPlan,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		postHookEvent:  HookEventPostRemoveWorker,
+		hookNodes:      []Node{worker},
+		appliesPlan:    true,
+	}
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error deleting node from the cluster: %v", err)
+	}
+	return &updatedPlan, nil
+}
+
+func removeWorkerFromPlan(plan Plan, worker Node) Plan {
+	var nodes []Node
+	for _, n := range plan.Worker.Nodes {
+		if n.Host != worker.Host {
+			nodes = append(nodes, n)
+		}
+	}
+	plan.Worker.ExpectedCount--
+	plan.Worker.Nodes = nodes
+	return plan
+}
+
+// only nodes that are dedicated workers can be removed, as the other roles
+// would have to be moved to another node first
+func checkRemoveWorkerPrereqs(plan Plan, worker Node) error {
+	found := false
+	for _, n := range plan.Worker.Nodes {
+		if n.Host == worker.Host {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("node %q is not a worker node in the plan file", worker.Host)
+	}
+	roles := plan.GetRolesForIP(worker.IP)
+	if len(roles) > 1 {
+		return fmt.Errorf("node %q has the roles %v. Only nodes that are dedicated workers can be removed", worker.Host, roles)
+	}
+	if len(plan.Worker.Nodes) == 1 {
+		return fmt.Errorf("node %q is the only worker node in the cluster", worker.Host)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func removeWorkerTestPlan() *Plan {
+	return &Plan{
+		Master: MasterNodeGroup{
+			Nodes: []Node{{Host: "master01", IP: "10.0.0.1"}},
+		},
+		Worker: NodeGroup{
+			ExpectedCount: 2,
+			Nodes: []Node{
+				{Host: "worker01", IP: "10.0.0.2"},
+				{Host: "worker02", IP: "10.0.0.3"},
+			},
+		},
+		Cluster: Cluster{
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+	}
+}
+
+func TestRemoveWorkerPlanIsUpdated(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+	}
+	originalPlan := removeWorkerTestPlan()
+	worker := originalPlan.Worker.Nodes[0]
+	updatedPlan, err := e.RemoveWorker(originalPlan, worker)
+	if err != nil {
+		t.Fatalf("unexpected error while removing worker: %v", err)
+	}
+	if updatedPlan.Worker.ExpectedCount != 1 {
+		t.Errorf("expected count was not decremented")
+	}
+	if len(updatedPlan.Worker.Nodes) != 1 || updatedPlan.Worker.Nodes[0].Host != "worker02" {
+		t.Errorf("expected only worker02 to remain in the plan, got %v", updatedPlan.Worker.Nodes)
+	}
+	if len(originalPlan.Worker.Nodes) != 2 {
+		t.Errorf("the original plan was modified")
+	}
+	// the updated plan is recorded as applied
+	applied, err := LastAppliedPlan(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error getting applied plan: %v", err)
+	}
+	if len(applied.Worker.Nodes) != 1 {
+		t.Errorf("expected the applied plan to have 1 worker, got %d", len(applied.Worker.Nodes))
+	}
+}
+
+func TestRemoveWorkerPlanNotUpdatedAfterFailure(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: runsDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	originalPlan := removeWorkerTestPlan()
+	updatedPlan, err := e.RemoveWorker(originalPlan, originalPlan.Worker.Nodes[0])
+	if err == nil {
+		t.Errorf("expected an error, but didn't get one")
+	}
+	if updatedPlan != nil {
+		t.Error("plan was updated, even though removing worker failed")
+	}
+	if _, err := os.Stat(filepath.Join(runsDir, "remove-worker")); err == nil {
+		t.Error("the node was deleted from the cluster, even though draining it failed")
+	}
+}
+
+func TestRemoveWorkerPrereqs(t *testing.T) {
+	tests := []struct {
+		name   string
+		plan   func() *Plan
+		worker Node
+	}{
+		{
+			name:   "not a worker",
+			plan:   removeWorkerTestPlan,
+			worker: Node{Host: "master01", IP: "10.0.0.1"},
+		},
+		{
+			name: "worker with other roles",
+			plan: func() *Plan {
+				p := removeWorkerTestPlan()
+				p.Master.Nodes = append(p.Master.Nodes, p.Worker.Nodes[0])
+				return p
+			},
+			worker: Node{Host: "worker01", IP: "10.0.0.2"},
+		},
+		{
+			name: "only worker",
+			plan: func() *Plan {
+				p := removeWorkerTestPlan()
+				p.Worker.Nodes = p.Worker.Nodes[:1]
+				return p
+			},
+			worker: Node{Host: "worker01", IP: "10.0.0.2"},
+		},
+	}
+	for _, test := range tests {
+		if err := checkRemoveWorkerPrereqs(*test.plan(), test.worker); err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package install
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// Reset stops and removes the cluster services, containers, networking state, etcd data
+// and certificates from the given nodes, so that they can be reinstalled. All the nodes
+// of the cluster are reset when no nodes are given. Unless keepPackages is set, the
+// packages installed by Kismatic are removed as well.
+func (ae *ansibleExecutor) Reset(p *Plan, nodes []Node, keepPackages bool) error {
+	var limit []string
+	for _, n := range nodes {
+		limit = append(limit, n.Host)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildClusterCatalog(p)
+	if err != nil {
+		return fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	util.PrintHeader(ae.stdout, "Resetting Nodes", '=')
+	t := task{
+		name:           "reset",
+		playbook:       "_reset.yaml",
+		plan:           *p,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          limit,
+	}
+	if err = ae.execute(t); err != nil {
+		return fmt.Errorf("error resetting nodes: %v", err)
+	}
+	if keepPackages {
+		return nil
+	}
+	util.PrintHeader(ae.stdout, "Removing Packages", '=')
+	t = task{
+		name:           "reset-packages",
+		playbook:       "_packages-cleanup.yaml",
+		plan:           *p,
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		explainer:      ae.defaultExplainer(),
+		limit:          limit,
+	}
+	if err = ae.execute(t); err != nil {
+		return fmt.Errorf("error removing packages: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestResetKeepPackages(t *testing.T) {
+	tests := []struct {
+		keepPackages     bool
+		packagesRemoved  bool
+		explainerFailure error
+		expectErr        bool
+	}{
+		{keepPackages: false, packagesRemoved: true},
+		{keepPackages: true, packagesRemoved: false},
+		{keepPackages: false, explainerFailure: errors.New("exec error"), expectErr: true},
+	}
+	for i, test := range tests {
+		runsDir := mustGetTempDir(t)
+		e := ansibleExecutor{
+			options:                ExecutorOptions{RunsDirectory: runsDir},
+			stdout:                 ioutil.Discard,
+			consoleOutputFormat:    ansible.RawFormat,
+			runnerExplainerFactory: fakeRunnerExplainer(test.explainerFailure),
+		}
+		p := removeWorkerTestPlan()
+		err := e.Reset(p, p.Worker.Nodes[:1], test.keepPackages)
+		if test.expectErr && err == nil {
+			t.Errorf("test %d: expected an error, but didn't get one", i)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		_, err = os.Stat(filepath.Join(runsDir, "reset-packages"))
+		if removed := err == nil; removed != test.packagesRemoved {
+			t.Errorf("test %d: expected packages removed to be %v, but was %v", i, test.packagesRemoved, removed)
+		}
+		os.RemoveAll(runsDir)
+	}
+}
@@ -0,0 +1,326 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+const (
+	etcdK8sCertsDir          = "/etc/etcd_k8s"
+	etcdK8sClientPort        = 2379
+	etcdNetworkingClientPort = 6666
+	apiServerHealthz         = "http://127.0.0.1:8080/healthz"
+)
+
+// ComponentStatus is the health of a single component of the cluster
+type ComponentStatus struct {
+	// Node that the component runs on. Empty for cluster-wide components.
+	Node      string `json:"node,omitempty"`
+	Component string `json:"component"`
+	Healthy   bool   `json:"healthy"`
+	// Message explains why the component is not healthy
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterStatus contains the health of all the components of the cluster
+type ClusterStatus struct {
+	Components []ComponentStatus `json:"components"`
+}
+
+// Degraded returns true if any of the components of the cluster is not healthy
+func (cs ClusterStatus) Degraded() bool {
+	for _, c := range cs.Components {
+		if !c.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *ClusterStatus) add(node, component string, err error) {
+	s := ComponentStatus{Node: node, Component: component, Healthy: err == nil}
+	if err != nil {
+		s.Message = err.Error()
+	}
+	cs.Components = append(cs.Components, s)
+}
+
+type clusterStatusKubeClient interface {
+	data.NodeLister
+	data.DeploymentLister
+	data.DaemonSetLister
+}
+
+type statusCheck struct {
+	component string
+	check     func(client ssh.Client) error
+}
+
+// GetClusterStatus connects to the nodes of the cluster described in the plan,
+// and checks the health of the cluster components running on them according to their roles.
+// The kube client is used to verify the state of the nodes and add-ons as seen by Kubernetes,
+// and is not used if the plan does not have any master nodes.
+func GetClusterStatus(plan Plan, sshClient func(Node) (ssh.Client, error), kubeClient clusterStatusKubeClient) ClusterStatus {
+	cs := ClusterStatus{}
+	var etcdClient ssh.Client
+	for _, node := range plan.GetUniqueNodes() {
+		client, err := sshClient(node)
+		if err == nil {
+			_, err = client.Output(false, "true")
+		}
+		if err != nil {
+			cs.add(node.Host, "ssh", fmt.Errorf("node is unreachable: %v", err))
+			continue
+		}
+		roles := plan.GetRolesForIP(node.IP)
+		if etcdClient == nil && contains("etcd", roles) {
+			etcdClient = client
+		}
+		for _, c := range nodeStatusChecks(plan, roles) {
+			cs.add(node.Host, c.component, c.check(client))
+		}
+	}
+
+	if etcdClient != nil {
+		cs.add("", "etcd members", checkEtcdMembers(etcdClient, plan.Etcd.Nodes))
+	}
+	// The kube client runs kubectl on the first master node
+	if len(plan.Master.Nodes) == 0 {
+		cs.add("", "kubernetes", errors.New("the plan does not have any master nodes"))
+		return cs
+	}
+	checkKubernetesNodes(&cs, plan, kubeClient)
+	checkAddOns(&cs, kubeClient)
+	return cs
+}
+
+// nodeStatusChecks returns the checks that should be run on a node with the given roles
+func nodeStatusChecks(plan Plan, roles []string) []statusCheck {
+	checks := []statusCheck{
+		{component: "docker", check: systemdUnitCheck("docker")},
+	}
+	if contains("etcd", roles) {
+		checks = append(checks,
+			statusCheck{component: "etcd_k8s", check: systemdUnitCheck("etcd_k8s")},
+			statusCheck{component: "etcd_networking", check: systemdUnitCheck("etcd_networking")},
+			statusCheck{component: "etcd_k8s health", check: checkEtcdHealth},
+		)
+	}
+	if contains("master", roles) {
+		checks = append(checks,
+			statusCheck{component: "kube-apiserver", check: containerCheck("kube-apiserver")},
+			statusCheck{component: "kube-apiserver healthz", check: checkAPIServerHealthz},
+			statusCheck{component: "kube-controller-manager", check: containerCheck("kube-controller-manager")},
+			statusCheck{component: "kube-scheduler", check: containerCheck("kube-scheduler")},
+		)
+	}
+	// all roles, other than etcd, run the kubelet
+	if contains("master", roles) || contains("worker", roles) || contains("ingress", roles) || contains("storage", roles) {
+		checks = append(checks,
+			statusCheck{component: "kubelet", check: systemdUnitCheck("kubelet")},
+			statusCheck{component: "kube-proxy", check: containerCheck("kube-proxy")},
+		)
+		if plan.NetworkConfigured() && (plan.AddOns.CNI == nil || plan.AddOns.CNI.Provider == cniProviderCalico) {
+			checks = append(checks, statusCheck{component: "calico-node", check: containerCheck("calico-node")})
+		}
+	}
+	return checks
+}
+
+func systemdUnitCheck(unit string) func(ssh.Client) error {
+	return func(client ssh.Client) error {
+		out, err := client.Output(false, fmt.Sprintf("sudo systemctl is-active %s", unit))
+		state := strings.TrimSpace(out)
+		if err != nil || state != "active" {
+			if state == "" {
+				state = "unknown"
+			}
+			return fmt.Errorf("%s service is %s", unit, state)
+		}
+		return nil
+	}
+}
+
+// containerCheck verifies that a container with the given name, which was
+// started by the kubelet, is running on the node
+func containerCheck(name string) func(ssh.Client) error {
+	return func(client ssh.Client) error {
+		out, err := client.Output(false, fmt.Sprintf("sudo docker ps -q -f status=running -f name=k8s_%s_", name))
+		if err != nil {
+			return fmt.Errorf("error listing containers: %s", strings.TrimSpace(out))
+		}
+		if strings.TrimSpace(out) == "" {
+			return fmt.Errorf("%s container is not running", name)
+		}
+		return nil
+	}
+}
+
+func etcdCurl(path string) string {
+	return etcdClusterCurl(etcdK8sCertsDir, etcdK8sClientPort, path)
+}
+
+func etcdClusterCurl(certsDir string, port int, path string) string {
+	return fmt.Sprintf("sudo curl -s --cacert %[1]s/ca.pem --cert %[1]s/etcd-client.pem --key %[1]s/etcd-client-key.pem https://127.0.0.1:%[2]d%[3]s", certsDir, port, path)
+}
+
+// checkEtcdHealth checks the health of the member of the Kubernetes etcd cluster
+func checkEtcdHealth(client ssh.Client) error {
+	return checkEtcdClusterHealth(client, etcdCurl("/health"))
+}
+
+// checkEtcdNetworkingHealth checks the health of the member of the networking etcd cluster
+func checkEtcdNetworkingHealth(client ssh.Client) error {
+	return checkEtcdClusterHealth(client, etcdClusterCurl(etcdNetworkingCertsDir, etcdNetworkingClientPort, "/health"))
+}
+
+func checkEtcdClusterHealth(client ssh.Client, healthCmd string) error {
+	out, err := client.Output(false, healthCmd)
+	if err != nil {
+		return fmt.Errorf("error getting etcd health: %s", strings.TrimSpace(out))
+	}
+	health := struct {
+		Health string `json:"health"`
+	}{}
+	if err := json.Unmarshal([]byte(out), &health); err != nil {
+		return fmt.Errorf("error unmarshalling etcd health %q: %v", strings.TrimSpace(out), err)
+	}
+	if health.Health != "true" {
+		return errors.New("etcd member is unhealthy")
+	}
+	return nil
+}
+
+// etcdMember is a member of the etcd cluster, as returned by the members API
+type etcdMember struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+}
+
+func listEtcdMembers(client ssh.Client) ([]etcdMember, error) {
+	out, err := client.Output(false, etcdCurl("/v2/members"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing etcd members: %s", strings.TrimSpace(out))
+	}
+	members := struct {
+		Members []etcdMember `json:"members"`
+	}{}
+	if err := json.Unmarshal([]byte(out), &members); err != nil {
+		return nil, fmt.Errorf("error unmarshalling etcd members: %v", err)
+	}
+	return members.Members, nil
+}
+
+// checkEtcdMembers verifies that the etcd cluster is made up of the etcd nodes in the plan
+func checkEtcdMembers(client ssh.Client, nodes []Node) error {
+	members, err := listEtcdMembers(client)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, m := range members {
+		names[m.Name] = true
+	}
+	var missing []string
+	for _, n := range nodes {
+		if !names[n.Host] {
+			missing = append(missing, n.Host)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("nodes %v are not members of the etcd cluster", missing)
+	}
+	if len(members) != len(nodes) {
+		return fmt.Errorf("etcd cluster has %d members, but %d etcd nodes are defined in the plan", len(members), len(nodes))
+	}
+	return nil
+}
+
+func checkAPIServerHealthz(client ssh.Client) error {
+	out, err := client.Output(false, fmt.Sprintf("curl -s %s", apiServerHealthz))
+	if err != nil {
+		return fmt.Errorf("error getting API server health: %s", strings.TrimSpace(out))
+	}
+	if strings.TrimSpace(out) != "ok" {
+		return fmt.Errorf("API server is unhealthy: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// checkKubernetesNodes verifies that all the nodes running the kubelet are registered and Ready
+func checkKubernetesNodes(cs *ClusterStatus, plan Plan, kubeClient data.NodeLister) {
+	nodeList, err := kubeClient.ListNodes()
+	if err != nil {
+		cs.add("", "kubernetes nodes", err)
+		return
+	}
+	registered := map[string]data.Node{}
+	if nodeList != nil {
+		for _, n := range nodeList.Items {
+			registered[n.Name] = n
+		}
+	}
+	for _, node := range plan.GetUniqueNodes() {
+		roles := plan.GetRolesForIP(node.IP)
+		if len(roles) == 1 && roles[0] == "etcd" {
+			continue
+		}
+		cs.add(node.Host, "node ready", nodeReady(registered, node.Host))
+	}
+}
+
+func nodeReady(registered map[string]data.Node, host string) error {
+	n, ok := registered[host]
+	if !ok {
+		return errors.New("node is not registered with Kubernetes")
+	}
+	for _, c := range n.Status.Conditions {
+		if c.Type != "Ready" {
+			continue
+		}
+		if c.Status == "True" {
+			return nil
+		}
+		return fmt.Errorf("node is not Ready: %s", c.Message)
+	}
+	return errors.New("node has not reported a Ready condition")
+}
+
+// checkAddOns verifies that the deployments and daemon sets in the kube-system namespace are ready
+func checkAddOns(cs *ClusterStatus, kubeClient clusterStatusKubeClient) {
+	deployments, err := kubeClient.ListDeployments("kube-system")
+	if err != nil {
+		cs.add("", "add-on deployments", err)
+	} else if deployments != nil {
+		for _, d := range deployments.Items {
+			desired := int32(1)
+			if d.Spec.Replicas != nil {
+				desired = *d.Spec.Replicas
+			}
+			var err error
+			if d.Status.AvailableReplicas < desired {
+				err = fmt.Errorf("%d of %d replicas are available", d.Status.AvailableReplicas, desired)
+			}
+			cs.add("", "deployment/"+d.Name, err)
+		}
+	}
+	daemonSets, err := kubeClient.ListDaemonSets("kube-system")
+	if err != nil {
+		cs.add("", "add-on daemon sets", err)
+	} else if daemonSets != nil {
+		for _, ds := range daemonSets.Items {
+			var err error
+			if ds.Status.NumberReady < ds.Status.DesiredNumberScheduled {
+				err = fmt.Errorf("%d of %d pods are ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+			}
+			cs.add("", "daemonset/"+ds.Name, err)
+		}
+	}
+}
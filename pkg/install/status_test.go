@@ -0,0 +1,232 @@
+package install
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// fakeSSHClient returns the output registered for the longest command
+// substring that matches the command being run
+type fakeSSHClient struct {
+	outputs map[string]string
+	errors  map[string]error
+}
+
+func (c fakeSSHClient) Output(pty bool, args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	for k, err := range c.errors {
+		if strings.Contains(cmd, k) {
+			return "", err
+		}
+	}
+	var match string
+	for k := range c.outputs {
+		if strings.Contains(cmd, k) && len(k) > len(match) {
+			match = k
+		}
+	}
+	return c.outputs[match], nil
+}
+
+func (c fakeSSHClient) Shell(pty bool, args ...string) error {
+	_, err := c.Output(pty, args...)
+	return err
+}
+
+func healthyNodeClient() fakeSSHClient {
+	return fakeSSHClient{
+		outputs: map[string]string{
+			"systemctl is-active": "active",
+			"docker ps":           "a1b2c3d4",
+			"/health":             `{"health": "true"}`,
+			"/healthz":            "ok",
+			"/v2/members":         `{"members":[{"id":"1","name":"etcd01"}]}`,
+		},
+	}
+}
+
+type fakeStatusKubeClient struct {
+	nodes       *data.NodeList
+	deployments *data.DeploymentList
+	daemonSets  *data.DaemonSetList
+}
+
+func (f fakeStatusKubeClient) ListNodes() (*data.NodeList, error) {
+	return f.nodes, nil
+}
+
+func (f fakeStatusKubeClient) ListDeployments(namespace string) (*data.DeploymentList, error) {
+	return f.deployments, nil
+}
+
+func (f fakeStatusKubeClient) ListDaemonSets(namespace string) (*data.DaemonSetList, error) {
+	return f.daemonSets, nil
+}
+
+func readyNode(name string) data.Node {
+	return data.Node{
+		ObjectMeta: data.ObjectMeta{Name: name},
+		Status: data.NodeStatus{
+			Conditions: []data.NodeCondition{{Type: "Ready", Status: "True"}},
+		},
+	}
+}
+
+func statusTestPlan() Plan {
+	return Plan{
+		Etcd:   NodeGroup{Nodes: []Node{{Host: "etcd01", IP: "10.0.0.1"}}},
+		Master: MasterNodeGroup{Nodes: []Node{{Host: "master01", IP: "10.0.0.2"}}},
+		Worker: NodeGroup{Nodes: []Node{{Host: "worker01", IP: "10.0.0.3"}}},
+	}
+}
+
+func healthyKubeClient() fakeStatusKubeClient {
+	replicas := int32(2)
+	return fakeStatusKubeClient{
+		nodes: &data.NodeList{Items: []data.Node{readyNode("master01"), readyNode("worker01")}},
+		deployments: &data.DeploymentList{Items: []data.Deployment{
+			{
+				ObjectMeta: data.ObjectMeta{Name: "kube-dns"},
+				Spec:       data.DeploymentSpec{Replicas: &replicas},
+				Status:     data.DeploymentStatus{AvailableReplicas: 2},
+			},
+		}},
+	}
+}
+
+func findComponent(cs ClusterStatus, node, component string) *ComponentStatus {
+	for _, c := range cs.Components {
+		if c.Node == node && c.Component == component {
+			return &c
+		}
+	}
+	return nil
+}
+
+func TestGetClusterStatusHealthy(t *testing.T) {
+	sshClient := func(Node) (ssh.Client, error) { return healthyNodeClient(), nil }
+	cs := GetClusterStatus(statusTestPlan(), sshClient, healthyKubeClient())
+	if cs.Degraded() {
+		t.Errorf("expected cluster to be healthy, but got %+v", cs.Components)
+	}
+	expected := []struct{ node, component string }{
+		{"etcd01", "etcd_k8s"},
+		{"etcd01", "etcd_k8s health"},
+		{"master01", "kube-apiserver healthz"},
+		{"master01", "kube-scheduler"},
+		{"worker01", "kubelet"},
+		{"worker01", "calico-node"},
+		{"worker01", "node ready"},
+		{"", "etcd members"},
+		{"", "deployment/kube-dns"},
+	}
+	for _, e := range expected {
+		if findComponent(cs, e.node, e.component) == nil {
+			t.Errorf("expected component %q on node %q to be checked", e.component, e.node)
+		}
+	}
+	if findComponent(cs, "etcd01", "kubelet") != nil {
+		t.Errorf("did not expect kubelet to be checked on etcd node")
+	}
+	if findComponent(cs, "worker01", "kube-apiserver") != nil {
+		t.Errorf("did not expect kube-apiserver to be checked on worker node")
+	}
+}
+
+func TestGetClusterStatusDegraded(t *testing.T) {
+	tests := []struct {
+		name       string
+		sshClient  func(Node) (ssh.Client, error)
+		kubeClient fakeStatusKubeClient
+		node       string
+		component  string
+	}{
+		{
+			name: "unreachable node",
+			sshClient: func(n Node) (ssh.Client, error) {
+				if n.Host == "worker01" {
+					return fakeSSHClient{errors: map[string]error{"true": errors.New("connection refused")}}, nil
+				}
+				return healthyNodeClient(), nil
+			},
+			kubeClient: healthyKubeClient(),
+			node:       "worker01",
+			component:  "ssh",
+		},
+		{
+			name: "kubelet stopped",
+			sshClient: func(n Node) (ssh.Client, error) {
+				c := healthyNodeClient()
+				if n.Host == "worker01" {
+					c.outputs["systemctl is-active kubelet"] = "inactive"
+				}
+				return c, nil
+			},
+			kubeClient: healthyKubeClient(),
+			node:       "worker01",
+			component:  "kubelet",
+		},
+		{
+			name: "missing etcd member",
+			sshClient: func(n Node) (ssh.Client, error) {
+				c := healthyNodeClient()
+				c.outputs["/v2/members"] = `{"members":[]}`
+				return c, nil
+			},
+			kubeClient: healthyKubeClient(),
+			component:  "etcd members",
+		},
+		{
+			name:      "node not ready",
+			sshClient: func(Node) (ssh.Client, error) { return healthyNodeClient(), nil },
+			kubeClient: fakeStatusKubeClient{
+				nodes: &data.NodeList{Items: []data.Node{readyNode("master01")}},
+			},
+			node:      "worker01",
+			component: "node ready",
+		},
+		{
+			name:      "add-on unavailable",
+			sshClient: func(Node) (ssh.Client, error) { return healthyNodeClient(), nil },
+			kubeClient: fakeStatusKubeClient{
+				nodes: healthyKubeClient().nodes,
+				daemonSets: &data.DaemonSetList{Items: []data.DaemonSet{{
+					ObjectMeta: data.ObjectMeta{Name: "calico-node"},
+					Status:     data.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 1},
+				}}},
+			},
+			component: "daemonset/calico-node",
+		},
+	}
+	for _, test := range tests {
+		cs := GetClusterStatus(statusTestPlan(), test.sshClient, test.kubeClient)
+		if !cs.Degraded() {
+			t.Errorf("%s: expected cluster to be degraded", test.name)
+		}
+		c := findComponent(cs, test.node, test.component)
+		if c == nil {
+			t.Errorf("%s: component %q was not checked", test.name, test.component)
+			continue
+		}
+		if c.Healthy {
+			t.Errorf("%s: expected component %q to be unhealthy", test.name, test.component)
+		}
+	}
+}
+
+func TestGetClusterStatusNoMasters(t *testing.T) {
+	plan := statusTestPlan()
+	plan.Master.Nodes = nil
+	cs := GetClusterStatus(plan, func(Node) (ssh.Client, error) { return healthyNodeClient(), nil }, healthyKubeClient())
+	if !cs.Degraded() {
+		t.Errorf("expected cluster to be degraded")
+	}
+	c := findComponent(cs, "", "kubernetes")
+	if c == nil || c.Healthy {
+		t.Errorf("expected component %q to be unhealthy, got %+v", "kubernetes", c)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/data"
 )
@@ -18,6 +19,14 @@ type upgradeKubeInfoClient interface {
 	data.PersistentVolumeClaimGetter
 	data.PersistentVolumeGetter
 	data.StatefulSetGetter
+	data.DeploymentGetter
+	data.PodDisruptionBudgetLister
+}
+
+type upgradeStorageInfoClient interface {
+	ListVolumes() (*data.GlusterVolumeInfoCliOutput, error)
+	data.GlusterVolumeStatusGetter
+	data.GlusterHealInfoGetter
 }
 
 type etcdNodeCountErr struct{}
@@ -44,13 +53,37 @@ func (e masterNodeLoadBalancingErr) Error() string {
 type ingressNotSupportedErr struct{}
 
 func (e ingressNotSupportedErr) Error() string {
-	return "Upgrading this node may result in storage volumes becoming temporarily unavailable."
+	return "Upgrading this node may result in service unavailability if clients are accessing services directly through this ingress point."
 }
 
-type storageNotSupportedErr struct{}
+type volumeNotReplicatedErr struct {
+	volume string
+}
 
-func (e storageNotSupportedErr) Error() string {
-	return "Upgrading this node may result in service unavailability if clients are accessing services directly through this ingress point."
+func (e volumeNotReplicatedErr) Error() string {
+	return fmt.Sprintf("Storage volume %q has a brick on this node, and it is not replicated. "+
+		"Upgrading this node may make the volume unavailable.", e.volume)
+}
+
+type volumeReplicasUnhealthyErr struct {
+	volume   string
+	healthy  int
+	required int
+}
+
+func (e volumeReplicasUnhealthyErr) Error() string {
+	return fmt.Sprintf("Storage volume %q has %d healthy replica(s) of the bricks on this node on other nodes, "+
+		"but at least %d are required. Upgrading this node may make the volume unavailable.", e.volume, e.healthy, e.required)
+}
+
+type volumePendingHealErr struct {
+	volume string
+	brick  string
+}
+
+func (e volumePendingHealErr) Error() string {
+	return fmt.Sprintf("Brick %q of storage volume %q has entries that are pending self-heal. "+
+		"Upgrading this node may result in data loss.", e.brick, e.volume)
 }
 
 type workerNodeCountErr struct{}
@@ -133,10 +166,33 @@ func (e podRunningJobErr) Error() string {
 	return fmt.Sprintf(`Pod that belongs to job "%s/%s" is running on this node.`, e.name, e.namespace)
 }
 
+type podDisruptionBudgetErr struct {
+	namespace          string
+	name               string
+	podsOnNode         int32
+	disruptionsAllowed int32
+}
+
+func (e podDisruptionBudgetErr) Error() string {
+	return fmt.Sprintf(`Draining this node would evict %d pod(s) covered by PodDisruptionBudget "%s/%s", `+
+		"which currently allows %d disruption(s).", e.podsOnNode, e.namespace, e.name, e.disruptionsAllowed)
+}
+
+type multiplePodDisruptionBudgetsErr struct {
+	namespace string
+	name      string
+	budgets   []string
+}
+
+func (e multiplePodDisruptionBudgetsErr) Error() string {
+	return fmt.Sprintf(`Pod "%s/%s" is covered by more than one PodDisruptionBudget (%s), `+
+		"which prevents it from being evicted when draining this node.", e.namespace, e.name, strings.Join(e.budgets, ", "))
+}
+
 // DetectNodeUpgradeSafety determines whether it's safe to upgrade a specific node
 // listed in the plan file. If any condition that could result in data or availability
 // loss is detected, the upgrade is deemed unsafe, and the conditions are returned as errors.
-func DetectNodeUpgradeSafety(plan Plan, node Node, kubeClient upgradeKubeInfoClient) []error {
+func DetectNodeUpgradeSafety(plan Plan, node Node, kubeClient upgradeKubeInfoClient, storageClient upgradeStorageInfoClient) []error {
 	errs := []error{}
 	roles := plan.GetRolesForIP(node.IP)
 	for _, role := range roles {
@@ -158,9 +214,9 @@ func DetectNodeUpgradeSafety(plan Plan, node Node, kubeClient upgradeKubeInfoCli
 			// upgrading an ingress node is potentially unsafe
 			errs = append(errs, ingressNotSupportedErr{})
 		case "storage":
-			// we could potentially detect safety of upgrading storage nodes by inspecting
-			// the volumes on the node. for now, we are choosing not to support online upgrade of storage nodes
-			errs = append(errs, storageNotSupportedErr{})
+			if storageErrs := detectStorageNodeUpgradeSafety(node, storageClient); storageErrs != nil {
+				errs = append(errs, storageErrs...)
+			}
 		case "worker":
 			if plan.Worker.ExpectedCount < 2 {
 				errs = append(errs, workerNodeCountErr{})
@@ -216,6 +272,19 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 		}
 	}
 
+	// Pods that are covered by a PodDisruptionBudget are evaluated against the budget,
+	// as it states how much disruption the workload can tolerate. Draining the node
+	// blocks on evictions that would violate a budget.
+	pdbList, err := kubeClient.ListPodDisruptionBudgets()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to determine node upgrade safety: %v", err))
+	}
+	var pdbs []data.PodDisruptionBudget
+	if pdbList != nil {
+		pdbs = pdbList.Items
+	}
+	pdbPods := map[string]int32{}
+
 	// Keep track of how many pods managed by replication controllers and replicasets
 	// are running on this node. If all replicas are running on the node, we need to
 	// return an error, as it would take the workload down.
@@ -228,19 +297,34 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 	// 3. Are there any daemonset managed pods running on this node? If so,
 	//    verify that it is not the only one
 	// 4. Are there any pods that belong to a job running on this node?
+	// 5. Are there any pods covered by a PodDisruptionBudget that does not
+	//    allow them to be evicted?
 	for _, p := range nodePods {
-		creator, ok := p.Annotations[kubeCreatedBy]
+		r, ok, err := podCreator(p)
 		if !ok {
 			errs = append(errs, unmanagedPodErr{namespace: p.Namespace, name: p.Name})
 			continue
 		}
-		var r data.SerializedReference
-		err := json.Unmarshal([]byte(creator), &r)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("Unable to determine the creator of pod %s/%s", p.Namespace, p.Name))
 			continue
 		}
-		switch strings.ToLower(r.Reference.Kind) {
+		kind := strings.ToLower(r.Reference.Kind)
+		// The budgets are checked in addition to the pod's controller, as a budget
+		// does not make a pod that cannot be rescheduled safe to evict.
+		// Daemon pods are not evicted when draining the node.
+		if kind != "daemonset" {
+			if budgets := podDisruptionBudgetsForPod(p, pdbs); len(budgets) > 1 {
+				var names []string
+				for _, b := range budgets {
+					names = append(names, b.Name)
+				}
+				errs = append(errs, multiplePodDisruptionBudgetsErr{namespace: p.Namespace, name: p.Name, budgets: names})
+			} else if len(budgets) == 1 {
+				pdbPods[budgets[0].Namespace+"/"+budgets[0].Name]++
+			}
+		}
+		switch kind {
 		default:
 			errs = append(errs, fmt.Errorf("Unable to determine upgrade safety for a pod managed by a controller of type %q", r.Reference.Kind))
 		case "daemonset":
@@ -274,7 +358,18 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 				errs = append(errs, fmt.Errorf(`Failed to get information about ReplicaSet "%s/%s"`, r.Reference.Namespace, r.Reference.Name))
 				continue
 			}
-			if rs.Status.Replicas < 2 {
+			// The desired replica count of a ReplicaSet that is managed by a Deployment
+			// is transient during a rollout, so the Deployment's count is used instead
+			if d := deploymentOwner(rs.ObjectMeta); d != "" {
+				dep, err := kubeClient.GetDeployment(r.Reference.Namespace, d)
+				if err != nil || dep == nil {
+					errs = append(errs, fmt.Errorf(`Failed to get information about Deployment "%s/%s"`, r.Reference.Namespace, d))
+					continue
+				}
+				if deploymentReplicas(*dep) < 2 {
+					errs = append(errs, unsafeReplicaCountErr{kind: "Deployment", namespace: r.Reference.Namespace, name: d})
+				}
+			} else if rs.Status.Replicas < 2 {
 				errs = append(errs, unsafeReplicaCountErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
 			}
 			rsPods[r.Reference.Namespace+r.Reference.Name]++
@@ -293,5 +388,303 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 		}
 	}
 
+	for _, pdb := range pdbs {
+		n := pdbPods[pdb.Namespace+"/"+pdb.Name]
+		if n > 0 && n > pdb.Status.PodDisruptionsAllowed {
+			errs = append(errs, podDisruptionBudgetErr{namespace: pdb.Namespace, name: pdb.Name, podsOnNode: n, disruptionsAllowed: pdb.Status.PodDisruptionsAllowed})
+		}
+	}
+
+	return errs
+}
+
+// A storage node is safe to upgrade when every volume that has a brick on the node
+// has enough healthy replicas of the brick on other nodes, and no entries pending self-heal.
+func detectStorageNodeUpgradeSafety(node Node, storageClient upgradeStorageInfoClient) []error {
+	errs := []error{}
+	volumeInfo, err := storageClient.ListVolumes()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to determine node upgrade safety: %v", err))
+		return errs
+	}
+	if volumeInfo == nil {
+		// there are no volumes in the cluster
+		return errs
+	}
+	for _, v := range volumeInfo.VolumeInfo.Volumes.Volume {
+		var bricks []string
+		if v.Bricks != nil {
+			for _, b := range v.Bricks.Brick {
+				bricks = append(bricks, strings.TrimSpace(b.Text))
+			}
+		}
+		onNode := map[int]bool{}
+		for i, b := range bricks {
+			if brickOnNode(b, node) {
+				onNode[i] = true
+			}
+		}
+		if len(onNode) == 0 {
+			continue
+		}
+		if v.ReplicaCount < 2 {
+			errs = append(errs, volumeNotReplicatedErr{volume: v.Name})
+			continue
+		}
+
+		status, err := storageClient.GetVolumeStatus(v.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to get the status of storage volume %q: %v", v.Name, err))
+			continue
+		}
+		online := map[string]bool{}
+		for _, vs := range status.VolumeStatus.Volumes.Volume {
+			for _, n := range vs.Node {
+				online[n.Hostname+":"+n.Path] = n.Status == 1
+			}
+		}
+		// The bricks of a replicated volume are grouped in replica sets of replicaCount bricks,
+		// in the order in which they are listed. Enough bricks of each replica set that has a
+		// brick on this node must remain available for the volume to keep quorum.
+		replicaCount := int(v.ReplicaCount)
+		required := (replicaCount + 1) / 2
+		for start := 0; start < len(bricks); start += replicaCount {
+			end := start + replicaCount
+			if end > len(bricks) {
+				end = len(bricks)
+			}
+			var affected bool
+			healthy := 0
+			for i := start; i < end; i++ {
+				if onNode[i] {
+					affected = true
+					continue
+				}
+				if online[bricks[i]] {
+					healthy++
+				}
+			}
+			if affected && healthy < required {
+				errs = append(errs, volumeReplicasUnhealthyErr{volume: v.Name, healthy: healthy, required: required})
+				break
+			}
+		}
+
+		healInfo, err := storageClient.GetHealInfo(v.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to get the self-heal status of storage volume %q: %v", v.Name, err))
+			continue
+		}
+		for _, b := range healInfo.HealInfo.Bricks.Brick {
+			// The number of entries is not reported for bricks that are not connected,
+			// in which case the heal is also pending
+			if strings.TrimSpace(b.NumberOfEntries) != "0" {
+				errs = append(errs, volumePendingHealErr{volume: v.Name, brick: b.Name})
+			}
+		}
+	}
 	return errs
 }
+
+// bricks are identified by the host and path in the form host:path
+func brickOnNode(brick string, node Node) bool {
+	host := brick
+	if i := strings.Index(brick, ":"); i >= 0 {
+		host = brick[:i]
+	}
+	return strings.EqualFold(host, node.Host) || host == node.IP
+}
+
+// returns the reference to the controller that created the pod. The second return value
+// is false if the pod is not managed by a controller.
+func podCreator(p data.Pod) (data.SerializedReference, bool, error) {
+	var r data.SerializedReference
+	creator, ok := p.Annotations[kubeCreatedBy]
+	if !ok {
+		return r, false, nil
+	}
+	err := json.Unmarshal([]byte(creator), &r)
+	return r, true, err
+}
+
+// WorkloadDisruptions are the workloads that are disrupted when the nodes of the cluster are drained
+type WorkloadDisruptions struct {
+	// Pods is the number of pods of each workload running on a node, keyed by node host and workload
+	Pods map[string]map[string]int32
+	// Allowed is the number of pods of each workload that can be disrupted at the same time
+	Allowed map[string]int32
+}
+
+// DetectWorkloadDisruptions determines the workloads that are disrupted when draining the given nodes.
+// The pods that are covered by a PodDisruptionBudget can be disrupted as long as the budget allows it.
+// Otherwise, all the replicas of a controller but one can be disrupted at the same time. The pods
+// that are not managed by a replicated controller, or that belong to a daemon set, are not accounted for.
+func DetectWorkloadDisruptions(nodes []ListableNode, kubeClient upgradeKubeInfoClient) (*WorkloadDisruptions, error) {
+	podList, err := kubeClient.ListPods()
+	if err != nil {
+		return nil, err
+	}
+	pdbList, err := kubeClient.ListPodDisruptionBudgets()
+	if err != nil {
+		return nil, err
+	}
+	var pdbs []data.PodDisruptionBudget
+	if pdbList != nil {
+		pdbs = pdbList.Items
+	}
+	d := &WorkloadDisruptions{
+		Pods:    map[string]map[string]int32{},
+		Allowed: map[string]int32{},
+	}
+	for _, n := range nodes {
+		d.Pods[n.Node.Host] = map[string]int32{}
+	}
+	if podList == nil {
+		return d, nil
+	}
+	workloads := map[string]string{}
+	for _, p := range podList.Items {
+		nodePods, ok := d.Pods[p.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		r, ok, err := podCreator(p)
+		if !ok || err != nil || strings.ToLower(r.Reference.Kind) == "daemonset" {
+			continue
+		}
+		if budgets := podDisruptionBudgetsForPod(p, pdbs); len(budgets) > 0 {
+			for _, pdb := range budgets {
+				w := fmt.Sprintf(`PodDisruptionBudget "%s/%s"`, pdb.Namespace, pdb.Name)
+				nodePods[w]++
+				d.Allowed[w] = pdb.Status.PodDisruptionsAllowed
+			}
+			continue
+		}
+		// Look up the workload of each controller once
+		controller := r.Reference.Kind + "/" + r.Reference.Namespace + "/" + r.Reference.Name
+		w, ok := workloads[controller]
+		if !ok {
+			var replicas int32
+			w, replicas, err = podWorkload(r.Reference, kubeClient)
+			if err != nil {
+				return nil, err
+			}
+			workloads[controller] = w
+			if w != "" {
+				d.Allowed[w] = replicas - 1
+			}
+		}
+		if w != "" {
+			nodePods[w]++
+		}
+	}
+	return d, nil
+}
+
+// returns the replicated workload that manages the pods created by the controller, along with its replica count
+func podWorkload(ref data.ObjectReference, kubeClient upgradeKubeInfoClient) (string, int32, error) {
+	workload := func(kind, name string) string {
+		return fmt.Sprintf(`%s "%s/%s"`, kind, ref.Namespace, name)
+	}
+	switch strings.ToLower(ref.Kind) {
+	case "replicationcontroller":
+		w := workload("ReplicationController", ref.Name)
+		rc, err := kubeClient.GetReplicationController(ref.Namespace, ref.Name)
+		if err != nil || rc == nil {
+			return "", 0, fmt.Errorf("failed to get information about %s: %v", w, err)
+		}
+		return w, rc.Status.Replicas, nil
+	case "replicaset":
+		w := workload("ReplicaSet", ref.Name)
+		rs, err := kubeClient.GetReplicaSet(ref.Namespace, ref.Name)
+		if err != nil || rs == nil {
+			return "", 0, fmt.Errorf("failed to get information about %s: %v", w, err)
+		}
+		d := deploymentOwner(rs.ObjectMeta)
+		if d == "" {
+			return w, rs.Status.Replicas, nil
+		}
+		w = workload("Deployment", d)
+		dep, err := kubeClient.GetDeployment(ref.Namespace, d)
+		if err != nil || dep == nil {
+			return "", 0, fmt.Errorf("failed to get information about %s: %v", w, err)
+		}
+		return w, deploymentReplicas(*dep), nil
+	case "statefulset":
+		w := workload("StatefulSet", ref.Name)
+		sts, err := kubeClient.GetStatefulSet(ref.Namespace, ref.Name)
+		if err != nil || sts == nil {
+			return "", 0, fmt.Errorf("failed to get information about %s: %v", w, err)
+		}
+		return w, sts.Status.Replicas, nil
+	}
+	return "", 0, nil
+}
+
+// returns the budgets that select the pod
+func podDisruptionBudgetsForPod(pod data.Pod, pdbs []data.PodDisruptionBudget) []data.PodDisruptionBudget {
+	var budgets []data.PodDisruptionBudget
+	for _, pdb := range pdbs {
+		if pdb.Namespace == pod.Namespace && pdb.Spec.Selector.Matches(pod.Labels) {
+			budgets = append(budgets, pdb)
+		}
+	}
+	return budgets
+}
+
+// returns the name of the Deployment that owns the object, if any
+func deploymentOwner(meta data.ObjectMeta) string {
+	for _, o := range meta.OwnerReferences {
+		if o.Kind == "Deployment" {
+			return o.Name
+		}
+	}
+	return ""
+}
+
+func deploymentReplicas(d data.Deployment) int32 {
+	// The number of replicas defaults to 1 when not set
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// WaitForNodesReady waits until the nodes that run the kubelet are registered with
+// Kubernetes and report a Ready condition. An error is returned if any of the nodes
+// is not ready before the timeout.
+func WaitForNodesReady(nodes []ListableNode, kubeClient data.NodeLister, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := nodesReady(nodes, kubeClient)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out waiting for nodes to be ready: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func nodesReady(nodes []ListableNode, kubeClient data.NodeLister) error {
+	nodeList, err := kubeClient.ListNodes()
+	if err != nil {
+		return err
+	}
+	registered := map[string]data.Node{}
+	if nodeList != nil {
+		for _, n := range nodeList.Items {
+			registered[n.Name] = n
+		}
+	}
+	for _, n := range nodes {
+		if len(n.Roles) == 1 && n.Roles[0] == "etcd" {
+			continue
+		}
+		if err := nodeReady(registered, n.Node.Host); err != nil {
+			return fmt.Errorf("node %q: %v", n.Node.Host, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ContainerImagesFile contains the container images, and their versions, that are deployed by this version of Kismatic
+var ContainerImagesFile = filepath.Join("ansible", "group_vars", "container_images.yaml")
+
+// UpgradePlanOptions are the options of the upgrade that is being planned
+type UpgradePlanOptions struct {
+	Online             bool
+	PartialAllowed     bool
+	IgnoreSafetyChecks bool
+	SkipPreflight      bool
+	MaxParallelWorkers int
+	Strategy           UpgradeStrategy
+}
+
+// UpgradePlanChecks are used to inspect the nodes that need to be upgraded
+type UpgradePlanChecks struct {
+	// Safety returns the conditions that make upgrading the node unsafe
+	Safety func(ListableNode) []error
+	// Preflight runs the upgrade pre-flight checks against the node
+	Preflight func(ListableNode) error
+	// Components returns the version changes of the components running on the node
+	Components func(ListableNode) ([]ComponentVersionChange, error)
+	// Disruptions returns the workloads that are disrupted when draining the nodes
+	Disruptions func([]ListableNode) (*WorkloadDisruptions, error)
+	// NodeLabels returns the Kubernetes labels of the nodes, keyed by host
+	NodeLabels func() (map[string]map[string]string, error)
+}
+
+// UpgradePlan describes the changes that an upgrade would make to the cluster
+type UpgradePlan struct {
+	TargetVersion string            `json:"targetVersion"`
+	Online        bool              `json:"online"`
+	Nodes         []NodeUpgradePlan `json:"nodes"`
+	// Batches are the hosts of the nodes in the order in which they would be upgraded.
+	// The nodes in a batch are upgraded in parallel.
+	Batches [][]string `json:"batches"`
+	// Waves are the hosts of the nodes that are upgraded in each wave of a staged upgrade
+	Waves [][]string `json:"waves,omitempty"`
+	// ClusterServices is true if the cluster services would be upgraded after the nodes
+	ClusterServices bool `json:"clusterServices"`
+	// Blockers are the problems that would stop the upgrade
+	Blockers []string `json:"blockers,omitempty"`
+}
+
+// NodeUpgradePlan describes how a node would be upgraded
+type NodeUpgradePlan struct {
+	Node           string   `json:"node"`
+	Roles          []string `json:"roles"`
+	CurrentVersion string   `json:"currentVersion"`
+	Upgrade        bool     `json:"upgrade"`
+	// SkipReason explains why the node would not be upgraded
+	SkipReason     string                   `json:"skipReason,omitempty"`
+	SafetyProblems []string                 `json:"safetyProblems,omitempty"`
+	PreflightError string                   `json:"preflightError,omitempty"`
+	Components     []ComponentVersionChange `json:"components,omitempty"`
+	// ComponentsError explains why the component versions could not be determined
+	ComponentsError string `json:"componentsError,omitempty"`
+}
+
+// ComponentVersionChange is the version change of a component running on a node
+type ComponentVersionChange struct {
+	Component string `json:"component"`
+	Current   string `json:"current"`
+	Target    string `json:"target"`
+}
+
+// Changed returns true if the component would be upgraded
+func (c ComponentVersionChange) Changed() bool {
+	return c.Current != c.Target
+}
+
+// PlanUpgrade computes the upgrade of the cluster without making any changes to it.
+// The nodes that are older than this version of Kismatic are inspected, and are planned
+// to be upgraded using the same rules that are enforced when performing the upgrade.
+func PlanUpgrade(cv ClusterVersion, opts UpgradePlanOptions, checks UpgradePlanChecks) UpgradePlan {
+	up := UpgradePlan{
+		TargetVersion: KismaticVersion.String(),
+		Online:        opts.Online,
+	}
+	var toUpgrade []ListableNode
+	for _, n := range cv.Nodes {
+		np := NodeUpgradePlan{
+			Node:           n.Node.Host,
+			Roles:          n.Roles,
+			CurrentVersion: n.Version.String(),
+		}
+		if !IsOlderVersion(n.Version) {
+			np.SkipReason = "node is at the target version"
+			up.Nodes = append(up.Nodes, np)
+			continue
+		}
+
+		// The safety of the upgrade is always reported, but it is only enforced for online upgrades
+		for _, err := range checks.Safety(n) {
+			np.SafetyProblems = append(np.SafetyProblems, err.Error())
+		}
+		if !opts.SkipPreflight {
+			if err := checks.Preflight(n); err != nil {
+				np.PreflightError = err.Error()
+			}
+		}
+		if components, err := checks.Components(n); err != nil {
+			np.ComponentsError = err.Error()
+		} else {
+			np.Components = components
+		}
+
+		controlPlane := contains("etcd", n.Roles) || contains("master", n.Roles)
+		unsafe := opts.Online && !opts.IgnoreSafetyChecks && len(np.SafetyProblems) > 0
+		// Unless the upgrade is partial, unsafe nodes stop the upgrade until the operator
+		// confirms that it should continue, in which case all the nodes are upgraded
+		switch {
+		case unsafe && (!opts.PartialAllowed || controlPlane):
+			up.Blockers = append(up.Blockers, fmt.Sprintf("Unsafe conditions detected on node %q", n.Node.Host))
+		case unsafe:
+			np.SkipReason = "upgrading the node is unsafe"
+		}
+		switch {
+		case np.PreflightError != "" && (!opts.PartialAllowed || controlPlane):
+			up.Blockers = append(up.Blockers, fmt.Sprintf("Pre-flight checks failed on node %q", n.Node.Host))
+		case np.PreflightError != "" && np.SkipReason == "":
+			np.SkipReason = "pre-flight checks failed"
+		}
+		np.Upgrade = np.SkipReason == ""
+		if np.Upgrade {
+			toUpgrade = append(toUpgrade, n)
+		}
+		up.Nodes = append(up.Nodes, np)
+	}
+
+	var labels map[string]map[string]string
+	if len(opts.Strategy.Selectors) > 0 {
+		var err error
+		if labels, err = checks.NodeLabels(); err != nil {
+			up.Blockers = append(up.Blockers, fmt.Sprintf("Unable to determine the labels of the nodes: %v", err))
+		}
+	}
+	waves := UpgradeWaves(toUpgrade, opts.Strategy, labels)
+	for _, wave := range waves {
+		batches := UpgradeBatches(wave, opts.MaxParallelWorkers)
+		if opts.Online && opts.MaxParallelWorkers > 1 {
+			d, err := checks.Disruptions(wave)
+			if err != nil {
+				up.Blockers = append(up.Blockers, fmt.Sprintf("Unable to determine the worker nodes that can be upgraded in parallel: %v", err))
+			} else {
+				batches = ReplicaAwareUpgradeBatches(wave, opts.MaxParallelWorkers, *d)
+			}
+		}
+		for _, batch := range batches {
+			up.Batches = append(up.Batches, nodeHosts(batch))
+		}
+		if opts.Strategy.Staged() {
+			up.Waves = append(up.Waves, nodeHosts(wave))
+		}
+	}
+	up.ClusterServices = !opts.PartialAllowed
+	return up
+}
+
+func nodeHosts(nodes []ListableNode) []string {
+	var hosts []string
+	for _, n := range nodes {
+		hosts = append(hosts, n.Node.Host)
+	}
+	return hosts
+}
+
+// UpgradeStrategy determines the waves in which the nodes are upgraded during a staged
+// upgrade. The nodes of a wave are verified before the next wave is upgraded. Only one of
+// Percentages, Nodes or Selectors can be set.
+type UpgradeStrategy struct {
+	// Canary is the number of worker nodes that are upgraded in a wave of their own
+	Canary int
+	// Percentages are the cumulative percentages of the rest of the worker nodes that
+	// are upgraded by the end of each wave
+	Percentages []int
+	// Nodes are the hosts of the worker nodes that are upgraded in each wave
+	Nodes [][]string
+	// Selectors select the worker nodes that are upgraded in each wave by their Kubernetes labels
+	Selectors []*data.LabelSelector
+}
+
+// Staged returns true if the nodes are upgraded in multiple waves
+func (s UpgradeStrategy) Staged() bool {
+	return s.Canary > 0 || len(s.Percentages) > 0 || len(s.Nodes) > 0 || len(s.Selectors) > 0
+}
+
+// Validate returns an error if the strategy is invalid
+func (s UpgradeStrategy) Validate() error {
+	if s.Canary < 0 {
+		return fmt.Errorf("the number of canary nodes must be greater or equal to 0, got: %d", s.Canary)
+	}
+	set := 0
+	for _, l := range []int{len(s.Percentages), len(s.Nodes), len(s.Selectors)} {
+		if l > 0 {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of wave percentages, wave nodes or wave selectors can be provided")
+	}
+	prev := 0
+	for _, p := range s.Percentages {
+		if p <= prev || p > 100 {
+			return fmt.Errorf("wave percentages must be increasing values between 1 and 100, got: %v", s.Percentages)
+		}
+		prev = p
+	}
+	return nil
+}
+
+// UpgradeWaves splits the nodes into the waves in which they are upgraded. The etcd and master
+// nodes are upgraded in the first wave, followed by the canary wave. The rest of the nodes
+// are split according to the strategy, and the nodes that are not part of any wave are
+// upgraded in the last wave. The labels of the nodes are keyed by host, and are only used
+// when the strategy has selectors.
+func UpgradeWaves(nodes []ListableNode, s UpgradeStrategy, labels map[string]map[string]string) [][]ListableNode {
+	var waves [][]ListableNode
+	add := func(wave []ListableNode) {
+		if len(wave) > 0 {
+			waves = append(waves, wave)
+		}
+	}
+	if !s.Staged() {
+		add(nodes)
+		return waves
+	}
+	var controlPlane, rest []ListableNode
+	for _, n := range nodes {
+		if contains("etcd", n.Roles) || contains("master", n.Roles) {
+			controlPlane = append(controlPlane, n)
+		} else {
+			rest = append(rest, n)
+		}
+	}
+	add(controlPlane)
+	if s.Canary > 0 {
+		c := s.Canary
+		if c > len(rest) {
+			c = len(rest)
+		}
+		add(rest[:c])
+		rest = rest[c:]
+	}
+	// splits the rest of the nodes into the ones that match and the ones that don't
+	split := func(match func(ListableNode) bool) []ListableNode {
+		var wave, remaining []ListableNode
+		for _, n := range rest {
+			if match(n) {
+				wave = append(wave, n)
+			} else {
+				remaining = append(remaining, n)
+			}
+		}
+		rest = remaining
+		return wave
+	}
+	switch {
+	case len(s.Percentages) > 0:
+		total, done := len(rest), 0
+		for _, p := range s.Percentages {
+			upTo := (total*p + 99) / 100
+			add(rest[done:upTo])
+			done = upTo
+		}
+		rest = rest[done:]
+	case len(s.Nodes) > 0:
+		for _, list := range s.Nodes {
+			add(split(func(n ListableNode) bool { return contains(n.Node.Host, list) }))
+		}
+	case len(s.Selectors) > 0:
+		for _, selector := range s.Selectors {
+			add(split(func(n ListableNode) bool { return selector.Matches(labels[n.Node.Host]) }))
+		}
+	}
+	add(rest)
+	return waves
+}
+
+// UpgradeBatches returns the nodes in the order in which they are upgraded.
+// Etcd nodes are upgraded first, followed by the master nodes, one node at a time.
+// The rest of the nodes are upgraded in batches of up to maxParallelWorkers nodes.
+func UpgradeBatches(nodes []ListableNode, maxParallelWorkers int) [][]ListableNode {
+	return upgradeBatches(nodes, maxParallelWorkers, func([]ListableNode, ListableNode) bool { return true })
+}
+
+// ReplicaAwareUpgradeBatches returns the nodes in the order in which they are upgraded during
+// an online upgrade. Etcd and master nodes are upgraded one node at a time. Worker nodes are
+// upgraded in batches of up to maxParallelWorkers nodes, such that draining the nodes of a
+// batch does not take down all the replicas of a workload, nor violates a PodDisruptionBudget.
+// Nodes that have other roles besides worker are upgraded one node at a time.
+func ReplicaAwareUpgradeBatches(nodes []ListableNode, maxParallelWorkers int, disruptions WorkloadDisruptions) [][]ListableNode {
+	workerOnly := func(n ListableNode) bool {
+		return len(n.Roles) == 1 && n.Roles[0] == "worker"
+	}
+	fits := func(batch []ListableNode, n ListableNode) bool {
+		if !workerOnly(n) {
+			return false
+		}
+		disrupted := map[string]int32{}
+		for w, count := range disruptions.Pods[n.Node.Host] {
+			disrupted[w] += count
+		}
+		for _, b := range batch {
+			if !workerOnly(b) {
+				return false
+			}
+			for w, count := range disruptions.Pods[b.Node.Host] {
+				disrupted[w] += count
+			}
+		}
+		for w, count := range disrupted {
+			if allowed, ok := disruptions.Allowed[w]; ok && count > allowed {
+				return false
+			}
+		}
+		return true
+	}
+	return upgradeBatches(nodes, maxParallelWorkers, fits)
+}
+
+// upgradeBatches schedules the etcd and master nodes one node at a time. Each of the rest of
+// the nodes is added to the first batch that has room for it, and that it fits in.
+func upgradeBatches(nodes []ListableNode, maxParallelWorkers int, fits func(batch []ListableNode, n ListableNode) bool) [][]ListableNode {
+	if maxParallelWorkers < 1 {
+		maxParallelWorkers = 1
+	}
+	// Nodes can have multiple roles. For this reason, we need to keep track of which nodes
+	// have been scheduled to avoid upgrading them twice.
+	scheduled := map[string]bool{}
+	var batches [][]ListableNode
+	for _, role := range []string{"etcd", "master"} {
+		for _, n := range nodes {
+			if !scheduled[n.Node.IP] && contains(role, n.Roles) {
+				batches = append(batches, []ListableNode{n})
+				scheduled[n.Node.IP] = true
+			}
+		}
+	}
+	var workerBatches [][]ListableNode
+	for _, n := range nodes {
+		if scheduled[n.Node.IP] {
+			continue
+		}
+		scheduled[n.Node.IP] = true
+		placed := false
+		for i, b := range workerBatches {
+			if len(b) < maxParallelWorkers && fits(b, n) {
+				workerBatches[i] = append(b, n)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			workerBatches = append(workerBatches, []ListableNode{n})
+		}
+	}
+	return append(batches, workerBatches...)
+}
+
+// ContainerImage is a container image deployed by Kismatic
+type ContainerImage struct {
+	Name    string
+	Version string
+}
+
+// ReadContainerImages reads the container images that are deployed by this version of Kismatic
+func ReadContainerImages(file string) (map[string]ContainerImage, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading container images: %v", err)
+	}
+	images := struct {
+		OfficialImages map[string]ContainerImage `yaml:"official_images"`
+	}{}
+	if err = yaml.Unmarshal(b, &images); err != nil {
+		return nil, fmt.Errorf("error unmarshalling container images: %v", err)
+	}
+	return images.OfficialImages, nil
+}
+
+// the components that are upgraded on the nodes, along with the container image they run
+type upgradeComponent struct {
+	component string
+	image     string
+	roles     []string
+}
+
+func upgradeComponents(plan Plan) []upgradeComponent {
+	kubeletRoles := []string{"master", "worker", "ingress", "storage"}
+	components := []upgradeComponent{
+		{component: "etcd", image: "etcd", roles: []string{"etcd"}},
+		{component: "kube-apiserver", image: "kube_apiserver", roles: []string{"master"}},
+		{component: "kube-controller-manager", image: "kube_controller_manager", roles: []string{"master"}},
+		{component: "kube-scheduler", image: "kube_scheduler", roles: []string{"master"}},
+		{component: "kube-proxy", image: "kube_proxy", roles: kubeletRoles},
+	}
+	if plan.NetworkConfigured() && (plan.AddOns.CNI == nil || plan.AddOns.CNI.Provider == cniProviderCalico) {
+		components = append(components, upgradeComponent{component: "calico-node", image: "calico_node", roles: kubeletRoles})
+	}
+	return components
+}
+
+// NodeComponentVersions returns the version changes of the components running on the node.
+// The current versions are determined from the container images of the running containers,
+// and from the version of the kubelet binary.
+func NodeComponentVersions(plan Plan, images map[string]ContainerImage, node ListableNode, client ssh.Client) ([]ComponentVersionChange, error) {
+	out, err := client.Output(false, `sudo docker ps --format "{{.Image}}"`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %s", strings.TrimSpace(out))
+	}
+	running := strings.Fields(out)
+	var changes []ComponentVersionChange
+	for _, c := range upgradeComponents(plan) {
+		if !containsAny(c.roles, node.Roles) {
+			continue
+		}
+		target := images[c.image]
+		changes = append(changes, ComponentVersionChange{
+			Component: c.component,
+			Current:   runningImageVersion(running, target.Name),
+			Target:    target.Version,
+		})
+	}
+	if containsAny([]string{"master", "worker", "ingress", "storage"}, node.Roles) {
+		// The kubelet is installed from the packages of the same Kubernetes release as kube-proxy
+		current := "unknown"
+		if out, err := client.Output(false, "kubelet --version"); err == nil {
+			current = strings.TrimPrefix(strings.TrimSpace(out), "Kubernetes ")
+		}
+		changes = append(changes, ComponentVersionChange{
+			Component: "kubelet",
+			Current:   current,
+			Target:    images["kube_proxy"].Version,
+		})
+	}
+	return changes, nil
+}
+
+// returns the tag of the running image with the given name, which can be
+// prefixed by the address of a private registry
+func runningImageVersion(running []string, name string) string {
+	for _, image := range running {
+		i := strings.LastIndex(image, ":")
+		if i < 0 || strings.Contains(image[i:], "/") {
+			continue
+		}
+		repo := image[:i]
+		if repo == name || strings.HasSuffix(repo, "/"+name) {
+			return image[i+1:]
+		}
+	}
+	return "not running"
+}
@@ -0,0 +1,400 @@
+package install
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/blang/semver"
+)
+
+func listableNode(host string, version string, roles ...string) ListableNode {
+	return ListableNode{
+		Node:    Node{Host: host, IP: host},
+		Roles:   roles,
+		Version: semver.MustParse(version),
+	}
+}
+
+func batchHosts(batches [][]ListableNode) [][]string {
+	var hosts [][]string
+	for _, b := range batches {
+		var h []string
+		for _, n := range b {
+			h = append(h, n.Node.Host)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+func TestUpgradeBatches(t *testing.T) {
+	nodes := []ListableNode{
+		listableNode("worker01", "1.0.0", "worker"),
+		listableNode("master01", "1.0.0", "master"),
+		listableNode("worker02", "1.0.0", "worker"),
+		listableNode("etcd01", "1.0.0", "etcd", "master"),
+		listableNode("ingress01", "1.0.0", "ingress"),
+		listableNode("etcd02", "1.0.0", "etcd"),
+	}
+	tests := []struct {
+		maxParallelWorkers int
+		expected           [][]string
+	}{
+		{
+			maxParallelWorkers: 1,
+			expected:           [][]string{{"etcd01"}, {"etcd02"}, {"master01"}, {"worker01"}, {"worker02"}, {"ingress01"}},
+		},
+		{
+			maxParallelWorkers: 2,
+			expected:           [][]string{{"etcd01"}, {"etcd02"}, {"master01"}, {"worker01", "worker02"}, {"ingress01"}},
+		},
+		{
+			maxParallelWorkers: 5,
+			expected:           [][]string{{"etcd01"}, {"etcd02"}, {"master01"}, {"worker01", "worker02", "ingress01"}},
+		},
+	}
+	for _, test := range tests {
+		batches := batchHosts(UpgradeBatches(nodes, test.maxParallelWorkers))
+		if !reflect.DeepEqual(batches, test.expected) {
+			t.Errorf("max parallel workers %d: expected batches %v, but got %v", test.maxParallelWorkers, test.expected, batches)
+		}
+	}
+}
+
+func TestUpgradeBatchesRemainingWorkersAfterControlPlane(t *testing.T) {
+	// The last node in the list is a master node, the workers before it are still upgraded
+	nodes := []ListableNode{
+		listableNode("worker01", "1.0.0", "worker"),
+		listableNode("master01", "1.0.0", "master"),
+	}
+	batches := batchHosts(UpgradeBatches(nodes, 2))
+	expected := [][]string{{"master01"}, {"worker01"}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected batches %v, but got %v", expected, batches)
+	}
+}
+
+func TestReplicaAwareUpgradeBatches(t *testing.T) {
+	nodes := []ListableNode{
+		listableNode("etcd01", "1.0.0", "etcd"),
+		listableNode("master01", "1.0.0", "master"),
+		listableNode("worker01", "1.0.0", "worker"),
+		listableNode("worker02", "1.0.0", "worker"),
+		listableNode("worker03", "1.0.0", "worker"),
+		listableNode("worker04", "1.0.0", "worker"),
+		listableNode("storage01", "1.0.0", "worker", "storage"),
+		listableNode("worker05", "1.0.0", "worker"),
+	}
+	disruptions := WorkloadDisruptions{
+		Pods: map[string]map[string]int32{
+			// the last replicas of the deployment are on worker01 and worker02
+			"worker01": {`Deployment "default/foo"`: 1},
+			"worker02": {`Deployment "default/foo"`: 1},
+			// the budget allows a single disruption
+			"worker03": {`PodDisruptionBudget "default/bar"`: 1},
+			"worker04": {`PodDisruptionBudget "default/bar"`: 1, `StatefulSet "default/baz"`: 1},
+			"worker05": {`StatefulSet "default/baz"`: 1},
+		},
+		Allowed: map[string]int32{
+			`Deployment "default/foo"`:          1,
+			`PodDisruptionBudget "default/bar"`: 1,
+			`StatefulSet "default/baz"`:         2,
+		},
+	}
+	tests := []struct {
+		maxParallelWorkers int
+		expected           [][]string
+	}{
+		{
+			maxParallelWorkers: 1,
+			expected:           [][]string{{"etcd01"}, {"master01"}, {"worker01"}, {"worker02"}, {"worker03"}, {"worker04"}, {"storage01"}, {"worker05"}},
+		},
+		{
+			maxParallelWorkers: 2,
+			expected:           [][]string{{"etcd01"}, {"master01"}, {"worker01", "worker03"}, {"worker02", "worker04"}, {"storage01"}, {"worker05"}},
+		},
+		{
+			maxParallelWorkers: 5,
+			expected:           [][]string{{"etcd01"}, {"master01"}, {"worker01", "worker03", "worker05"}, {"worker02", "worker04"}, {"storage01"}},
+		},
+	}
+	for _, test := range tests {
+		batches := batchHosts(ReplicaAwareUpgradeBatches(nodes, test.maxParallelWorkers, disruptions))
+		if !reflect.DeepEqual(batches, test.expected) {
+			t.Errorf("max parallel workers %d: expected batches %v, but got %v", test.maxParallelWorkers, test.expected, batches)
+		}
+	}
+}
+
+func TestUpgradeStrategyValidate(t *testing.T) {
+	tests := []struct {
+		strategy UpgradeStrategy
+		valid    bool
+	}{
+		{strategy: UpgradeStrategy{}, valid: true},
+		{strategy: UpgradeStrategy{Canary: 1, Percentages: []int{25, 50, 100}}, valid: true},
+		{strategy: UpgradeStrategy{Canary: 1, Nodes: [][]string{{"worker01"}}}, valid: true},
+		{strategy: UpgradeStrategy{Canary: -1}, valid: false},
+		{strategy: UpgradeStrategy{Percentages: []int{50, 25}}, valid: false},
+		{strategy: UpgradeStrategy{Percentages: []int{0, 50}}, valid: false},
+		{strategy: UpgradeStrategy{Percentages: []int{50, 150}}, valid: false},
+		{strategy: UpgradeStrategy{Percentages: []int{50}, Nodes: [][]string{{"worker01"}}}, valid: false},
+	}
+	for i, test := range tests {
+		err := test.strategy.Validate()
+		if test.valid && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("test %d: expected an error, but didn't get one", i)
+		}
+	}
+}
+
+func TestUpgradeWaves(t *testing.T) {
+	nodes := []ListableNode{
+		listableNode("etcd01", "1.0.0", "etcd"),
+		listableNode("worker01", "1.0.0", "worker"),
+		listableNode("master01", "1.0.0", "master"),
+		listableNode("worker02", "1.0.0", "worker"),
+		listableNode("worker03", "1.0.0", "worker"),
+		listableNode("worker04", "1.0.0", "worker"),
+		listableNode("ingress01", "1.0.0", "ingress"),
+	}
+	labels := map[string]map[string]string{
+		"worker02":  {"zone": "a"},
+		"worker04":  {"zone": "a"},
+		"ingress01": {"zone": "b"},
+	}
+	tests := []struct {
+		name     string
+		strategy UpgradeStrategy
+		expected [][]string
+	}{
+		{
+			name:     "not staged",
+			expected: [][]string{{"etcd01", "worker01", "master01", "worker02", "worker03", "worker04", "ingress01"}},
+		},
+		{
+			name:     "canary",
+			strategy: UpgradeStrategy{Canary: 2},
+			expected: [][]string{{"etcd01", "master01"}, {"worker01", "worker02"}, {"worker03", "worker04", "ingress01"}},
+		},
+		{
+			name:     "canary larger than the cluster",
+			strategy: UpgradeStrategy{Canary: 10},
+			expected: [][]string{{"etcd01", "master01"}, {"worker01", "worker02", "worker03", "worker04", "ingress01"}},
+		},
+		{
+			name:     "percentages",
+			strategy: UpgradeStrategy{Canary: 1, Percentages: []int{25, 50}},
+			expected: [][]string{{"etcd01", "master01"}, {"worker01"}, {"worker02"}, {"worker03"}, {"worker04", "ingress01"}},
+		},
+		{
+			name:     "nodes",
+			strategy: UpgradeStrategy{Nodes: [][]string{{"worker03", "worker04"}, {"ingress01", "worker03"}}},
+			expected: [][]string{{"etcd01", "master01"}, {"worker03", "worker04"}, {"ingress01"}, {"worker01", "worker02"}},
+		},
+		{
+			name: "selectors",
+			strategy: UpgradeStrategy{Canary: 1, Selectors: []*data.LabelSelector{
+				{MatchLabels: map[string]string{"zone": "a"}},
+				{MatchLabels: map[string]string{"zone": "c"}},
+			}},
+			expected: [][]string{{"etcd01", "master01"}, {"worker01"}, {"worker02", "worker04"}, {"worker03", "ingress01"}},
+		},
+	}
+	for _, test := range tests {
+		waves := batchHosts(UpgradeWaves(nodes, test.strategy, labels))
+		if !reflect.DeepEqual(waves, test.expected) {
+			t.Errorf("%s: expected waves %v, but got %v", test.name, test.expected, waves)
+		}
+	}
+}
+
+func upgradePlanChecks(unsafe, unready map[string]bool, disruptions WorkloadDisruptions) UpgradePlanChecks {
+	return UpgradePlanChecks{
+		Safety: func(n ListableNode) []error {
+			if unsafe[n.Node.Host] {
+				return []error{errors.New("unsafe")}
+			}
+			return nil
+		},
+		Preflight: func(n ListableNode) error {
+			if unready[n.Node.Host] {
+				return errors.New("preflight failed")
+			}
+			return nil
+		},
+		Components: func(n ListableNode) ([]ComponentVersionChange, error) {
+			return []ComponentVersionChange{{Component: "kubelet", Current: "v1.7.0", Target: "v1.8.4"}}, nil
+		},
+		Disruptions: func([]ListableNode) (*WorkloadDisruptions, error) {
+			return &disruptions, nil
+		},
+		NodeLabels: func() (map[string]map[string]string, error) {
+			return map[string]map[string]string{"worker02": {"zone": "a"}}, nil
+		},
+	}
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	SetVersion("1.6.0")
+	cv := ClusterVersion{
+		Nodes: []ListableNode{
+			listableNode("etcd01", "1.5.0", "etcd"),
+			listableNode("master01", "1.6.0", "master"),
+			listableNode("worker01", "1.5.0", "worker"),
+			listableNode("worker02", "1.5.0", "worker"),
+		},
+	}
+	tests := []struct {
+		name             string
+		opts             UpgradePlanOptions
+		unsafe           map[string]bool
+		unready          map[string]bool
+		disruptions      WorkloadDisruptions
+		expectedBatches  [][]string
+		expectedWaves    [][]string
+		expectedSkipped  []string
+		expectedBlockers int
+	}{
+		{
+			name:            "offline upgrade",
+			opts:            UpgradePlanOptions{MaxParallelWorkers: 2},
+			unsafe:          map[string]bool{"worker01": true},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01", "worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name:            "online upgrade upgrades workers in parallel",
+			opts:            UpgradePlanOptions{Online: true, MaxParallelWorkers: 2},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01", "worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name: "online upgrade does not drain the last replicas in parallel",
+			opts: UpgradePlanOptions{Online: true, MaxParallelWorkers: 2},
+			disruptions: WorkloadDisruptions{
+				Pods: map[string]map[string]int32{
+					"worker01": {`Deployment "default/foo"`: 1},
+					"worker02": {`Deployment "default/foo"`: 1},
+				},
+				Allowed: map[string]int32{`Deployment "default/foo"`: 1},
+			},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name:             "online upgrade blocked by unsafe worker",
+			opts:             UpgradePlanOptions{Online: true, MaxParallelWorkers: 1},
+			unsafe:           map[string]bool{"worker01": true},
+			expectedBatches:  [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedSkipped:  []string{"master01"},
+			expectedBlockers: 1,
+		},
+		{
+			name:            "partial online upgrade skips unsafe worker",
+			opts:            UpgradePlanOptions{Online: true, PartialAllowed: true, MaxParallelWorkers: 1},
+			unsafe:          map[string]bool{"worker01": true},
+			expectedBatches: [][]string{{"etcd01"}, {"worker02"}},
+			expectedSkipped: []string{"master01", "worker01"},
+		},
+		{
+			name:            "online upgrade ignoring safety checks",
+			opts:            UpgradePlanOptions{Online: true, IgnoreSafetyChecks: true, MaxParallelWorkers: 1},
+			unsafe:          map[string]bool{"worker01": true},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name:             "partial upgrade blocked by etcd node",
+			opts:             UpgradePlanOptions{PartialAllowed: true, MaxParallelWorkers: 1},
+			unready:          map[string]bool{"etcd01": true, "worker02": true},
+			expectedBatches:  [][]string{{"etcd01"}, {"worker01"}},
+			expectedSkipped:  []string{"master01", "worker02"},
+			expectedBlockers: 1,
+		},
+		{
+			name:            "pre-flight checks skipped",
+			opts:            UpgradePlanOptions{SkipPreflight: true, MaxParallelWorkers: 1},
+			unready:         map[string]bool{"worker01": true},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name:            "staged upgrade with a canary",
+			opts:            UpgradePlanOptions{MaxParallelWorkers: 2, Strategy: UpgradeStrategy{Canary: 1}},
+			expectedBatches: [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedWaves:   [][]string{{"etcd01"}, {"worker01"}, {"worker02"}},
+			expectedSkipped: []string{"master01"},
+		},
+		{
+			name:            "staged upgrade with selectors",
+			opts:            UpgradePlanOptions{MaxParallelWorkers: 2, Strategy: UpgradeStrategy{Selectors: []*data.LabelSelector{{MatchLabels: map[string]string{"zone": "a"}}}}},
+			expectedBatches: [][]string{{"etcd01"}, {"worker02"}, {"worker01"}},
+			expectedWaves:   [][]string{{"etcd01"}, {"worker02"}, {"worker01"}},
+			expectedSkipped: []string{"master01"},
+		},
+	}
+	for _, test := range tests {
+		up := PlanUpgrade(cv, test.opts, upgradePlanChecks(test.unsafe, test.unready, test.disruptions))
+		if !reflect.DeepEqual(up.Batches, test.expectedBatches) {
+			t.Errorf("%s: expected batches %v, but got %v", test.name, test.expectedBatches, up.Batches)
+		}
+		if !reflect.DeepEqual(up.Waves, test.expectedWaves) {
+			t.Errorf("%s: expected waves %v, but got %v", test.name, test.expectedWaves, up.Waves)
+		}
+		var skipped []string
+		for _, n := range up.Nodes {
+			if !n.Upgrade {
+				skipped = append(skipped, n.Node)
+			}
+		}
+		if !reflect.DeepEqual(skipped, test.expectedSkipped) {
+			t.Errorf("%s: expected skipped nodes %v, but got %v", test.name, test.expectedSkipped, skipped)
+		}
+		if len(up.Blockers) != test.expectedBlockers {
+			t.Errorf("%s: expected %d blockers, but got %v", test.name, test.expectedBlockers, up.Blockers)
+		}
+		if up.ClusterServices == test.opts.PartialAllowed {
+			t.Errorf("%s: cluster services upgrade is %v for a partial upgrade %v", test.name, up.ClusterServices, test.opts.PartialAllowed)
+		}
+	}
+}
+
+func TestNodeComponentVersions(t *testing.T) {
+	images, err := ReadContainerImages("../../ansible/group_vars/container_images.yaml")
+	if err != nil {
+		t.Fatalf("error reading container images: %v", err)
+	}
+	client := fakeSSHClient{
+		outputs: map[string]string{
+			"docker ps":         "quay.io/coreos/etcd:v3.1.10\nregistry.local:5000/gcr.io/google-containers/kube-apiserver-amd64:v1.7.6\ngcr.io/google-containers/kube-proxy-amd64:v1.7.6\n",
+			"kubelet --version": "Kubernetes v1.7.6\n",
+		},
+	}
+	plan := Plan{AddOns: AddOns{CNI: &CNI{Provider: cniProviderCalico}}}
+	node := listableNode("master01", "1.5.0", "etcd", "master")
+	changes, err := NodeComponentVersions(plan, images, node, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []ComponentVersionChange{
+		{Component: "etcd", Current: "v3.1.10", Target: images["etcd"].Version},
+		{Component: "kube-apiserver", Current: "v1.7.6", Target: images["kube_apiserver"].Version},
+		{Component: "kube-controller-manager", Current: "not running", Target: images["kube_controller_manager"].Version},
+		{Component: "kube-scheduler", Current: "not running", Target: images["kube_scheduler"].Version},
+		{Component: "kube-proxy", Current: "v1.7.6", Target: images["kube_proxy"].Version},
+		{Component: "calico-node", Current: "not running", Target: images["calico_node"].Version},
+		{Component: "kubelet", Current: "v1.7.6", Target: images["kube_proxy"].Version},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected component versions\n%v\nbut got\n%v", expected, changes)
+	}
+	if changes[0].Changed() {
+		t.Errorf("etcd is at the target version, but was reported as changed")
+	}
+}
@@ -0,0 +1,98 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// PrePulledImage is a container image that was pulled on a node before it was upgraded
+type PrePulledImage struct {
+	Image  string `json:"image"`
+	Pulled bool   `json:"pulled"`
+}
+
+// NodePrePullResult is the outcome of pulling the new container images and staging
+// the new packages on a node before it is upgraded
+type NodePrePullResult struct {
+	Host   string           `json:"-"`
+	Images []PrePulledImage `json:"images"`
+	// Packages is one of "staged", "failed" or "skipped"
+	Packages string `json:"packages"`
+	// Error is set if the outcome could not be determined
+	Error string `json:"-"`
+}
+
+// Failed returns true if any of the images or packages could not be downloaded
+func (r NodePrePullResult) Failed() bool {
+	if r.Error != "" || r.Packages == "failed" {
+		return true
+	}
+	for _, i := range r.Images {
+		if !i.Pulled {
+			return true
+		}
+	}
+	return false
+}
+
+// PrePullUpgrade pulls the container images and downloads the packages that are
+// deployed by this version of Kismatic on the nodes, in parallel, without changing
+// anything that is running on them. A failure to download is reported for the node,
+// instead of failing the operation, as the downloads are retried when the node is upgraded.
+func (ae *ansibleExecutor) PrePullUpgrade(plan Plan, nodes []ListableNode) ([]NodePrePullResult, error) {
+	if ae.options.DryRun {
+		return nil, nil
+	}
+	reportDir, err := ioutil.TempDir("", "kismatic-prepull")
+	if err != nil {
+		return nil, fmt.Errorf("error creating pre-pull report directory: %v", err)
+	}
+	defer os.RemoveAll(reportDir)
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return nil, err
+	}
+	cc.PrePullReportDirectory = reportDir
+	var limit []string
+	for _, n := range nodes {
+		limit = append(limit, n.Node.Host)
+	}
+	t := task{
+		name:           "upgrade-prepull",
+		playbook:       "upgrade-prepull.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          limit,
+	}
+	util.PrintHeader(ae.stdout, "Pre-Pull Upgrade Images and Packages", '=')
+	if err = ae.execute(t); err != nil {
+		return nil, fmt.Errorf("error pre-pulling upgrade images and packages: %v", err)
+	}
+	return readPrePullReports(reportDir, nodes), nil
+}
+
+// readPrePullReports reads the report written by each node into the directory
+func readPrePullReports(dir string, nodes []ListableNode) []NodePrePullResult {
+	var results []NodePrePullResult
+	for _, n := range nodes {
+		r := NodePrePullResult{}
+		b, err := ioutil.ReadFile(filepath.Join(dir, n.Node.Host+".json"))
+		if err == nil {
+			err = json.Unmarshal(b, &r)
+		}
+		if err != nil {
+			r = NodePrePullResult{Error: fmt.Sprintf("error reading pre-pull report: %v", err)}
+		}
+		r.Host = n.Node.Host
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,50 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPrePullReports(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	reports := map[string]string{
+		"master01": `{"images": [{"image": "kube-apiserver:v1.8.4", "pulled": true}], "packages": "staged"}`,
+		"worker01": `{"images": [{"image": "kube-proxy:v1.8.4", "pulled": false}], "packages": "skipped"}`,
+		"worker02": `{"images": [], "packages": "failed"}`,
+		"worker03": `not json`,
+	}
+	for host, r := range reports {
+		if err := ioutil.WriteFile(filepath.Join(dir, host+".json"), []byte(r), 0644); err != nil {
+			t.Fatalf("error writing report: %v", err)
+		}
+	}
+	var nodes []ListableNode
+	for _, host := range []string{"master01", "worker01", "worker02", "worker03", "worker04"} {
+		nodes = append(nodes, ListableNode{Node: Node{Host: host}})
+	}
+	results := readPrePullReports(dir, nodes)
+	if len(results) != len(nodes) {
+		t.Fatalf("expected %d results, got %d", len(nodes), len(results))
+	}
+	expectedFailed := map[string]bool{
+		"master01": false,
+		"worker01": true,
+		"worker02": true,
+		"worker03": true,
+		"worker04": true,
+	}
+	for i, r := range results {
+		if r.Host != nodes[i].Node.Host {
+			t.Errorf("expected result %d to be for %q, got %q", i, nodes[i].Node.Host, r.Host)
+		}
+		if r.Failed() != expectedFailed[r.Host] {
+			t.Errorf("%s: expected failed to be %v, got %v: %+v", r.Host, expectedFailed[r.Host], r.Failed(), r)
+		}
+	}
+	if len(results[0].Images) != 1 || results[0].Images[0].Image != "kube-apiserver:v1.8.4" || results[0].Packages != "staged" {
+		t.Errorf("unexpected result for master01: %+v", results[0])
+	}
+}
@@ -0,0 +1,67 @@
+package install
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// RollbackNode restores the node to the state that was recorded before it was
+// upgraded, and validates that it is running again. The package versions and the
+// configuration of the node are restored from the backup taken by the upgrade.
+// The backup is kept, so that the rollback can be retried until it is removed
+// with RemoveUpgradeBackup.
+func (ae *ansibleExecutor) RollbackNode(plan Plan, node Node) error {
+	if err := checkRollbackPrereqs(plan, node); err != nil {
+		return err
+	}
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "upgrade-rollback",
+		playbook:       "upgrade-rollback.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{node.Host},
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Roll Back Node: %s %v", node.Host, plan.GetRolesForIP(node.IP)), '=')
+	return ae.execute(t)
+}
+
+// RemoveUpgradeBackup removes the backup taken before the node was upgraded
+func (ae *ansibleExecutor) RemoveUpgradeBackup(plan Plan, node Node) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "upgrade-backup-cleanup",
+		playbook:       "_upgrade-backup-cleanup.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{node.Host},
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Remove Upgrade Backup: %s", node.Host), '=')
+	return ae.execute(t)
+}
+
+// only master and worker nodes can be rolled back, as the data of an etcd member
+// cannot be downgraded. Etcd is restored from the backup taken before the upgrade instead.
+func checkRollbackPrereqs(plan Plan, node Node) error {
+	roles := plan.GetRolesForIP(node.IP)
+	if len(roles) == 0 {
+		return fmt.Errorf("node %q is not in the plan file", node.Host)
+	}
+	if contains("etcd", roles) {
+		return fmt.Errorf("node %q has the roles %v. Nodes that are etcd members cannot be rolled back, use %q to restore the etcd cluster instead", node.Host, roles, "kismatic etcd restore")
+	}
+	return nil
+}
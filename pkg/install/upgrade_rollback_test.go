@@ -0,0 +1,173 @@
+package install
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func rollbackTestPlan() Plan {
+	return Plan{
+		Cluster: Cluster{
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+		Etcd: NodeGroup{
+			Nodes: []Node{{Host: "etcd01", IP: "10.0.0.1"}},
+		},
+		Master: MasterNodeGroup{
+			Nodes: []Node{{Host: "master01", IP: "10.0.0.2"}},
+		},
+		Worker: NodeGroup{
+			Nodes: []Node{{Host: "worker01", IP: "10.0.0.3"}},
+		},
+	}
+}
+
+func TestRollbackNode(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	hookFile := filepath.Join(dir, "hook-fired")
+	script := mustWriteHookScript(t, dir, "touch "+hookFile)
+	plan := rollbackTestPlan()
+	plan.Hooks = []Hook{
+		{Event: HookEventPreNodeUpgrade, Command: script},
+		{Event: HookEventPostNodeUpgrade, Command: script},
+		{Event: HookEventOnFailure, Command: script},
+	}
+	for _, n := range []Node{plan.Master.Nodes[0], plan.Worker.Nodes[0]} {
+		runner := &fakeRunner{}
+		var explainer explain.AnsibleEventExplainer
+		e := ansibleExecutor{
+			options:             ExecutorOptions{RunsDirectory: dir},
+			stdout:              ioutil.Discard,
+			consoleOutputFormat: ansible.RawFormat,
+			runnerExplainerFactory: func(exp explain.AnsibleEventExplainer, _ io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+				explainer = exp
+				return runner, &explain.AnsibleEventStreamExplainer{}, nil
+			},
+		}
+		if err := e.RollbackNode(plan, n); err != nil {
+			t.Errorf("unexpected error rolling back node %q: %v", n.Host, err)
+			continue
+		}
+		if len(runner.allNodesPlaybooks) != 0 {
+			t.Errorf("expected no playbooks to run on all nodes, but ran %v", runner.allNodesPlaybooks)
+		}
+		if !reflect.DeepEqual(runner.onNodePlaybooks, []string{"upgrade-rollback.yaml"}) {
+			t.Errorf("expected playbook %q to run, but ran %v", "upgrade-rollback.yaml", runner.onNodePlaybooks)
+		}
+		if !reflect.DeepEqual(runner.limit, []string{n.Host}) {
+			t.Errorf("expected the rollback to be limited to %q, but was limited to %v", n.Host, runner.limit)
+		}
+		if explainer == nil {
+			t.Errorf("expected the rollback to use an explainer, but it did not")
+		}
+	}
+	// The rollback is not an upgrade, and must not fire the upgrade hooks
+	if _, err := os.Stat(hookFile); err == nil {
+		t.Errorf("expected no hooks to fire, but they did")
+	}
+}
+
+func TestRemoveUpgradeBackup(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:             ExecutorOptions{RunsDirectory: dir},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return runner, &explain.AnsibleEventStreamExplainer{}, nil
+		},
+	}
+	plan := rollbackTestPlan()
+	if err := e.RemoveUpgradeBackup(plan, plan.Worker.Nodes[0]); err != nil {
+		t.Fatalf("unexpected error removing upgrade backup: %v", err)
+	}
+	if !reflect.DeepEqual(runner.onNodePlaybooks, []string{"_upgrade-backup-cleanup.yaml"}) {
+		t.Errorf("expected playbook %q to run, but ran %v", "_upgrade-backup-cleanup.yaml", runner.onNodePlaybooks)
+	}
+	if !reflect.DeepEqual(runner.limit, []string{"worker01"}) {
+		t.Errorf("expected the cleanup to be limited to %q, but was limited to %v", "worker01", runner.limit)
+	}
+}
+
+// extracting the backup only overwrites the files in it, so the files added by the
+// upgrade must be removed before the backup is restored
+func TestRollbackRemovesFilesBeforeRestoring(t *testing.T) {
+	b, err := ioutil.ReadFile("../../ansible/roles/upgrade-rollback/tasks/main.yaml")
+	if err != nil {
+		t.Fatalf("error reading role: %v", err)
+	}
+	var tasks []struct {
+		Name      string
+		Command   string
+		File      map[string]string
+		WithItems string `yaml:"with_items"`
+	}
+	if err = yaml.Unmarshal(b, &tasks); err != nil {
+		t.Fatalf("error unmarshaling role: %v", err)
+	}
+	removed, restored := -1, -1
+	for i, task := range tasks {
+		if task.File["state"] == "absent" && task.WithItems == "{{ upgrade_backup_files }}" {
+			removed = i
+		}
+		if strings.HasPrefix(task.Command, "tar --extract") {
+			restored = i
+		}
+	}
+	if removed == -1 {
+		t.Fatal("the backed up files are not removed before restoring the backup")
+	}
+	if restored == -1 {
+		t.Fatal("the backup is not restored")
+	}
+	if removed > restored {
+		t.Errorf("the backed up files are removed after restoring the backup")
+	}
+}
+
+func TestRollbackPrereqs(t *testing.T) {
+	tests := []struct {
+		name string
+		plan func() Plan
+		node Node
+	}{
+		{
+			name: "not in plan",
+			plan: rollbackTestPlan,
+			node: Node{Host: "other", IP: "10.0.0.10"},
+		},
+		{
+			name: "etcd node",
+			plan: rollbackTestPlan,
+			node: Node{Host: "etcd01", IP: "10.0.0.1"},
+		},
+		{
+			name: "master that is an etcd member",
+			plan: func() Plan {
+				p := rollbackTestPlan()
+				p.Etcd.Nodes = append(p.Etcd.Nodes, p.Master.Nodes[0])
+				return p
+			},
+			node: Node{Host: "master01", IP: "10.0.0.2"},
+		},
+	}
+	for _, test := range tests {
+		if err := checkRollbackPrereqs(test.plan(), test.node); err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/data"
 )
@@ -18,6 +20,8 @@ type fakeUpgradeKubeClient struct {
 	getPersistentVolume      func(name string) (*data.PersistentVolume, error)
 	getPersistentVolumeClaim func(name string) (*data.PersistentVolumeClaim, error)
 	getStatefulSet           func() (*data.StatefulSet, error)
+	getDeployment            func() (*data.Deployment, error)
+	listPDBs                 func() (*data.PodDisruptionBudgetList, error)
 }
 
 func (f fakeUpgradeKubeClient) ListPods() (*data.PodList, error) {
@@ -69,10 +73,25 @@ func (f fakeUpgradeKubeClient) GetStatefulSet(namespace, name string) (*data.Sta
 	return nil, errors.New("StatefulSet not found")
 }
 
+func (f fakeUpgradeKubeClient) GetDeployment(namespace, name string) (*data.Deployment, error) {
+	if f.getDeployment != nil {
+		return f.getDeployment()
+	}
+	return nil, errors.New("Deployment not found")
+}
+
+func (f fakeUpgradeKubeClient) ListPodDisruptionBudgets() (*data.PodDisruptionBudgetList, error) {
+	if f.listPDBs != nil {
+		return f.listPDBs()
+	}
+	return &data.PodDisruptionBudgetList{}, nil
+}
+
 func getSafePodWithCreatedByRef(t *testing.T, nodeName string, createdByKind string) data.Pod {
 	createdByRef := data.SerializedReference{
 		Reference: data.ObjectReference{
-			Kind: createdByKind,
+			Kind:      createdByKind,
+			Namespace: "foo",
 		},
 	}
 	b, err := json.Marshal(createdByRef)
@@ -105,7 +124,7 @@ func TestDetectNodeUpgradeSafetyEtcdCountUnsafe(t *testing.T) {
 	}
 	node := plan.Etcd.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(etcdNodeCountErr); !ok {
@@ -127,7 +146,7 @@ func TestDetectNodeUpgradeSafetyMasterCountUnsafe(t *testing.T) {
 	}
 	node := plan.Master.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(masterNodeCountErr); !ok {
@@ -154,7 +173,7 @@ func TestDetectNodeUpgradeSafetyMasterLoadBalancingUnsafe(t *testing.T) {
 	}
 	node := plan.Master.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(masterNodeLoadBalancingErr); !ok {
@@ -181,7 +200,7 @@ func TestDetectNodeUpgradeSafetyMasterLoadBalancingSafe(t *testing.T) {
 	}
 	node := plan.Master.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 0 {
 		t.Errorf("did not expect an error, but got %d", len(errs))
 	}
@@ -201,7 +220,7 @@ func TestDetectNodeUpgradeSafetyIngress(t *testing.T) {
 	}
 	node := plan.Ingress.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(ingressNotSupportedErr); !ok {
@@ -210,27 +229,199 @@ func TestDetectNodeUpgradeSafetyIngress(t *testing.T) {
 }
 
 func TestDetectNodeUpgradeSafetyStorage(t *testing.T) {
-	plan := Plan{
-		Storage: OptionalNodeGroup{
-			ExpectedCount: 1,
-			Nodes: []Node{
-				{
-					Host: "foo",
-					IP:   "10.0.0.1",
+	tests := []struct {
+		name          string
+		replicaCount  uint
+		bricks        []string
+		offline       []string
+		pendingHeals  map[string]string
+		volumeInfoErr error
+		expectedErr   error
+	}{
+		{
+			name: "no volumes",
+		},
+		{
+			name:         "volume without a brick on the node",
+			replicaCount: 2,
+			bricks:       []string{"bar:/data/vol", "baz:/data/vol"},
+		},
+		{
+			name:         "replicated volume with healthy replicas",
+			replicaCount: 2,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol"},
+		},
+		{
+			name:         "distributed volume",
+			replicaCount: 1,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol"},
+			expectedErr:  volumeNotReplicatedErr{volume: "vol"},
+		},
+		{
+			name:         "replica is offline",
+			replicaCount: 2,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol"},
+			offline:      []string{"bar:/data/vol"},
+			expectedErr:  volumeReplicasUnhealthyErr{volume: "vol", healthy: 0, required: 1},
+		},
+		{
+			name:         "replica 3 volume would lose quorum",
+			replicaCount: 3,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol", "baz:/data/vol"},
+			offline:      []string{"baz:/data/vol"},
+			expectedErr:  volumeReplicasUnhealthyErr{volume: "vol", healthy: 1, required: 2},
+		},
+		{
+			name:         "offline replica in another replica set",
+			replicaCount: 2,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol", "baz:/data/vol", "qux:/data/vol"},
+			offline:      []string{"qux:/data/vol"},
+		},
+		{
+			name:         "pending heals",
+			replicaCount: 2,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol"},
+			pendingHeals: map[string]string{"bar:/data/vol": "3"},
+			expectedErr:  volumePendingHealErr{volume: "vol", brick: "bar:/data/vol"},
+		},
+		{
+			name:         "brick not connected",
+			replicaCount: 2,
+			bricks:       []string{"foo:/data/vol", "bar:/data/vol"},
+			pendingHeals: map[string]string{"bar:/data/vol": "-"},
+			expectedErr:  volumePendingHealErr{volume: "vol", brick: "bar:/data/vol"},
+		},
+		{
+			name:          "volume info error",
+			volumeInfoErr: errors.New("gluster is not running"),
+			expectedErr:   fmt.Errorf("unable to determine node upgrade safety: %v", errors.New("gluster is not running")),
+		},
+	}
+	for _, test := range tests {
+		plan := Plan{
+			Storage: OptionalNodeGroup{
+				ExpectedCount: 1,
+				Nodes: []Node{
+					{
+						Host: "foo",
+						IP:   "10.0.0.1",
+					},
 				},
 			},
+		}
+		node := plan.Storage.Nodes[0]
+		storageClient := fakeStorageClient{
+			listVolumes: func() (*data.GlusterVolumeInfoCliOutput, error) {
+				if test.volumeInfoErr != nil {
+					return nil, test.volumeInfoErr
+				}
+				if len(test.bricks) == 0 {
+					return nil, nil
+				}
+				return getGlusterVolumeInfo("vol", test.replicaCount, test.bricks), nil
+			},
+			getVolumeStatus: func(volume string) (*data.GlusterVolumeStatusCliOutput, error) {
+				return getGlusterVolumeStatus(volume, test.bricks, test.offline), nil
+			},
+			getHealInfo: func(volume string) (*data.GlusterHealInfoCliOutput, error) {
+				return getGlusterHealInfo(test.bricks, test.pendingHeals), nil
+			},
+		}
+		errs := DetectNodeUpgradeSafety(plan, node, fakeUpgradeKubeClient{}, storageClient)
+		if test.expectedErr == nil {
+			if len(errs) != 0 {
+				t.Errorf("%s: expected no errors, but got %v", test.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: expected 1 error, but got %v", test.name, errs)
+		} else if errs[0].Error() != test.expectedErr.Error() {
+			t.Errorf("%s: expected error %q, but got %q", test.name, test.expectedErr, errs[0])
+		}
+	}
+}
+
+type fakeStorageClient struct {
+	listVolumes     func() (*data.GlusterVolumeInfoCliOutput, error)
+	getVolumeStatus func(volume string) (*data.GlusterVolumeStatusCliOutput, error)
+	getHealInfo     func(volume string) (*data.GlusterHealInfoCliOutput, error)
+}
+
+func (f fakeStorageClient) ListVolumes() (*data.GlusterVolumeInfoCliOutput, error) {
+	if f.listVolumes != nil {
+		return f.listVolumes()
+	}
+	return nil, nil
+}
+
+func (f fakeStorageClient) GetVolumeStatus(volume string) (*data.GlusterVolumeStatusCliOutput, error) {
+	if f.getVolumeStatus != nil {
+		return f.getVolumeStatus(volume)
+	}
+	return nil, errors.New("volume not found")
+}
+
+func (f fakeStorageClient) GetHealInfo(volume string) (*data.GlusterHealInfoCliOutput, error) {
+	if f.getHealInfo != nil {
+		return f.getHealInfo(volume)
+	}
+	return nil, errors.New("volume not found")
+}
+
+func getGlusterVolumeInfo(name string, replicaCount uint, bricks []string) *data.GlusterVolumeInfoCliOutput {
+	vol := &data.GlusterVolume{
+		Name:         name,
+		ReplicaCount: replicaCount,
+		BrickCount:   uint(len(bricks)),
+		Bricks:       &data.GlusterBricks{},
+	}
+	for _, b := range bricks {
+		vol.Bricks.Brick = append(vol.Bricks.Brick, &data.GlusterBrick{Text: b})
+	}
+	return &data.GlusterVolumeInfoCliOutput{
+		VolumeInfo: &data.GlusterVolumeInfo{
+			Volumes: &data.GlusterVolumes{
+				Count:  1,
+				Volume: []*data.GlusterVolume{vol},
+			},
 		},
 	}
-	node := plan.Storage.Nodes[0]
-	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
-	if len(errs) != 1 {
-		t.Errorf("Expected %d errors, but got %v", 1, errs)
-	} else if _, ok := errs[0].(storageNotSupportedErr); !ok {
-		t.Errorf("Expected storageUnsupportedError, but got %v", errs[0])
+}
+
+func getGlusterVolumeStatus(name string, bricks []string, offline []string) *data.GlusterVolumeStatusCliOutput {
+	vol := &data.GlusterVolumeStatusVolume{Name: name}
+	for _, b := range bricks {
+		parts := strings.SplitN(b, ":", 2)
+		status := 1
+		for _, o := range offline {
+			if o == b {
+				status = 0
+			}
+		}
+		vol.Node = append(vol.Node, &data.GlusterVolumeStatusNode{Hostname: parts[0], Path: parts[1], Status: status})
+	}
+	return &data.GlusterVolumeStatusCliOutput{
+		VolumeStatus: &data.GlusterVolumeStatus{
+			Volumes: &data.GlusterVolumeStatusVolumes{
+				Volume: []*data.GlusterVolumeStatusVolume{vol},
+			},
+		},
 	}
 }
 
+func getGlusterHealInfo(bricks []string, pendingHeals map[string]string) *data.GlusterHealInfoCliOutput {
+	healInfo := &data.GlusterHealInfo{Bricks: &data.GlusterHealInfoBricks{}}
+	for _, b := range bricks {
+		entries := "0"
+		if n, ok := pendingHeals[b]; ok {
+			entries = n
+		}
+		healInfo.Bricks.Brick = append(healInfo.Bricks.Brick, &data.GlusterHealInfoBrick{Name: b, NumberOfEntries: entries})
+	}
+	return &data.GlusterHealInfoCliOutput{HealInfo: healInfo}
+}
+
 func TestDetectNodeUpgradeSafetyWorkerCountUnsafe(t *testing.T) {
 	plan := Plan{
 		Worker: NodeGroup{
@@ -245,7 +436,7 @@ func TestDetectNodeUpgradeSafetyWorkerCountUnsafe(t *testing.T) {
 	}
 	node := plan.Worker.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(workerNodeCountErr); !ok {
@@ -271,7 +462,7 @@ func TestDetectNodeUpgradeSafetyWorkerPodListError(t *testing.T) {
 	}
 	node := plan.Worker.Nodes[0]
 	k8sClient := fakeUpgradeKubeClient{listPods: func() (*data.PodList, error) { return nil, errors.New("some error") }}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if !strings.Contains(errs[0].Error(), "some error") {
@@ -318,7 +509,7 @@ func TestDetectNodeUpgradeSafetyWorkerPodHostPathVol(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(podUnsafeVolumeErr); !ok {
@@ -367,7 +558,7 @@ func TestDetectNodeUpgradeSafetyWorkerPodEmptyDirVol(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(podUnsafeVolumeErr); !ok {
@@ -438,7 +629,7 @@ func TestDetectNodeUpgradeSafetyWorkerPodHostPathPersistentVol(t *testing.T) {
 			return nil, fmt.Errorf("PV not found")
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(podUnsafePersistentVolumeErr); !ok {
@@ -482,7 +673,7 @@ func TestDetectNodeUpgradeSafetyWorkerSingleDaemon(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(podUnsafeDaemonErr); !ok {
@@ -526,7 +717,7 @@ func TestDetectNodeUpgradeSafetyWorkerSafeDaemon(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 0 {
 		t.Errorf("Did not expect errors, but got: %v", errs)
 	}
@@ -560,7 +751,7 @@ func TestDetectNodeUpgradeSafetyLonePod(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(unmanagedPodErr); !ok {
@@ -603,7 +794,7 @@ func TestDetectNodeUpgradeSafetyUnreplicatedController(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 2 {
 		t.Fatalf("Expected %d errors, but got %v", 2, errs)
 	}
@@ -649,7 +840,7 @@ func TestDetectNodeUpgradeSafetyUnreplicatedReplicaSet(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 2 {
 		t.Fatalf("Expected %d errors, but got %v", 2, errs)
 	}
@@ -695,7 +886,7 @@ func TestDetectNodeUpgradeSafetyUnreplicatedStatefulSet(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(unsafeReplicaCountErr); !ok {
@@ -730,7 +921,7 @@ func TestDetectNodeUpgradeSafetyJobRunningOnNode(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(podRunningJobErr); !ok {
@@ -773,7 +964,7 @@ func TestDetectNodeUpgradeSafetyAllReplicaSetPodsSameNode(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(replicasOnSingleNodeErr); !ok {
@@ -816,10 +1007,355 @@ func TestDetectNodeUpgradeSafetyAllReplicaControllerPodsSameNode(t *testing.T) {
 			}, nil
 		},
 	}
-	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
 	if len(errs) != 1 {
 		t.Errorf("Expected %d errors, but got %v", 1, errs)
 	} else if _, ok := errs[0].(replicasOnSingleNodeErr); !ok {
 		t.Errorf("expected replicasOnSingleNodeErr, but got %T", errs[0])
 	}
 }
+
+func getPodDisruptionBudget(namespace, name string, matchLabels map[string]string, disruptionsAllowed int32) data.PodDisruptionBudget {
+	return data.PodDisruptionBudget{
+		ObjectMeta: data.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: data.PodDisruptionBudgetSpec{
+			Selector: &data.LabelSelector{MatchLabels: matchLabels},
+		},
+		Status: data.PodDisruptionBudgetStatus{
+			PodDisruptionsAllowed: disruptionsAllowed,
+		},
+	}
+}
+
+func TestDetectNodeUpgradeSafetyPodDisruptionBudget(t *testing.T) {
+	tests := []struct {
+		name               string
+		podsOnNode         int
+		disruptionsAllowed int32
+		selector           map[string]string
+		expectErr          bool
+	}{
+		{
+			name:               "budget allows evicting all pods",
+			podsOnNode:         2,
+			disruptionsAllowed: 2,
+			selector:           map[string]string{"app": "foo"},
+		},
+		{
+			name:               "budget allows evicting some of the pods",
+			podsOnNode:         2,
+			disruptionsAllowed: 1,
+			selector:           map[string]string{"app": "foo"},
+			expectErr:          true,
+		},
+		{
+			name:               "budget does not allow disruptions",
+			podsOnNode:         1,
+			disruptionsAllowed: 0,
+			selector:           map[string]string{"app": "foo"},
+			expectErr:          true,
+		},
+		{
+			name:               "budget does not select the pods",
+			podsOnNode:         1,
+			disruptionsAllowed: 0,
+			selector:           map[string]string{"app": "bar"},
+		},
+	}
+	for _, test := range tests {
+		plan := Plan{
+			Worker: NodeGroup{
+				ExpectedCount: 2,
+				Nodes: []Node{
+					{
+						Host: "foo",
+						IP:   "10.0.0.1",
+					},
+				},
+			},
+		}
+		node := plan.Worker.Nodes[0]
+		var pods []data.Pod
+		for i := 0; i < test.podsOnNode; i++ {
+			pod := getSafePodWithCreatedByRef(t, node.Host, "ReplicaSet")
+			pod.Name = fmt.Sprintf("foo-%d", i)
+			pod.Labels = map[string]string{"app": "foo"}
+			pods = append(pods, pod)
+		}
+		pdb := getPodDisruptionBudget("foo", "foo-pdb", test.selector, test.disruptionsAllowed)
+		k8sClient := fakeUpgradeKubeClient{
+			listPods: func() (*data.PodList, error) {
+				return &data.PodList{Items: pods}, nil
+			},
+			listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+				return &data.PodDisruptionBudgetList{Items: []data.PodDisruptionBudget{pdb}}, nil
+			},
+			// The replica set has replicas on other nodes
+			getReplicaSet: func() (*data.ReplicaSet, error) {
+				return &data.ReplicaSet{Status: data.ReplicaSetStatus{Replicas: 3}}, nil
+			},
+		}
+		errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
+		if !test.expectErr {
+			if len(errs) != 0 {
+				t.Errorf("%s: unexpected errors: %v", test.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: expected 1 error, but got %v", test.name, errs)
+			continue
+		}
+		pdbErr, ok := errs[0].(podDisruptionBudgetErr)
+		if !ok {
+			t.Errorf("%s: expected podDisruptionBudgetErr, but got %T", test.name, errs[0])
+			continue
+		}
+		if pdbErr.name != "foo-pdb" || pdbErr.podsOnNode != int32(test.podsOnNode) || pdbErr.disruptionsAllowed != test.disruptionsAllowed {
+			t.Errorf("%s: unexpected error: %v", test.name, pdbErr)
+		}
+	}
+}
+
+// a budget that allows the disruption does not make the pod's controller safe to drain
+func TestDetectNodeUpgradeSafetyPodDisruptionBudgetChecksController(t *testing.T) {
+	tests := []struct {
+		kind         string
+		replicaSet   *data.ReplicaSet
+		expectedErrs []error
+	}{
+		{
+			kind:       "ReplicaSet",
+			replicaSet: &data.ReplicaSet{Status: data.ReplicaSetStatus{Replicas: 1}},
+			expectedErrs: []error{
+				unsafeReplicaCountErr{kind: "ReplicaSet", namespace: "foo"},
+				replicasOnSingleNodeErr{kind: "ReplicaSet", namespace: "foo"},
+			},
+		},
+		{
+			kind:         "Job",
+			expectedErrs: []error{podRunningJobErr{namespace: "foo"}},
+		},
+	}
+	for _, test := range tests {
+		plan := Plan{
+			Worker: NodeGroup{
+				ExpectedCount: 2,
+				Nodes: []Node{
+					{
+						Host: "foo",
+						IP:   "10.0.0.1",
+					},
+				},
+			},
+		}
+		node := plan.Worker.Nodes[0]
+		pod := getSafePodWithCreatedByRef(t, node.Host, test.kind)
+		pod.Labels = map[string]string{"app": "foo"}
+		k8sClient := fakeUpgradeKubeClient{
+			listPods: func() (*data.PodList, error) {
+				return &data.PodList{Items: []data.Pod{pod}}, nil
+			},
+			listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+				pdb := getPodDisruptionBudget("foo", "foo-pdb", map[string]string{"app": "foo"}, 1)
+				return &data.PodDisruptionBudgetList{Items: []data.PodDisruptionBudget{pdb}}, nil
+			},
+			getReplicaSet: func() (*data.ReplicaSet, error) {
+				return test.replicaSet, nil
+			},
+		}
+		errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
+		if !reflect.DeepEqual(errs, test.expectedErrs) {
+			t.Errorf("%s: expected errors %v, but got %v", test.kind, test.expectedErrs, errs)
+		}
+	}
+}
+
+func TestDetectNodeUpgradeSafetyMultiplePodDisruptionBudgets(t *testing.T) {
+	plan := Plan{
+		Worker: NodeGroup{
+			ExpectedCount: 2,
+			Nodes: []Node{
+				{
+					Host: "foo",
+					IP:   "10.0.0.1",
+				},
+			},
+		},
+	}
+	node := plan.Worker.Nodes[0]
+	pod := getSafePodWithCreatedByRef(t, node.Host, "ReplicaSet")
+	pod.Labels = map[string]string{"app": "foo", "tier": "web"}
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{Items: []data.Pod{pod}}, nil
+		},
+		listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+			return &data.PodDisruptionBudgetList{
+				Items: []data.PodDisruptionBudget{
+					getPodDisruptionBudget("foo", "app-pdb", map[string]string{"app": "foo"}, 1),
+					getPodDisruptionBudget("foo", "tier-pdb", map[string]string{"tier": "web"}, 1),
+					// budgets in other namespaces do not cover the pod
+					getPodDisruptionBudget("bar", "bar-pdb", map[string]string{"app": "foo"}, 0),
+				},
+			}, nil
+		},
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			return &data.ReplicaSet{Status: data.ReplicaSetStatus{Replicas: 3}}, nil
+		},
+	}
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
+	if len(errs) != 1 {
+		t.Errorf("Expected %d errors, but got %v", 1, errs)
+	} else if _, ok := errs[0].(multiplePodDisruptionBudgetsErr); !ok {
+		t.Errorf("expected multiplePodDisruptionBudgetsErr, but got %T", errs[0])
+	}
+}
+
+func TestDetectNodeUpgradeSafetyUnreplicatedDeployment(t *testing.T) {
+	plan := Plan{
+		Worker: NodeGroup{
+			ExpectedCount: 2,
+			Nodes: []Node{
+				{
+					Host: "foo",
+					IP:   "10.0.0.1",
+				},
+			},
+		},
+	}
+	node := plan.Worker.Nodes[0]
+	pod := getSafePodWithCreatedByRef(t, node.Host, "ReplicaSet")
+	replicas := int32(1)
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{Items: []data.Pod{pod}}, nil
+		},
+		// the replica set has a transient replica count during a rollout
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			return &data.ReplicaSet{
+				ObjectMeta: data.ObjectMeta{
+					OwnerReferences: []data.OwnerReference{{Kind: "Deployment", Name: "foo"}},
+				},
+				Status: data.ReplicaSetStatus{
+					Replicas: 2,
+				},
+			}, nil
+		},
+		getDeployment: func() (*data.Deployment, error) {
+			return &data.Deployment{
+				Spec: data.DeploymentSpec{Replicas: &replicas},
+			}, nil
+		},
+	}
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient, fakeStorageClient{})
+	if len(errs) != 1 {
+		t.Errorf("Expected %d errors, but got %v", 1, errs)
+	} else if err, ok := errs[0].(unsafeReplicaCountErr); !ok {
+		t.Errorf("expected unsafeReplicaCountErr, but got %T", errs[0])
+	} else if err.kind != "Deployment" {
+		t.Errorf("expected the error to refer to the Deployment, but got %v", err)
+	}
+}
+
+func TestDetectWorkloadDisruptions(t *testing.T) {
+	nodes := []ListableNode{
+		{Node: Node{Host: "worker01", IP: "10.0.0.1"}, Roles: []string{"worker"}},
+		{Node: Node{Host: "worker02", IP: "10.0.0.2"}, Roles: []string{"worker"}},
+	}
+	rsPod := func(node string) data.Pod {
+		return getSafePodWithCreatedByRef(t, node, "ReplicaSet")
+	}
+	pdbPod := getSafePodWithCreatedByRef(t, "worker02", "StatefulSet")
+	pdbPod.Labels = map[string]string{"app": "zk"}
+	dsPod := getSafePodWithCreatedByRef(t, "worker01", "DaemonSet")
+	otherNodePod := getSafePodWithCreatedByRef(t, "worker03", "ReplicaSet")
+	replicas := int32(3)
+	var rsLookups int
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{rsPod("worker01"), rsPod("worker01"), rsPod("worker02"), pdbPod, dsPod, otherNodePod},
+			}, nil
+		},
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			rsLookups++
+			return &data.ReplicaSet{
+				ObjectMeta: data.ObjectMeta{
+					OwnerReferences: []data.OwnerReference{{Kind: "Deployment", Name: "web"}},
+				},
+			}, nil
+		},
+		getDeployment: func() (*data.Deployment, error) {
+			return &data.Deployment{Spec: data.DeploymentSpec{Replicas: &replicas}}, nil
+		},
+		listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+			return &data.PodDisruptionBudgetList{
+				Items: []data.PodDisruptionBudget{getPodDisruptionBudget("foo", "zk-pdb", map[string]string{"app": "zk"}, 0)},
+			}, nil
+		},
+	}
+	d, err := DetectWorkloadDisruptions(nodes, k8sClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployment := `Deployment "foo/web"`
+	pdb := `PodDisruptionBudget "foo/zk-pdb"`
+	expectedPods := map[string]map[string]int32{
+		"worker01": {deployment: 2},
+		"worker02": {deployment: 1, pdb: 1},
+	}
+	if !reflect.DeepEqual(d.Pods, expectedPods) {
+		t.Errorf("expected pods %v, but got %v", expectedPods, d.Pods)
+	}
+	expectedAllowed := map[string]int32{deployment: 2, pdb: 0}
+	if !reflect.DeepEqual(d.Allowed, expectedAllowed) {
+		t.Errorf("expected allowed disruptions %v, but got %v", expectedAllowed, d.Allowed)
+	}
+	if rsLookups != 1 {
+		t.Errorf("expected the ReplicaSet to be looked up once, but was looked up %d times", rsLookups)
+	}
+}
+
+func TestWaitForNodesReady(t *testing.T) {
+	notReady := readyNode("worker02")
+	notReady.Status.Conditions[0].Status = "False"
+	nodes := []ListableNode{
+		listableNode("etcd01", "1.0.0", "etcd"),
+		listableNode("worker01", "1.0.0", "worker"),
+		listableNode("worker02", "1.0.0", "worker"),
+	}
+	tests := []struct {
+		name       string
+		registered []data.Node
+		expectErr  bool
+	}{
+		{
+			name:       "all nodes ready",
+			registered: []data.Node{readyNode("worker01"), readyNode("worker02")},
+		},
+		{
+			name:       "node not ready",
+			registered: []data.Node{readyNode("worker01"), notReady},
+			expectErr:  true,
+		},
+		{
+			name:       "node not registered",
+			registered: []data.Node{readyNode("worker01")},
+			expectErr:  true,
+		},
+	}
+	for _, test := range tests {
+		client := fakeNodeLister{nodes: &data.NodeList{Items: test.registered}}
+		err := WaitForNodesReady(nodes, client, 10*time.Millisecond, time.Millisecond)
+		if test.expectErr && err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
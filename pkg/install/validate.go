@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -152,6 +153,9 @@ func (p *Plan) validate() (bool, []error) {
 	v.validateWithErrPrefix("Ingress nodes", &p.Ingress)
 	v.validate(&p.NFS)
 	v.validateWithErrPrefix("Storage nodes", &p.Storage)
+	for i, h := range p.Hooks {
+		v.validateWithErrPrefix(fmt.Sprintf("Hook #%d", i+1), h)
+	}
 
 	return v.valid()
 }
@@ -203,6 +207,17 @@ func (c *CertsConfig) validate() (bool, []error) {
 	if _, err := time.ParseDuration(c.CAExpiry); c.CAExpiry != "" && err != nil { // don't error when empty for backwards compat
 		v.addError(fmt.Errorf("Invalid CA certificate expiry %q provider: %v", c.CAExpiry, err))
 	}
+	if c.CACert == "" && (c.CAKey != "" || c.CAChain != "") {
+		v.addError(errors.New("CA certificate is required when the CA key or chain are provided"))
+	}
+	if c.CACert != "" && c.CAKey == "" {
+		v.addError(errors.New("CA key is required when the CA certificate is provided"))
+	}
+	for _, f := range []string{c.CACert, c.CAKey, c.CAChain} {
+		if _, err := os.Stat(f); f != "" && os.IsNotExist(err) {
+			v.addError(fmt.Errorf("CA file was not found at %q", f))
+		}
+	}
 	return v.valid()
 }
 
@@ -590,6 +605,36 @@ func (sv StorageVolume) validate() (bool, []error) {
 	return v.valid()
 }
 
+func (h Hook) validate() (bool, []error) {
+	v := newValidator()
+	if !util.Contains(h.Event, hookEvents()) {
+		v.addError(fmt.Errorf("%q is not a valid hook event. Options are %v", h.Event, hookEvents()))
+	}
+	if h.Command == "" && h.URL == "" {
+		v.addError(errors.New("Either a command or a URL must be provided"))
+	}
+	if h.Command != "" && h.URL != "" {
+		v.addError(errors.New("Only one of command or URL can be provided"))
+	}
+	if h.Command != "" {
+		if !filepath.IsAbs(h.Command) {
+			v.addError(errors.New("Hook command must be an absolute path"))
+		} else if _, err := os.Stat(h.Command); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("Hook command was not found at %q", h.Command))
+		}
+	}
+	if h.URL != "" {
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.addError(fmt.Errorf("Hook URL %q is not a valid HTTP or HTTPS URL", h.URL))
+		}
+	}
+	if _, err := time.ParseDuration(h.Timeout); h.Timeout != "" && err != nil {
+		v.addError(fmt.Errorf("Invalid hook timeout %q provided: %v", h.Timeout, err))
+	}
+	return v.valid()
+}
+
 func validateAllowedAddress(address string) bool {
 	// First, validate that there are four octets with 1, 2 or 3 chars, separated by dots
 	r := regexp.MustCompile(`^[0-9*]{1,3}\.[0-9*]{1,3}\.[0-9*]{1,3}\.[0-9*]{1,3}$`)
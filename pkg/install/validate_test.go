@@ -168,6 +168,18 @@ func TestValidatePlanInvalidCACertificatesExpiry(t *testing.T) {
 	assertInvalidPlan(t, p)
 }
 
+func TestValidatePlanCAKeyRequired(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.CACert = "test/ca.pem"
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanCACertRequired(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.CAKey = "test/ca-key.pem"
+	assertInvalidPlan(t, p)
+}
+
 func TestValidatePlanEmptySSHUser(t *testing.T) {
 	p := validPlan
 	p.Cluster.SSH.User = ""
@@ -0,0 +1,138 @@
+// Package junit contains a JUnit XML report that can be consumed by
+// CI systems to display the outcome of kismatic operations.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TestSuites is the root element of a JUnit XML report
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite is a collection of test cases, such as the rules that were
+// executed against a single node, or the tasks of a single phase.
+type TestSuite struct {
+	Name      string     `xml:"name,attr"`
+	Tests     int        `xml:"tests,attr"`
+	Failures  int        `xml:"failures,attr"`
+	Skipped   int        `xml:"skipped,attr"`
+	Time      float64    `xml:"time,attr"`
+	TestCases []TestCase `xml:"testcase"`
+}
+
+// TestCase is a single rule or task
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr,omitempty"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *Failure `xml:"failure,omitempty"`
+	Skipped   *Skipped `xml:"skipped,omitempty"`
+}
+
+// Failure describes why a test case failed
+type Failure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// Skipped marks a test case as skipped
+type Skipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// Report collects test cases into test suites. It is safe for concurrent use.
+type Report struct {
+	mu     sync.Mutex
+	suites []TestSuite
+}
+
+// AddTestCase adds the test case to the suite with the given name.
+// The suite is created if it does not exist.
+func (r *Report) AddTestCase(suite string, tc TestCase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.suites {
+		if r.suites[i].Name == suite {
+			r.suites[i].TestCases = append(r.suites[i].TestCases, tc)
+			return
+		}
+	}
+	r.suites = append(r.suites, TestSuite{Name: suite, TestCases: []TestCase{tc}})
+}
+
+// AddResult is a convenience method for adding a test case that passed when
+// the error is nil, or failed with the error otherwise.
+func (r *Report) AddResult(suite, name string, err error) {
+	tc := TestCase{Name: name, ClassName: suite}
+	if err != nil {
+		tc.Failure = &Failure{Message: err.Error()}
+	}
+	r.AddTestCase(suite, tc)
+}
+
+// TestSuites returns the collected test suites, with the test counts
+// and times computed
+func (r *Report) TestSuites() TestSuites {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := TestSuites{}
+	for _, s := range r.suites {
+		suite := TestSuite{Name: s.Name}
+		for _, tc := range s.TestCases {
+			suite.Tests++
+			suite.Time += tc.Time
+			if tc.Failure != nil {
+				suite.Failures++
+			}
+			if tc.Skipped != nil {
+				suite.Skipped++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		all.Tests += suite.Tests
+		all.Failures += suite.Failures
+		all.Skipped += suite.Skipped
+		all.Suites = append(all.Suites, suite)
+	}
+	return all
+}
+
+// WriteFile writes the report to the given file as JUnit XML
+func (r *Report) WriteFile(file string) error {
+	b, err := xml.MarshalIndent(r.TestSuites(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JUnit report: %v", err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("error creating JUnit report file %q: %v", file, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("error writing JUnit report file %q: %v", file, err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing JUnit report file %q: %v", file, err)
+	}
+	return nil
+}
+
+// ParseReportOption parses the value of a --report option, which must be
+// in the form junit=<file>, and returns the path of the report file.
+func ParseReportOption(opt string) (string, error) {
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) != 2 || parts[0] != "junit" || parts[1] == "" {
+		return "", fmt.Errorf("invalid report option %q: must be in the form junit=<file>", opt)
+	}
+	return parts[1], nil
+}
@@ -0,0 +1,94 @@
+package junit
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportTestSuites(t *testing.T) {
+	r := &Report{}
+	r.AddResult("validation", "Plan file", nil)
+	r.AddResult("preflight: etcd01", "Port 2379 is available", errors.New("port in use"))
+	r.AddResult("validation", "SSH connectivity", errors.New("unreachable"))
+	r.AddTestCase("preflight: etcd01", TestCase{Name: "Docker installed", Skipped: &Skipped{}})
+
+	suites := r.TestSuites()
+	if suites.Tests != 4 {
+		t.Errorf("expected 4 tests, got %d", suites.Tests)
+	}
+	if suites.Failures != 2 {
+		t.Errorf("expected 2 failures, got %d", suites.Failures)
+	}
+	if suites.Skipped != 1 {
+		t.Errorf("expected 1 skipped, got %d", suites.Skipped)
+	}
+	if len(suites.Suites) != 2 {
+		t.Fatalf("expected 2 suites, got %d", len(suites.Suites))
+	}
+	if suites.Suites[0].Name != "validation" || suites.Suites[0].Tests != 2 || suites.Suites[0].Failures != 1 {
+		t.Errorf("unexpected validation suite: %+v", suites.Suites[0])
+	}
+	if suites.Suites[1].Name != "preflight: etcd01" || suites.Suites[1].Tests != 2 || suites.Suites[1].Skipped != 1 {
+		t.Errorf("unexpected preflight suite: %+v", suites.Suites[1])
+	}
+}
+
+func TestReportWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "junit-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "report.xml")
+
+	r := &Report{}
+	r.AddResult("smoketest: master01", "run smoke test", errors.New("timed out"))
+	if err := r.WriteFile(file); err != nil {
+		t.Fatalf("unexpected error writing report: %v", err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var suites TestSuites
+	if err := xml.Unmarshal(b, &suites); err != nil {
+		t.Fatalf("report is not valid XML: %v", err)
+	}
+	if len(suites.Suites) != 1 || len(suites.Suites[0].TestCases) != 1 {
+		t.Fatalf("unexpected report contents: %s", string(b))
+	}
+	tc := suites.Suites[0].TestCases[0]
+	if tc.Failure == nil || tc.Failure.Message != "timed out" {
+		t.Errorf("expected failure with message %q, got %+v", "timed out", tc.Failure)
+	}
+}
+
+func TestParseReportOption(t *testing.T) {
+	tests := []struct {
+		opt       string
+		file      string
+		expectErr bool
+	}{
+		{opt: "junit=report.xml", file: "report.xml"},
+		{opt: "junit=/tmp/out=1.xml", file: "/tmp/out=1.xml"},
+		{opt: "junit=", expectErr: true},
+		{opt: "report.xml", expectErr: true},
+		{opt: "html=report.html", expectErr: true},
+	}
+	for _, test := range tests {
+		file, err := ParseReportOption(test.opt)
+		if test.expectErr && err == nil {
+			t.Errorf("%q: expected an error, but didn't get one", test.opt)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%q: unexpected error: %v", test.opt, err)
+		}
+		if file != test.file {
+			t.Errorf("%q: expected file %q, got %q", test.opt, test.file, file)
+		}
+	}
+}
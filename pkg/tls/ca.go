@@ -1,13 +1,18 @@
 package tls
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
 )
@@ -67,3 +72,81 @@ func ReadCACert(name, dir string) (key, cert []byte, err error) {
 	}
 	return key, cert, nil
 }
+
+// ValidateCA verifies that an existing Certificate Authority can be used to sign certificates
+// that are valid for the given period. The key must match the CA certificate, and the CA must
+// not expire before the certificates it signs. A CA that is not self-signed, such as an
+// intermediate CA, must be accompanied by the chain of certificates up to the root CA.
+func ValidateCA(key, cert, chain []byte, validFor time.Duration, now time.Time) error {
+	caCert, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		return fmt.Errorf("error parsing CA certificate: %v", err)
+	}
+	if !caCert.BasicConstraintsValid || !caCert.IsCA {
+		return errors.New("certificate is not a CA certificate")
+	}
+	if caCert.KeyUsage != 0 && caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.New("CA certificate is not allowed to sign certificates")
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(key)
+	if err != nil {
+		return fmt.Errorf("error parsing CA private key: %v", err)
+	}
+	certPub, err := x509.MarshalPKIXPublicKey(caCert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("error reading CA public key: %v", err)
+	}
+	keyPub, err := x509.MarshalPKIXPublicKey(caKey.Public())
+	if err != nil {
+		return fmt.Errorf("error reading CA private key: %v", err)
+	}
+	if !bytes.Equal(certPub, keyPub) {
+		return errors.New("private key does not match the CA certificate")
+	}
+	if now.Before(caCert.NotBefore) {
+		return fmt.Errorf("CA certificate is not valid until %s", caCert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(caCert.NotAfter) {
+		return fmt.Errorf("CA certificate expired on %s", caCert.NotAfter.Format(time.RFC3339))
+	}
+	if now.Add(validFor).After(caCert.NotAfter) {
+		return fmt.Errorf("CA certificate expires on %s, before the certificates it signs would expire", caCert.NotAfter.Format(time.RFC3339))
+	}
+
+	if len(chain) == 0 {
+		if !selfSigned(caCert) {
+			return fmt.Errorf("CA certificate is issued by %q, but the certificate chain was not provided", caCert.Issuer.CommonName)
+		}
+		return nil
+	}
+	chainCerts, err := helpers.ParseCertificatesPEM(chain)
+	if err != nil {
+		return fmt.Errorf("error parsing CA certificate chain: %v", err)
+	}
+	if len(chainCerts) == 0 {
+		return errors.New("CA certificate chain does not contain any certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	// The last certificate of the chain is trusted even if it is not self-signed,
+	// as it is the root of trust that is distributed to the nodes
+	for i, c := range chainCerts {
+		if selfSigned(c) || i == len(chainCerts)-1 {
+			opts.Roots.AddCert(c)
+			continue
+		}
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := caCert.Verify(opts); err != nil {
+		return fmt.Errorf("CA certificate does not chain to the provided certificates: %v", err)
+	}
+	return nil
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
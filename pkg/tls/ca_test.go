@@ -1,10 +1,17 @@
 package tls
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/helpers"
 )
 
@@ -46,3 +53,74 @@ func TestNewCACert(t *testing.T) {
 		t.Errorf("expected expiration date %q, got %q", expectedExpiration, parsedCert.NotAfter)
 	}
 }
+
+// newTestCA creates a CA certificate that is signed by the parent, or self-signed when the parent is nil
+func newTestCA(t *testing.T, cn string, parent *x509.Certificate, parentKey *rsa.PrivateKey, notAfter time.Time) (*x509.Certificate, *rsa.PrivateKey, []byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return cert, key, certPEM, keyPEM
+}
+
+func TestValidateCA(t *testing.T) {
+	now := time.Now()
+	year := 365 * 24 * time.Hour
+	root, rootKey, rootPEM, rootKeyPEM := newTestCA(t, "root", nil, nil, now.Add(10*year))
+	_, _, otherRootPEM, _ := newTestCA(t, "other-root", nil, nil, now.Add(10*year))
+	_, _, intermediatePEM, intermediateKeyPEM := newTestCA(t, "intermediate", root, rootKey, now.Add(5*year))
+	_, _, shortLivedPEM, shortLivedKeyPEM := newTestCA(t, "short-lived", nil, nil, now.Add(24*time.Hour))
+	leafKeyPEM, leafPEM, err := NewCert(&CA{Key: rootKeyPEM, Cert: rootPEM}, csr.CertificateRequest{CN: "leaf", KeyRequest: csr.NewBasicKeyRequest()}, year)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      []byte
+		cert     []byte
+		chain    []byte
+		validFor time.Duration
+		valid    bool
+	}{
+		{name: "self-signed CA", key: rootKeyPEM, cert: rootPEM, validFor: year, valid: true},
+		{name: "intermediate CA with chain", key: intermediateKeyPEM, cert: intermediatePEM, chain: rootPEM, validFor: year, valid: true},
+		{name: "intermediate CA without chain", key: intermediateKeyPEM, cert: intermediatePEM, validFor: year},
+		{name: "intermediate CA with wrong chain", key: intermediateKeyPEM, cert: intermediatePEM, chain: otherRootPEM, validFor: year},
+		{name: "key does not match", key: intermediateKeyPEM, cert: rootPEM, validFor: year},
+		{name: "not a CA", key: leafKeyPEM, cert: leafPEM, validFor: time.Hour},
+		{name: "expires before the certificates", key: shortLivedKeyPEM, cert: shortLivedPEM, validFor: year},
+		{name: "certificates expire before the CA", key: shortLivedKeyPEM, cert: shortLivedPEM, validFor: time.Hour, valid: true},
+	}
+	for _, test := range tests {
+		err := ValidateCA(test.key, test.cert, test.chain, test.validFor, now)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", test.name)
+		}
+	}
+}
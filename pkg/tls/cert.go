@@ -154,8 +154,15 @@ func CertValid(commonName string, SANs []string, organizations []string, name, d
 		return nil, fmt.Errorf("error parsing cert %s: %v", name, err)
 	}
 
+	return ValidateCert(cert, cn, commonName, SANs, organizations), nil
+}
+
+// ValidateCert verifies the certificate against the common name, subject alternate names
+// and organizations using the same rules as CertValid. The name identifies the certificate
+// in the returned warnings.
+func ValidateCert(cert *x509.Certificate, name string, commonName string, SANs []string, organizations []string) (warn []error) {
 	if cert.Subject.CommonName != commonName {
-		warn = append(warn, fmt.Errorf("Certificate %q: CN validation failed\n    expected %q, instead got %q", cn, commonName, cert.Subject.CommonName))
+		warn = append(warn, fmt.Errorf("Certificate %q: CN validation failed\n    expected %q, instead got %q", name, commonName, cert.Subject.CommonName))
 	}
 
 	var certSANs []string
@@ -172,7 +179,7 @@ func CertValid(commonName string, SANs []string, organizations []string, name, d
 		// sort for readability
 		sort.Strings(SANs)
 		sort.Strings(certSANs)
-		warn = append(warn, fmt.Errorf("Certificate %q: SANs validation failed\n    expected: \n\t%v \n    instead got: \n\t%v", cn, SANs, certSANs))
+		warn = append(warn, fmt.Errorf("Certificate %q: SANs validation failed\n    expected: \n\t%v \n    instead got: \n\t%v", name, SANs, certSANs))
 	}
 
 	// Validate organizations
@@ -182,11 +189,11 @@ func CertValid(commonName string, SANs []string, organizations []string, name, d
 		sort.Strings(cert.Subject.Organization)
 		warn = append(warn,
 			fmt.Errorf("Certificate %q: Organizations validation failed\n    expected: \n\t%v \n    instead got: \n\t%v",
-				cn, organizations, cert.Subject.Organization),
+				name, organizations, cert.Subject.Organization),
 		)
 	}
 
-	return warn, nil
+	return warn
 }
 
 func keyName(s string) string { return fmt.Sprintf("%s-key.pem", s) }
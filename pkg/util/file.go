@@ -2,7 +2,9 @@ package util
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 )
 
 // BackupDirectory checks for existence of the $sourceDir and backs it up to backupDir
@@ -21,3 +23,49 @@ func BackupDirectory(sourceDir string, backupDir string) (bool, error) {
 	// Directory does not already exist, nothing to do
 	return backedup, nil
 }
+
+// CopyDirectory checks for existence of the $sourceDir and copies its contents to backupDir,
+// leaving the $sourceDir in place
+func CopyDirectory(sourceDir string, backupDir string) (bool, error) {
+	if _, err := os.Stat(sourceDir); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Could not determine if %q directory exists: %v", sourceDir, err)
+	}
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(backupDir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dest, info.Mode())
+		}
+		return copyFile(path, dest, info.Mode())
+	})
+	if err != nil {
+		return false, fmt.Errorf("Could not copy %q directory: %v", sourceDir, err)
+	}
+	return true, nil
+}
+
+func copyFile(source, dest string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -40,3 +40,49 @@ func TestBackupClientDirectoryNotExists(t *testing.T) {
 		t.Errorf("Expected directory to not exist")
 	}
 }
+
+func TestCopyDirectory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ket-copydir-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	sourceDir := filepath.Join(tmpDir, "generated")
+	if err = os.MkdirAll(filepath.Join(sourceDir, "keys"), 0755); err != nil {
+		t.Fatalf("error creating source dir: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(sourceDir, "keys", "ca.pem"), []byte("ca"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	backupDir := filepath.Join(tmpDir, "backup")
+	exists, err := CopyDirectory(sourceDir, backupDir)
+	if err != nil {
+		t.Errorf("Expected error to be nil, got: %v", err)
+	}
+	if !exists {
+		t.Errorf("Expected directory to exist")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(backupDir, "keys", "ca.pem"))
+	if err != nil || string(b) != "ca" {
+		t.Errorf("Expected file to be copied, got %q: %v", string(b), err)
+	}
+	if _, err = os.Stat(filepath.Join(sourceDir, "keys", "ca.pem")); err != nil {
+		t.Errorf("Expected source directory to be left in place, got: %v", err)
+	}
+}
+
+func TestCopyDirectoryNotExists(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ket-copydir-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	exists, err := CopyDirectory(filepath.Join(tmpDir, "generated"), filepath.Join(tmpDir, "backup"))
+	if err != nil {
+		t.Errorf("Expected error to be nil, got: %v", err)
+	}
+	if exists {
+		t.Errorf("Expected directory to not exist")
+	}
+}